@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+
+	"gopass/internal/apitoken"
+	"gopass/internal/authn"
+	"gopass/internal/config"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/keystore"
+	"gopass/internal/mailer"
+	"gopass/internal/oidc"
+	"gopass/internal/session"
+	"gopass/internal/vault"
+)
+
+// command 管理命令
+type command struct {
+	name    string
+	usage   string
+	needsDB bool
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:    "rotate-key",
+		usage:   "rotate-key -user <username>    轮换用户的保险库密钥并重新加密所有条目，撤销用户的会话和访问令牌",
+		needsDB: true,
+		run:     rotateKey,
+	},
+	{
+		name:    "unlock-user",
+		usage:   "unlock-user -user <username>    解除连续登录失败导致的账户锁定",
+		needsDB: true,
+		run:     unlockUser,
+	},
+	{
+		name:    "revoke-sessions",
+		usage:   "revoke-sessions -user <username>    撤销用户的所有登录会话",
+		needsDB: true,
+		run:     revokeSessions,
+	},
+	{
+		name:    "rotate-jwt-key",
+		usage:   "rotate-jwt-key [-alg HS256|EdDSA|ES256]    生成新的JWT签名密钥，旧密钥在令牌有效期内仍可验证",
+		needsDB: true,
+		run:     rotateJWTKey,
+	},
+	{
+		name:  "kms-serve",
+		usage: "kms-serve [-addr 127.0.0.1:9090] [-key-file kms.key] [-name gopass] [-token ...]    运行本地KMS替身服务",
+		run:   kmsServe,
+	},
+	{
+		name:  "oidc-serve",
+		usage: "oidc-serve [-addr 127.0.0.1:9091] [-client-id gopass] [-client-secret ...]    运行本地OIDC身份提供者替身服务",
+		run:   oidcServe,
+	},
+	{
+		name:  "ldap-serve",
+		usage: "ldap-serve [-addr 127.0.0.1:3389] [-base-dn dc=example,dc=test] [-bind-dn ... -bind-password ...] -user uid:password[:mail] ...    运行本地LDAP目录替身服务",
+		run:   ldapServe,
+	},
+	{
+		name:  "smtp-serve",
+		usage: "smtp-serve [-addr 127.0.0.1:2525] [-user ... -password ...]    运行本地SMTP替身服务，收到的邮件输出到终端",
+		run:   smtpServe,
+	},
+}
+
+func main() {
+	log.SetFlags(0)
+
+	dbPath := flag.String("db", config.Load().DBPath, "数据库文件路径")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd := findCommand(flag.Arg(0))
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	if cmd.needsDB {
+		if err := database.InitDB(*dbPath); err != nil {
+			log.Fatal("Failed to initialize database:", err)
+		}
+		defer database.CloseDB()
+	}
+
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+// findCommand 按名称查找命令
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法: admin [-db gopass.db] <command> [options]")
+	fmt.Fprintln(os.Stderr, "命令:")
+	for _, cmd := range commands {
+		fmt.Fprintln(os.Stderr, "  "+cmd.usage)
+	}
+}
+
+// rotateKey 轮换用户的保险库密钥。主密码从标准输入读取，由用户本人输入
+func rotateKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	username := fs.String("user", "", "用户名")
+	fs.Parse(args)
+
+	userID, err := lookupUser(*username)
+	if err != nil {
+		return err
+	}
+
+	password, err := readSecret(fmt.Sprintf("Master password for %s: ", *username))
+	if err != nil {
+		return err
+	}
+
+	key, result, err := vault.Rotate(userID, password)
+	if err != nil {
+		return err
+	}
+	crypto.Wipe(key)
+
+	// 运行中的服务器在会话中缓存了旧密钥，个人访问令牌包装的也是旧密钥，全部作废
+	sessions, err := session.RevokeUser(userID, "")
+	if err != nil {
+		return err
+	}
+	tokens, err := apitoken.RevokeUser(userID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Vault key of %s rotated to generation %d, %d entries re-encrypted\n", *username, result.Generation, result.Reencrypted)
+	fmt.Printf("Revoked %d sessions and %d API tokens of %s\n", sessions, tokens, *username)
+	fmt.Printf("New recovery key (give it to %s, it will not be shown again): %s\n", *username, result.RecoveryKey)
+	return nil
+}
+
+// unlockUser 清除用户的登录失败计数和锁定状态。
+// 服务器内存中的限速记录不受影响，最长在退避结束后自动失效
+func unlockUser(args []string) error {
+	fs := flag.NewFlagSet("unlock-user", flag.ExitOnError)
+	username := fs.String("user", "", "用户名")
+	fs.Parse(args)
+
+	userID, err := lookupUser(*username)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Unlocked %s\n", *username)
+	return nil
+}
+
+// revokeSessions 撤销用户的所有会话，例如设备丢失且用户无法自行登录时
+func revokeSessions(args []string) error {
+	fs := flag.NewFlagSet("revoke-sessions", flag.ExitOnError)
+	username := fs.String("user", "", "用户名")
+	fs.Parse(args)
+
+	userID, err := lookupUser(*username)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := session.RevokeUser(userID, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Revoked %d sessions of %s\n", revoked, *username)
+	return nil
+}
+
+// rotateJWTKey 轮换JWT签名密钥，服务器重启后生效
+func rotateJWTKey(args []string) error {
+	cfg := config.Load()
+
+	fs := flag.NewFlagSet("rotate-jwt-key", flag.ExitOnError)
+	algorithm := fs.String("alg", cfg.JWTAlgorithm, "签名算法")
+	fs.Parse(args)
+
+	provider, err := cfg.NewKeyProvider()
+	if err != nil {
+		return err
+	}
+	keystore.Init(provider)
+
+	kid, err := keystore.RotateJWTKey(*algorithm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("New %s signing key %s is active; restart the server to start using it\n", *algorithm, kid)
+	if *algorithm != cfg.JWTAlgorithm {
+		fmt.Printf("Note: set GOPASS_JWT_ALG=%s, otherwise the server rotates back to %s on start\n", *algorithm, cfg.JWTAlgorithm)
+	}
+	return nil
+}
+
+// kmsServe 运行实现GoPass KMS协议的本地替身服务，根密钥保存在独立的密钥文件中
+func kmsServe(args []string) error {
+	fs := flag.NewFlagSet("kms-serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:9090", "监听地址")
+	keyFile := fs.String("key-file", "kms.key", "根密钥文件")
+	name := fs.String("name", "gopass", "密钥名称")
+	token := fs.String("token", os.Getenv("GOPASS_KMS_TOKEN"), "访问令牌")
+	fs.Parse(args)
+
+	rootKey, err := crypto.LoadOrCreateKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	handler := crypto.NewKMSHandler(map[string][]byte{*name: rootKey}, *token)
+	log.Printf("KMS stand-in serving key %q on %s", *name, *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+// oidcServe 运行OIDC身份提供者替身，登录时只需输入用户名，用于本地联调单点登录
+func oidcServe(args []string) error {
+	fs := flag.NewFlagSet("oidc-serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:9091", "监听地址")
+	clientID := fs.String("client-id", "gopass", "客户端ID")
+	clientSecret := fs.String("client-secret", os.Getenv("GOPASS_OIDC_CLIENT_SECRET"), "客户端密钥")
+	fs.Parse(args)
+
+	issuer := "http://" + *addr
+	provider, err := oidc.NewMockProvider(issuer, *clientID, *clientSecret)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("OIDC stand-in serving issuer %s for client %q", issuer, *clientID)
+	return http.ListenAndServe(*addr, provider)
+}
+
+// ldapServe 运行LDAP目录替身，用户由 -user 指定，用于本地联调目录登录
+func ldapServe(args []string) error {
+	fs := flag.NewFlagSet("ldap-serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:3389", "监听地址")
+	baseDN := fs.String("base-dn", "dc=example,dc=test", "基准DN")
+	bindDN := fs.String("bind-dn", "", "服务账户DN，设置后只有绑定的连接可以搜索")
+	bindPassword := fs.String("bind-password", os.Getenv("GOPASS_LDAP_BIND_PASSWORD"), "服务账户密码")
+	var users []string
+	fs.Func("user", "用户 uid:password[:mail]，可重复", func(value string) error {
+		users = append(users, value)
+		return nil
+	})
+	fs.Parse(args)
+
+	directory := authn.NewMockDirectory(*baseDN, nil)
+	if *bindDN != "" {
+		directory.AddServiceAccount(*bindDN, *bindPassword)
+	}
+	for _, user := range users {
+		parts := strings.SplitN(user, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid -user %q, expected uid:password[:mail]", user)
+		}
+		mail := parts[0] + "@example.test"
+		if len(parts) == 3 {
+			mail = parts[2]
+		}
+		log.Printf("Added %s", directory.AddUser(parts[0], parts[1], mail))
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("LDAP stand-in serving %s on ldap://%s", *baseDN, *addr)
+	return directory.Serve(listener)
+}
+
+// smtpServe 运行不支持TLS的SMTP替身，服务器需设置 GOPASS_SMTP_SECURITY=none，用于本地联调邮件
+func smtpServe(args []string) error {
+	fs := flag.NewFlagSet("smtp-serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:2525", "监听地址")
+	user := fs.String("user", "", "设置后要求客户端登录")
+	password := fs.String("password", os.Getenv("GOPASS_SMTP_PASSWORD"), "登录密码")
+	fs.Parse(args)
+
+	server := mailer.NewMockServer(nil)
+	if *user != "" {
+		server.RequireAuth(*user, *password)
+	}
+	server.OnReceive(printMail)
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("SMTP stand-in listening on %s", *addr)
+	return server.Serve(listener)
+}
+
+// printMail 解码并输出收到的邮件
+func printMail(msg mailer.Received) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg.Data))
+	if err != nil {
+		log.Printf("Received unparsable mail from %s: %v", msg.From, err)
+		return
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		subject = parsed.Header.Get("Subject")
+	}
+	var body io.Reader = parsed.Body
+	if strings.EqualFold(parsed.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	text, _ := io.ReadAll(body)
+
+	log.Printf("Mail from %s to %s\nSubject: %s\n\n%s", msg.From, strings.Join(msg.To, ", "), subject, text)
+}
+
+// lookupUser 根据用户名查找用户ID
+func lookupUser(username string) (int, error) {
+	if username == "" {
+		return 0, fmt.Errorf("-user is required")
+	}
+
+	var userID int
+	err := database.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("user %q not found: %v", username, err)
+	}
+	return userID, nil
+}
+
+// readSecret 从标准输入读取一行
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
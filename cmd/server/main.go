@@ -3,20 +3,115 @@ package main
 import (
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"gopass/internal/apitoken"
+	"gopass/internal/auth"
+	"gopass/internal/config"
 	"gopass/internal/database"
 	"gopass/internal/handlers"
+	"gopass/internal/keystore"
+	"gopass/internal/oidc"
+	"gopass/internal/vault"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	cfg := config.Load()
+
 	// 初始化数据库
-	if err := database.InitDB("gopass.db"); err != nil {
+	if err := database.InitDB(cfg.DBPath); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	defer database.CloseDB()
 
+	// 初始化服务器根密钥后端
+	provider, err := cfg.NewKeyProvider()
+	if err != nil {
+		log.Fatal("Failed to initialize key provider:", err)
+	}
+	keystore.Init(provider)
+
+	// 加载JWT签名密钥
+	if cfg.JWTSecret != "" {
+		if err := auth.SetJWTSecret(cfg.JWTSecret); err != nil {
+			log.Fatal("Invalid GOPASS_JWT_SECRET:", err)
+		}
+	} else {
+		active, others, err := keystore.LoadJWTKeys(cfg.JWTAlgorithm, auth.AccessTokenTTL)
+		if err != nil {
+			log.Fatal("Failed to load JWT signing keys:", err)
+		}
+		auth.SetSigningKeys(active, others...)
+		log.Printf("Signing tokens with %s key %s", active.Algorithm, active.ID)
+	}
+
+	// 配置单点登录
+	if cfg.OIDCIssuer != "" {
+		if cfg.OIDCClientID == "" {
+			log.Fatal("GOPASS_OIDC_CLIENT_ID is required when GOPASS_OIDC_ISSUER is set")
+		}
+		handlers.SetOIDCProvider(oidc.New(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+		}))
+		log.Printf("Single sign-on enabled with issuer %s", cfg.OIDCIssuer)
+	}
+
+	// 配置LDAP目录验证
+	if cfg.LDAPURL != "" {
+		ldapAuthenticator, err := cfg.NewLDAPAuthenticator()
+		if err != nil {
+			log.Fatal("Invalid LDAP configuration:", err)
+		}
+		handlers.SetDirectory(ldapAuthenticator)
+		log.Printf("Directory sign-in enabled with %s, self-registration is disabled", cfg.LDAPURL)
+	}
+
+	// 配置安全密钥
+	handlers.SetRelyingParty(cfg.NewRelyingParty())
+
+	// 配置保险库闲置锁定
+	idleTimeout, err := cfg.VaultIdle()
+	if err != nil {
+		log.Fatal("Invalid GOPASS_VAULT_IDLE_TIMEOUT:", err)
+	}
+	handlers.SetVaultIdleTimeout(idleTimeout)
+	go vault.SweepEvery(time.Minute)
+
+	// 配置邮件发送
+	sender, err := cfg.NewMailer()
+	if err != nil {
+		log.Fatal("Invalid mailer configuration:", err)
+	}
+	handlers.SetMailer(sender, cfg.BaseURL)
+	log.Printf("Sending mail with the %s mailer", cfg.Mailer)
+
+	// 配置附件存储
+	primaryStore, otherStores, err := cfg.NewAttachmentStores()
+	if err != nil {
+		log.Fatal("Invalid attachment storage:", err)
+	}
+	quota, err := cfg.AttachmentQuota()
+	if err != nil {
+		log.Fatal("Invalid GOPASS_ATTACHMENT_QUOTA_MB:", err)
+	}
+	handlers.SetAttachmentStorage(primaryStore, otherStores...)
+	handlers.SetAttachmentQuota(quota)
+	log.Printf("Storing attachments with the %s backend", primaryStore.Name())
+
+	// 配置历史密码保留数量
+	historyLimit, err := cfg.PasswordHistoryLimit()
+	if err != nil {
+		log.Fatal("Invalid GOPASS_PASSWORD_HISTORY:", err)
+	}
+	handlers.SetPasswordHistoryLimit(historyLimit)
+
 	// 创建路由器
 	r := gin.Default()
 
@@ -40,39 +135,119 @@ func main() {
 		})
 	})
 
+	// 令牌验证公钥，供其他服务验证 EdDSA/ES256 令牌
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// API路由
 	api := r.Group("/api")
 	{
 		// 公开路由
 		api.POST("/register", handlers.Register)
 		api.POST("/login", handlers.Login)
+		api.POST("/login/mfa", handlers.LoginMFA)
+		api.POST("/login/webauthn", handlers.LoginWebAuthn)
+		api.POST("/recover", handlers.RecoverAccount)
+		api.POST("/password-reset", handlers.RequestPasswordReset)
+		api.POST("/password-reset/confirm", handlers.ConfirmPasswordReset)
+		api.POST("/email/verify", handlers.VerifyEmail)
+		api.POST("/refresh", handlers.RefreshToken)
 
-		// 需要认证的路由
-		auth := api.Group("/")
-		auth.Use(handlers.AuthMiddleware())
+		// 单点登录
+		api.GET("/sso", handlers.GetSSOStatus)
+		api.GET("/sso/login", handlers.SSOLogin)
+		api.GET("/sso/callback", handlers.SSOCallback)
+		api.POST("/sso/unlock", handlers.SSOUnlock)
+
+		// 登录会话和个人访问令牌均可访问的路由，令牌需具备相应权限
+		scoped := api.Group("/")
+		scoped.Use(handlers.AuthMiddleware())
 		{
 			// 密码管理
-			auth.POST("/passwords", handlers.CreatePassword)
-			auth.GET("/passwords", handlers.GetPasswords)
-			auth.GET("/passwords/:id", handlers.GetPassword)
-			auth.PUT("/passwords/:id", handlers.UpdatePassword)
-			auth.DELETE("/passwords/:id", handlers.DeletePassword)
+			scoped.POST("/passwords", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.CreatePassword)
+			scoped.GET("/passwords", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.GetPasswords)
+			scoped.GET("/passwords/:id", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.GetPassword)
+			scoped.GET("/passwords/:id/totp", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.GetPasswordTOTP)
+			scoped.PUT("/passwords/:id", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.UpdatePassword)
+			scoped.DELETE("/passwords/:id", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.DeletePassword)
+
+			// 历史密码
+			scoped.GET("/passwords/:id/history", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.GetPasswordHistory)
+			scoped.POST("/passwords/:id/history/:historyId/restore", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.RestorePasswordHistory)
+
+			// 条目附件
+			scoped.GET("/passwords/:id/attachments", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.GetAttachments)
+			scoped.POST("/passwords/:id/attachments", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.UploadAttachment)
+			scoped.GET("/passwords/:id/attachments/:attachmentId", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.DownloadAttachment)
+			scoped.DELETE("/passwords/:id/attachments/:attachmentId", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.DeleteAttachment)
 
 			// 密码生成
-			auth.POST("/generate-password", handlers.GeneratePassword)
+			scoped.POST("/generate-password", handlers.GeneratePassword)
+
+			// 分类查询
+			scoped.GET("/categories", handlers.RequireScope(apitoken.ScopePasswordsRead), handlers.GetCategories)
+
+			// 数据导入导出
+			scoped.GET("/export", handlers.RequireScope(apitoken.ScopeExport), handlers.ExportData)
+			scoped.POST("/import", handlers.RequireScope(apitoken.ScopePasswordsWrite), handlers.ImportData)
+		}
 
+		// 仅登录会话可访问的路由
+		auth := api.Group("/")
+		auth.Use(handlers.AuthMiddleware(), handlers.SessionRequired())
+		{
 			// 分类管理
-			auth.GET("/categories", handlers.GetCategories)
 			auth.POST("/categories", handlers.CreateCategory)
 
-			// 数据导入导出
-			auth.GET("/export", handlers.ExportData)
-			auth.POST("/import", handlers.ImportData)
+			// 保险库锁定和密钥管理
+			auth.POST("/unlock", handlers.UnlockVault)
+			auth.POST("/lock", handlers.LockVault)
+			auth.GET("/vault/status", handlers.GetVaultStatus)
+			auth.POST("/vault/rotate", handlers.RotateVaultKey)
+
+			// 会话管理
+			auth.POST("/logout", handlers.Logout)
+			auth.GET("/sessions", handlers.GetSessions)
+			auth.DELETE("/sessions", handlers.RevokeOtherSessions)
+			auth.DELETE("/sessions/:id", handlers.RevokeSession)
+
+			// 两步验证
+			auth.GET("/mfa", handlers.GetMFAStatus)
+			auth.POST("/mfa/totp/setup", handlers.SetupTOTP)
+			auth.POST("/mfa/totp/enable", handlers.EnableTOTP)
+			auth.POST("/mfa/totp/disable", handlers.DisableTOTP)
+			auth.POST("/mfa/backup-codes", handlers.RegenerateBackupCodes)
+			auth.GET("/mfa/webauthn", handlers.GetSecurityKeys)
+			auth.POST("/mfa/webauthn/register/begin", handlers.BeginSecurityKeyRegistration)
+			auth.POST("/mfa/webauthn/register/finish", handlers.FinishSecurityKeyRegistration)
+			auth.DELETE("/mfa/webauthn/:id", handlers.DeleteSecurityKey)
+
+			// 账户管理
+			auth.POST("/account/recovery-key", handlers.RegenerateRecoveryKey)
+			auth.PUT("/account/password", handlers.ChangePassword)
+			auth.PUT("/account/email", handlers.ChangeEmail)
+			auth.POST("/account/email/verification", handlers.ResendVerificationEmail)
+			auth.GET("/account/export", handlers.ExportArchive)
+			auth.DELETE("/account", handlers.DeleteAccount)
+
+			// 个人访问令牌
+			auth.GET("/tokens", handlers.GetAPITokens)
+			auth.POST("/tokens", handlers.CreateAPIToken)
+			auth.DELETE("/tokens/:id", handlers.RevokeAPIToken)
+
+			// 紧急访问
+			auth.PUT("/emergency", handlers.SetupEmergencyAccess)
+			auth.GET("/emergency", handlers.GetEmergencyAccess)
+			auth.DELETE("/emergency", handlers.DeleteEmergencyAccess)
+			auth.GET("/emergency/trusted", handlers.GetTrustedOwners)
+			auth.POST("/emergency/requests", handlers.CreateEmergencyRequest)
+			auth.POST("/emergency/requests/:id/approve", handlers.ApproveEmergencyRequest)
+			auth.POST("/emergency/requests/:id/deny", handlers.DenyEmergencyRequest)
+			auth.GET("/emergency/requests/:id/vault", handlers.GetEmergencyVault)
 		}
 	}
 
-	log.Println("Server starting on :8080")
-	if err := r.Run(":8080"); err != nil {
+	log.Println("Server starting on " + cfg.Addr)
+	if err := r.Run(cfg.Addr); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
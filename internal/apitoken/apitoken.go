@@ -0,0 +1,283 @@
+package apitoken
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 个人访问令牌供脚本和CI使用，格式为 "gpat_<令牌ID>.<随机串>"，只在创建时显示一次。
+// 数据库中保存令牌的SHA-256哈希，以及用随机串派生的KEK包装的保险库密钥副本，
+// 因此令牌无需主密码即可解密条目；保险库密钥轮换后旧令牌全部作废。
+
+// Prefix 令牌前缀，便于区分JWT和识别泄露的令牌
+const Prefix = "gpat_"
+
+// 令牌权限范围
+const (
+	// ScopePasswordsRead 读取密码条目和分类
+	ScopePasswordsRead = "passwords:read"
+	// ScopePasswordsWrite 创建、修改、删除和导入密码条目
+	ScopePasswordsWrite = "passwords:write"
+	// ScopeExport 导出密码条目
+	ScopeExport = "export"
+)
+
+// Scopes 所有可用的权限范围
+var Scopes = []string{ScopePasswordsRead, ScopePasswordsWrite, ScopeExport}
+
+var (
+	// ErrTokenInvalid 令牌不存在、已过期或已被撤销
+	ErrTokenInvalid = errors.New("api token is invalid")
+	// ErrNotFound 令牌不存在或不属于该用户
+	ErrNotFound = errors.New("api token not found")
+)
+
+// Token 个人访问令牌
+type Token struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Categories []string   `json:"categories"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope 检查令牌是否具有指定权限
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsCategory 检查令牌能否访问该分类的条目，未限制分类时允许全部
+func (t *Token) AllowsCategory(category string) bool {
+	if len(t.Categories) == 0 {
+		return true
+	}
+	for _, c := range t.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope 检查权限范围名称是否有效
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Create 创建令牌，返回只显示一次的令牌字符串
+func Create(userID int, vaultKey []byte, name string, scopes, categories []string, expiresAt *time.Time) (string, *Token, error) {
+	id, err := auth.NewSessionID()
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := crypto.RandomBytes(32)
+	if err != nil {
+		return "", nil, err
+	}
+	defer crypto.Wipe(secret)
+
+	kek, err := deriveKEK(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	defer crypto.Wipe(kek)
+
+	wrapped, err := crypto.WrapKey(kek, vaultKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := Prefix + id + "." + base64.RawURLEncoding.EncodeToString(secret)
+	t := &Token{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		Scopes:     scopes,
+		Categories: categories,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO api_tokens (id, user_id, name, token_hash, vault_key, scopes, categories, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, userID, name, hashToken(token), wrapped, encodeList(scopes), encodeList(categories), expiresAt, t.CreatedAt,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+// Authenticate 校验令牌并记录使用时间，返回令牌信息和解开的保险库密钥
+func Authenticate(token string) (*Token, []byte, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(token, Prefix), ".")
+	if !ok || !strings.HasPrefix(token, Prefix) || id == "" {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	var t Token
+	var tokenHash, wrapped, scopes, categories string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT id, user_id, name, token_hash, vault_key, scopes, categories, expires_at, created_at, last_used_at
+		FROM api_tokens WHERE id = ?`, id,
+	).Scan(&t.ID, &t.UserID, &t.Name, &tokenHash, &wrapped, &scopes, &categories, &expiresAt, &t.CreatedAt, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(tokenHash)) != 1 {
+		return nil, nil, ErrTokenInvalid
+	}
+	if expiresAt.Valid && time.Now().After(expiresAt.Time) {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, ErrTokenInvalid
+	}
+	defer crypto.Wipe(secret)
+
+	kek, err := deriveKEK(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(kek)
+
+	vaultKey, err := crypto.UnwrapKey(kek, wrapped)
+	if err != nil {
+		return nil, nil, ErrTokenInvalid
+	}
+
+	now := time.Now().UTC()
+	if _, err := database.DB.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, t.ID); err != nil {
+		crypto.Wipe(vaultKey)
+		return nil, nil, err
+	}
+
+	t.Scopes = decodeList(scopes)
+	t.Categories = decodeList(categories)
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	t.LastUsedAt = &now
+	return &t, vaultKey, nil
+}
+
+// List 列出用户的所有令牌，不含令牌本身
+func List(userID int) ([]Token, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, name, scopes, categories, expires_at, created_at, last_used_at
+		FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		var t Token
+		var scopes, categories string
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &categories, &expiresAt, &t.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		t.UserID = userID
+		t.Scopes = decodeList(scopes)
+		t.Categories = decodeList(categories)
+		if expiresAt.Valid {
+			t.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			t.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke 删除用户的指定令牌
+func Revoke(userID int, id string) error {
+	result, err := database.DB.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUser 删除用户的所有令牌，返回删除的数量
+func RevokeUser(userID int) (int, error) {
+	result, err := database.DB.Exec("DELETE FROM api_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	deleted, _ := result.RowsAffected()
+	return int(deleted), nil
+}
+
+// deriveKEK 从令牌随机串派生包装保险库密钥的KEK，随机串熵足够高，使用HKDF即可
+func deriveKEK(secret []byte) ([]byte, error) {
+	kek := make([]byte, crypto.KeySize)
+	reader := hkdf.New(sha256.New, secret, nil, []byte("gopass api token"))
+	if _, err := io.ReadFull(reader, kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
+
+// hashToken 计算令牌的哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeList 将权限范围或分类列表编码为JSON数组，分类名称中可能含有逗号
+func encodeList(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+	encoded, _ := json.Marshal(list)
+	return string(encoded)
+}
+
+// decodeList 解析JSON数组
+func decodeList(s string) []string {
+	list := []string{}
+	json.Unmarshal([]byte(s), &list)
+	return list
+}
@@ -0,0 +1,160 @@
+package apitoken
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// testDB 初始化临时的 SQLite 数据库
+func testDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+}
+
+// createUser 创建测试用户，返回用户ID和保险库密钥
+func createUser(t *testing.T, username string) (int, []byte) {
+	t.Helper()
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password_hash, email) VALUES (?, '', ?)", username, username+"@example.test",
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	key, err := crypto.GenerateRandomKey()
+	if err != nil {
+		t.Fatalf("Failed to generate vault key: %v", err)
+	}
+	return int(id), key
+}
+
+func TestCreateAuthenticate(t *testing.T) {
+	testDB(t)
+	userID, vaultKey := createUser(t, "alice")
+
+	token, created, err := Create(userID, vaultKey, "ci", []string{ScopePasswordsRead}, []string{"Work, Team"}, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(token, Prefix+created.ID+".") {
+		t.Errorf("Token should have the form %s<id>.<secret>, got %q", Prefix, token)
+	}
+
+	authenticated, key, err := Authenticate(token)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if authenticated.ID != created.ID || authenticated.UserID != userID || authenticated.Name != "ci" {
+		t.Errorf("Authenticate returned the wrong token: %+v", authenticated)
+	}
+	if !bytes.Equal(key, vaultKey) {
+		t.Error("Unwrapped vault key should match the original")
+	}
+	if len(authenticated.Categories) != 1 || authenticated.Categories[0] != "Work, Team" {
+		t.Errorf("Categories should round-trip, got %v", authenticated.Categories)
+	}
+	if authenticated.LastUsedAt == nil {
+		t.Error("Authenticate should record the last use")
+	}
+}
+
+func TestAuthenticateRejectsInvalidToken(t *testing.T) {
+	testDB(t)
+	userID, vaultKey := createUser(t, "alice")
+	token, created, _ := Create(userID, vaultKey, "ci", []string{ScopePasswordsRead}, nil, nil)
+	_, otherToken, _ := strings.Cut(token, ".")
+
+	invalid := []string{
+		"",
+		created.ID + "." + otherToken,          // 缺少前缀
+		Prefix + created.ID,                    // 缺少随机串
+		Prefix + "unknown." + otherToken,       // 令牌ID不存在
+		Prefix + created.ID + ".AAAAAAAAAAAAA", // 随机串错误
+		token[:len(token)-1] + string(token[len(token)-1]^1), // 随机串被篡改
+	}
+	for _, candidate := range invalid {
+		if _, _, err := Authenticate(candidate); err != ErrTokenInvalid {
+			t.Errorf("Authenticate(%q) should fail with ErrTokenInvalid, got %v", candidate, err)
+		}
+	}
+}
+
+func TestAuthenticateExpiry(t *testing.T) {
+	testDB(t)
+	userID, vaultKey := createUser(t, "alice")
+
+	past := time.Now().Add(-time.Minute).UTC()
+	expired, _, _ := Create(userID, vaultKey, "expired", []string{ScopePasswordsRead}, nil, &past)
+	if _, _, err := Authenticate(expired); err != ErrTokenInvalid {
+		t.Errorf("Expired token should be rejected, got %v", err)
+	}
+
+	future := time.Now().Add(time.Hour).UTC()
+	valid, _, _ := Create(userID, vaultKey, "valid", []string{ScopePasswordsRead}, nil, &future)
+	authenticated, _, err := Authenticate(valid)
+	if err != nil {
+		t.Fatalf("Token before expiry should authenticate: %v", err)
+	}
+	if authenticated.ExpiresAt == nil || !authenticated.ExpiresAt.Equal(future) {
+		t.Errorf("ExpiresAt should be %v, got %v", future, authenticated.ExpiresAt)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	testDB(t)
+	userID, vaultKey := createUser(t, "alice")
+	otherID, otherKey := createUser(t, "bob")
+	token, created, _ := Create(userID, vaultKey, "ci", []string{ScopePasswordsRead}, nil, nil)
+	otherToken, _, _ := Create(otherID, otherKey, "ci", []string{ScopePasswordsRead}, nil, nil)
+
+	if err := Revoke(otherID, created.ID); err != ErrNotFound {
+		t.Errorf("Revoking another user's token should fail with ErrNotFound, got %v", err)
+	}
+	if err := Revoke(userID, created.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, _, err := Authenticate(token); err != ErrTokenInvalid {
+		t.Errorf("Revoked token should be rejected, got %v", err)
+	}
+
+	if revoked, err := RevokeUser(otherID); err != nil || revoked != 1 {
+		t.Errorf("RevokeUser should revoke 1 token, got %d: %v", revoked, err)
+	}
+	if _, _, err := Authenticate(otherToken); err != ErrTokenInvalid {
+		t.Errorf("Token revoked with RevokeUser should be rejected, got %v", err)
+	}
+}
+
+func TestHasScopeAllowsCategory(t *testing.T) {
+	token := &Token{Scopes: []string{ScopePasswordsRead, ScopeExport}}
+	if !token.HasScope(ScopePasswordsRead) || !token.HasScope(ScopeExport) {
+		t.Error("Token should have its granted scopes")
+	}
+	if token.HasScope(ScopePasswordsWrite) {
+		t.Error("Token should not have scopes it was not granted")
+	}
+	if !token.AllowsCategory("Work") || !token.AllowsCategory("") {
+		t.Error("Token without categories should allow every category")
+	}
+
+	token.Categories = []string{"Work"}
+	if !token.AllowsCategory("Work") {
+		t.Error("Token should allow its categories")
+	}
+	if token.AllowsCategory("Personal") || token.AllowsCategory("") {
+		t.Error("Token should not allow other categories")
+	}
+
+	if !ValidScope(ScopePasswordsWrite) || ValidScope("admin") {
+		t.Error("ValidScope should only accept known scopes")
+	}
+}
@@ -0,0 +1,54 @@
+package attachment
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopass/internal/crypto"
+)
+
+// 附件密文的存储后端。后端只保存已加密的数据，不接触文件密钥和文件名
+
+// 存储后端名称，记录在 attachments.storage
+const (
+	StorageDB  = "db"
+	StorageDir = "dir"
+)
+
+var (
+	// ErrNotFound 附件不存在
+	ErrNotFound = errors.New("attachment not found")
+	// errInvalidID 附件ID格式不正确，避免拼接出任意路径
+	errInvalidID = errors.New("invalid attachment id")
+)
+
+// Store 附件密文的存储后端
+type Store interface {
+	// Name 返回后端名称
+	Name() string
+	// Put 从 r 读取并保存附件，返回写入的字节数。r 返回错误时不保留已写入的部分
+	Put(id string, r io.Reader) (int64, error)
+	// Open 打开附件，不存在时返回 ErrNotFound
+	Open(id string) (io.ReadCloser, error)
+	// Delete 删除附件，不存在时不报错
+	Delete(id string) error
+}
+
+// NewID 生成随机的附件ID
+func NewID() (string, error) {
+	raw, err := crypto.RandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// validateID 检查附件ID是否由 NewID 生成
+func validateID(id string) error {
+	if raw, err := hex.DecodeString(id); err != nil || len(raw) != 16 {
+		return fmt.Errorf("%w: %q", errInvalidID, id)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// testStores 返回两种存储后端，数据库后端使用临时的 SQLite 数据库
+func testStores(t *testing.T) []Store {
+	dir := t.TempDir()
+	if err := database.InitDB(filepath.Join(dir, "test.db")); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+
+	return []Store{NewDB(), NewDir(filepath.Join(dir, "attachments"))}
+}
+
+// errReader 读出 n 个字节后返回错误，模拟超出配额或中断的上传
+type errReader struct {
+	n int
+}
+
+var errUpload = errors.New("upload interrupted")
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errUpload
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for _, store := range testStores(t) {
+		t.Run(store.Name(), func(t *testing.T) {
+			for _, size := range []int{0, 10, blobSize, 2*blobSize + 7} {
+				id, _ := NewID()
+				data, _ := crypto.RandomBytes(size)
+
+				written, err := store.Put(id, bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("Failed to put %d bytes: %v", size, err)
+				}
+				if written != int64(size) {
+					t.Errorf("Written should be %d, got %d", size, written)
+				}
+
+				r, err := store.Open(id)
+				if err != nil {
+					t.Fatalf("Failed to open: %v", err)
+				}
+				read, err := io.ReadAll(r)
+				r.Close()
+				if err != nil || !bytes.Equal(read, data) {
+					t.Errorf("Read %d bytes back incorrectly: %v", size, err)
+				}
+
+				if err := store.Delete(id); err != nil {
+					t.Fatalf("Failed to delete: %v", err)
+				}
+				if _, err := store.Open(id); err != ErrNotFound {
+					t.Errorf("Expected ErrNotFound after delete, got %v", err)
+				}
+				if err := store.Delete(id); err != nil {
+					t.Errorf("Deleting twice should not fail: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreFailedPut(t *testing.T) {
+	for _, store := range testStores(t) {
+		t.Run(store.Name(), func(t *testing.T) {
+			id, _ := NewID()
+			if _, err := store.Put(id, &errReader{n: blobSize + 10}); !errors.Is(err, errUpload) {
+				t.Fatalf("Expected upload error, got %v", err)
+			}
+			if _, err := store.Open(id); err != ErrNotFound {
+				t.Errorf("Partial upload should not be kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsInvalidID(t *testing.T) {
+	for _, store := range testStores(t) {
+		for _, id := range []string{"", "../../etc/passwd", "zz" + "00112233445566778899aabbccddee"} {
+			if _, err := store.Put(id, bytes.NewReader(nil)); !errors.Is(err, errInvalidID) {
+				t.Errorf("%s: Put(%q) should be rejected, got %v", store.Name(), id, err)
+			}
+			if _, err := store.Open(id); !errors.Is(err, errInvalidID) {
+				t.Errorf("%s: Open(%q) should be rejected, got %v", store.Name(), id, err)
+			}
+		}
+	}
+}
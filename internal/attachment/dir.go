@@ -0,0 +1,92 @@
+package attachment
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir 把附件保存为本地目录中的文件，适合附件较多、不希望数据库文件过大的部署。
+// 文件按ID的前两个字符分到子目录中，写入时先写临时文件再改名，不会留下不完整的附件
+type Dir struct {
+	root string
+}
+
+// NewDir 创建保存在 root 目录的存储后端，目录在第一次写入时创建
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// Name 返回后端名称
+func (d *Dir) Name() string {
+	return StorageDir
+}
+
+// path 返回附件的文件路径
+func (d *Dir) path(id string) (string, error) {
+	if err := validateID(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.root, id[:2], id), nil
+}
+
+// Put 写入附件文件
+func (d *Dir) Put(id string, r io.Reader) (int64, error) {
+	path, err := d.path(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return written, nil
+}
+
+// Open 打开附件文件
+func (d *Dir) Open(id string) (io.ReadCloser, error) {
+	path, err := d.path(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete 删除附件文件
+func (d *Dir) Delete(id string) error {
+	path, err := d.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
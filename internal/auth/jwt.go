@@ -1,41 +1,77 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("your-secret-key-change-this-in-production")
+const (
+	// AccessTokenTTL 访问令牌有效期，过期后用刷新令牌换取新令牌
+	AccessTokenTTL = 15 * time.Minute
+	// SessionTTL 会话的最长有效期，刷新令牌和内存中的保险库密钥都不会超过它
+	SessionTTL = 24 * time.Hour
+)
 
 // Claims JWT声明
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
+// NewSessionID 生成随机会话ID
+func NewSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // GenerateToken 生成JWT令牌
-func GenerateToken(userID int, username string) (string, error) {
+func GenerateToken(userID int, username, sessionID string) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	key := currentKey()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signKey)
 }
 
 // ValidateToken 验证JWT令牌
 func ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
+		kid, _ := token.Header["kid"].(string)
+		key, ok := lookupKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// 只接受与密钥匹配的算法，防止算法混淆
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.verifyKey, nil
 	})
 
 	if err != nil {
@@ -49,7 +85,12 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	return nil, errors.New("invalid token")
 }
 
-// SetJWTSecret 设置JWT密钥
-func SetJWTSecret(secret string) {
-	jwtSecret = []byte(secret)
+// SetJWTSecret 使用固定的HS256密钥签发和验证令牌（不带kid）
+func SetJWTSecret(secret string) error {
+	key, err := NewSigningKey("", AlgHS256, []byte(secret))
+	if err != nil {
+		return err
+	}
+	SetSigningKeys(key)
+	return nil
 }
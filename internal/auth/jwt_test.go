@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testSigningKey(t *testing.T, id, algorithm string) *SigningKey {
+	t.Helper()
+
+	key, err := NewSigningKey(id, algorithm, bytes.Repeat([]byte{byte(len(id))}, 32))
+	if err != nil {
+		t.Fatalf("Failed to create %s key: %v", algorithm, err)
+	}
+	return key
+}
+
+func TestGenerateValidateToken(t *testing.T) {
+	for _, algorithm := range []string{AlgHS256, AlgEdDSA, AlgES256} {
+		SetSigningKeys(testSigningKey(t, "key-"+algorithm, algorithm))
+
+		token, err := GenerateToken(1, "alice", "session")
+		if err != nil {
+			t.Fatalf("%s: failed to generate token: %v", algorithm, err)
+		}
+
+		claims, err := ValidateToken(token)
+		if err != nil {
+			t.Fatalf("%s: failed to validate token: %v", algorithm, err)
+		}
+
+		if claims.UserID != 1 || claims.Username != "alice" || claims.SessionID != "session" {
+			t.Errorf("%s: unexpected claims %+v", algorithm, claims)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := testSigningKey(t, "old", AlgHS256)
+	SetSigningKeys(oldKey)
+
+	token, err := GenerateToken(1, "alice", "session")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// 旧密钥保留用于验证时，旧令牌仍然有效
+	SetSigningKeys(testSigningKey(t, "new", AlgEdDSA), oldKey)
+	if _, err := ValidateToken(token); err != nil {
+		t.Errorf("Token signed with retired key should still validate: %v", err)
+	}
+
+	// 旧密钥移除后，旧令牌失效
+	SetSigningKeys(testSigningKey(t, "new", AlgEdDSA))
+	if _, err := ValidateToken(token); err == nil {
+		t.Error("Token signed with removed key should not validate")
+	}
+}
+
+func TestPublicJWKS(t *testing.T) {
+	SetSigningKeys(testSigningKey(t, "ed", AlgEdDSA), testSigningKey(t, "ec", AlgES256), testSigningKey(t, "hs", AlgHS256))
+
+	keys := PublicJWKS()
+	if len(keys) != 2 {
+		t.Fatalf("JWKS should contain only the 2 asymmetric keys, got %d", len(keys))
+	}
+
+	for _, key := range keys {
+		if key.KeyID == "hs" {
+			t.Error("HS256 secret must not be published")
+		}
+	}
+}
+
+func TestNoSigningKey(t *testing.T) {
+	SetSigningKeys(nil)
+
+	if _, err := GenerateToken(1, "alice", "session"); err != ErrNoSigningKey {
+		t.Errorf("Expected ErrNoSigningKey, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+)
+
+// ErrNoSigningKey 尚未配置签名密钥
+var ErrNoSigningKey = errors.New("no JWT signing key configured")
+
+// SigningKey JWT签名密钥，kid 写入令牌头部用于选择验证密钥
+type SigningKey struct {
+	ID        string
+	Algorithm string
+
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+var (
+	keysMu     sync.RWMutex
+	activeKey  *SigningKey
+	verifyKeys = make(map[string]*SigningKey)
+)
+
+// NewSigningKey 由32字节密钥材料创建签名密钥：
+// HS256 直接作为HMAC密钥，EdDSA 作为Ed25519种子，ES256 作为P-256私钥标量
+func NewSigningKey(id, algorithm string, material []byte) (*SigningKey, error) {
+	key := &SigningKey{ID: id, Algorithm: algorithm}
+
+	switch algorithm {
+	case AlgHS256:
+		if len(material) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		secret := append([]byte(nil), material...)
+		key.method = jwt.SigningMethodHS256
+		key.signKey = secret
+		key.verifyKey = secret
+	case AlgEdDSA:
+		if len(material) != ed25519.SeedSize {
+			return nil, errors.New("EdDSA seed must be 32 bytes")
+		}
+		private := ed25519.NewKeyFromSeed(material)
+		key.method = jwt.SigningMethodEdDSA
+		key.signKey = private
+		key.verifyKey = private.Public()
+	case AlgES256:
+		// 借助ecdh校验标量是否在曲线阶范围内
+		if _, err := ecdh.P256().NewPrivateKey(material); err != nil {
+			return nil, fmt.Errorf("invalid ES256 private key: %v", err)
+		}
+		curve := elliptic.P256()
+		private := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(material)}
+		private.Curve = curve
+		private.X, private.Y = curve.ScalarBaseMult(material)
+		key.method = jwt.SigningMethodES256
+		key.signKey = private
+		key.verifyKey = &private.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", algorithm)
+	}
+
+	return key, nil
+}
+
+// SetSigningKeys 设置用于签发的当前密钥，以及轮换期间仍可验证的其他密钥
+func SetSigningKeys(active *SigningKey, others ...*SigningKey) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	activeKey = active
+	verifyKeys = make(map[string]*SigningKey)
+	for _, key := range append(others, active) {
+		if key != nil {
+			verifyKeys[key.ID] = key
+		}
+	}
+}
+
+// lookupKey 按 kid 查找验证密钥
+func lookupKey(id string) (*SigningKey, bool) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	key, ok := verifyKeys[id]
+	return key, ok
+}
+
+// currentKey 返回当前签发密钥
+func currentKey() *SigningKey {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	return activeKey
+}
+
+// JWK JSON Web Key（仅公钥）
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// PublicJWKS 返回所有非对称验证密钥的公钥集合，HS256 密钥不会公开
+func PublicJWKS() []JWK {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	keys := []JWK{}
+	for _, key := range verifyKeys {
+		switch public := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "OKP",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+			})
+		case *ecdsa.PublicKey:
+			keys = append(keys, JWK{
+				KeyType:   "EC",
+				Curve:     "P-256",
+				X:         base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+				Y:         base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+			})
+		}
+	}
+	return keys
+}
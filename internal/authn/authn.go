@@ -0,0 +1,85 @@
+package authn
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// 登录时用户名和密码的验证方式。每个账户记录自己的来源（users.auth_source），
+// 登录时交给对应来源的 Authenticator 验证；目录中新出现的用户首次登录时自动创建本地账户。
+
+const (
+	// SourceLocal 密码哈希保存在本地 users 表中的账户
+	SourceLocal = "local"
+	// SourceLDAP 由LDAP目录验证密码的账户
+	SourceLDAP = "ldap"
+)
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnavailable 验证后端无法访问，与密码错误区分，不计入登录失败次数
+	ErrUnavailable = errors.New("authentication backend unavailable")
+)
+
+// Identity 验证通过的用户身份
+type Identity struct {
+	Username string
+	Email    string
+}
+
+// Authenticator 验证用户名和密码
+type Authenticator interface {
+	// Source 返回账户来源，保存在 users.auth_source 中
+	Source() string
+	// Authenticate 验证密码，用户不存在或密码错误时返回 ErrInvalidCredentials
+	Authenticate(username, password string) (*Identity, error)
+}
+
+// Local 使用 users 表中bcrypt哈希验证的本地账户
+type Local struct{}
+
+// Source 返回 SourceLocal
+func (Local) Source() string {
+	return SourceLocal
+}
+
+// Authenticate 比对本地保存的密码哈希
+func (Local) Authenticate(username, password string) (*Identity, error) {
+	var identity Identity
+	var passwordHash string
+	err := database.DB.QueryRow(
+		"SELECT username, email, password_hash FROM users WHERE username = ? AND auth_source = ?",
+		username, SourceLocal,
+	).Scan(&identity.Username, &identity.Email, &passwordHash)
+	if err == sql.ErrNoRows {
+		// 用户不存在时同样执行bcrypt，避免通过响应时间判断用户名是否存在
+		dummyPasswordCheck(password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !crypto.CheckPasswordHash(password, passwordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	return &identity, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordCheck 执行一次与真实验证耗时相同的bcrypt比较
+func dummyPasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = crypto.HashPassword("gopass-dummy-password")
+	})
+	crypto.CheckPasswordHash(password, dummyHash)
+}
@@ -0,0 +1,176 @@
+package authn
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// UsernamePlaceholder 用户过滤器中替换为（已转义的）用户名的占位符
+const UsernamePlaceholder = "{username}"
+
+// LDAPConfig LDAP目录配置
+type LDAPConfig struct {
+	// URL 目录地址，ldap:// 或 ldaps://
+	URL string
+	// BindDN 和 BindPassword 用于查找用户的服务账户，为空时匿名查找
+	BindDN       string
+	BindPassword string
+	// BaseDN 在其下按 UserFilter 查找用户
+	BaseDN string
+	// UserFilter 例如 (&(objectClass=inetOrgPerson)(uid={username}))
+	UserFilter string
+	// UsernameAttribute 和 EmailAttribute 为创建本地账户时读取的属性
+	UsernameAttribute string
+	EmailAttribute    string
+	// StartTLS 在 ldap:// 连接上升级为TLS
+	StartTLS bool
+	// TLSConfig ldaps:// 和 StartTLS 使用的TLS配置，为nil时使用系统根证书
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// LDAP 先用服务账户查找用户条目，再以该条目的DN和用户输入的密码绑定来验证密码
+type LDAP struct {
+	config LDAPConfig
+}
+
+// NewLDAP 检查配置并创建LDAP验证器
+func NewLDAP(config LDAPConfig) (*LDAP, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("invalid ldap url %q", config.URL)
+	}
+	if u.Scheme == "ldaps" && config.StartTLS {
+		return nil, errors.New("StartTLS cannot be used with ldaps://")
+	}
+	if config.BaseDN == "" {
+		return nil, errors.New("ldap base DN is required")
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=" + UsernamePlaceholder + ")"
+	}
+	if !strings.Contains(config.UserFilter, UsernamePlaceholder) {
+		return nil, fmt.Errorf("ldap user filter must contain %s", UsernamePlaceholder)
+	}
+	if config.UsernameAttribute == "" {
+		config.UsernameAttribute = "uid"
+	}
+	if config.EmailAttribute == "" {
+		config.EmailAttribute = "mail"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	// 证书校验需要服务器名，StartTLS 时 go-ldap 不会自动填写
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	config.TLSConfig = tlsConfig
+
+	return &LDAP{config: config}, nil
+}
+
+// Source 返回 SourceLDAP
+func (l *LDAP) Source() string {
+	return SourceLDAP
+}
+
+// Authenticate 查找用户条目并以其DN绑定验证密码
+func (l *LDAP) Authenticate(username, password string) (*Identity, error) {
+	// 空密码的简单绑定在LDAP中是匿名绑定，总会成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.config.BindDN != "" {
+		if err := conn.Bind(l.config.BindDN, l.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service account bind failed: %v", ErrUnavailable, err)
+		}
+	}
+
+	entry, err := l.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	identity := &Identity{
+		Username: entry.GetEqualFoldAttributeValue(l.config.UsernameAttribute),
+		Email:    entry.GetEqualFoldAttributeValue(l.config.EmailAttribute),
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	return identity, nil
+}
+
+// dial 连接目录，按配置使用 ldaps 或 StartTLS
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: l.config.Timeout}
+	conn, err := ldap.DialURL(l.config.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(l.config.TLSConfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	conn.SetTimeout(l.config.Timeout)
+
+	if l.config.StartTLS {
+		if err := conn.StartTLS(l.config.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: StartTLS failed: %v", ErrUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser 按过滤器查找唯一的用户条目，找不到或不唯一时视为密码错误
+func (l *LDAP) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(l.config.UserFilter, UsernamePlaceholder, ldap.EscapeFilter(username))
+	request := ldap.NewSearchRequest(
+		l.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(l.config.Timeout.Seconds()), false,
+		filter,
+		[]string{l.config.UsernameAttribute, l.config.EmailAttribute},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("%w: search failed: %v", ErrUnavailable, err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return result.Entries[0], nil
+	default:
+		log.Printf("LDAP filter %s matched more than one entry, refusing to authenticate", filter)
+		return nil, ErrInvalidCredentials
+	}
+}
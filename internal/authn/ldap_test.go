@@ -0,0 +1,208 @@
+package authn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+const testBaseDN = "dc=example,dc=test"
+
+// startDirectory 在随机端口启动目录替身，wrap 为nil时使用明文监听
+func startDirectory(t *testing.T, directory *MockDirectory, wrap func(net.Listener) net.Listener) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	if wrap != nil {
+		listener = wrap(listener)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go directory.Serve(listener)
+	return addr
+}
+
+// testDirectory 创建含服务账户和两个用户的目录
+func testDirectory(tlsConfig *tls.Config) *MockDirectory {
+	directory := NewMockDirectory(testBaseDN, tlsConfig)
+	directory.AddServiceAccount("cn=gopass,"+testBaseDN, "service-secret")
+	directory.AddUser("alice", "alice-secret", "alice@example.test")
+	directory.AddUser("bob", "bob-secret", "bob@example.test")
+	return directory
+}
+
+func newTestLDAP(t *testing.T, config LDAPConfig) *LDAP {
+	t.Helper()
+
+	if config.BindDN == "" {
+		config.BindDN = "cn=gopass," + testBaseDN
+		config.BindPassword = "service-secret"
+	}
+	config.BaseDN = testBaseDN
+	config.Timeout = 2 * time.Second
+
+	authenticator, err := NewLDAP(config)
+	if err != nil {
+		t.Fatalf("Failed to create LDAP authenticator: %v", err)
+	}
+	return authenticator
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	addr := startDirectory(t, testDirectory(nil), nil)
+	authenticator := newTestLDAP(t, LDAPConfig{URL: "ldap://" + addr})
+
+	identity, err := authenticator.Authenticate("alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if identity.Username != "alice" || identity.Email != "alice@example.test" {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+
+	cases := []struct {
+		name, username, password string
+	}{
+		{"wrong password", "alice", "bob-secret"},
+		{"unknown user", "carol", "alice-secret"},
+		{"empty password", "alice", ""},
+		{"wildcard username", "*", "alice-secret"},
+		{"filter injection", "alice)(uid=*", "alice-secret"},
+	}
+	for _, tc := range cases {
+		if _, err := authenticator.Authenticate(tc.username, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestLDAPCustomFilter(t *testing.T) {
+	addr := startDirectory(t, testDirectory(nil), nil)
+	authenticator := newTestLDAP(t, LDAPConfig{
+		URL:        "ldap://" + addr,
+		UserFilter: "(&(objectClass=inetOrgPerson)(mail={username}))",
+	})
+
+	// 用邮箱登录，本地用户名仍取自 uid 属性
+	identity, err := authenticator.Authenticate("bob@example.test", "bob-secret")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if identity.Username != "bob" {
+		t.Errorf("Username should come from the uid attribute, got %q", identity.Username)
+	}
+}
+
+func TestLDAPUnavailable(t *testing.T) {
+	addr := startDirectory(t, testDirectory(nil), nil)
+
+	// 服务账户密码错误不是用户的密码错误
+	authenticator := newTestLDAP(t, LDAPConfig{
+		URL:          "ldap://" + addr,
+		BindDN:       "cn=gopass," + testBaseDN,
+		BindPassword: "wrong",
+	})
+	if _, err := authenticator.Authenticate("alice", "alice-secret"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Service bind failure should be ErrUnavailable, got %v", err)
+	}
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	authenticator = newTestLDAP(t, LDAPConfig{URL: "ldap://" + closedAddr})
+	if _, err := authenticator.Authenticate("alice", "alice-secret"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Unreachable directory should be ErrUnavailable, got %v", err)
+	}
+}
+
+// testCertificate 生成自签名CA签发的 127.0.0.1 服务器证书，返回服务器TLS配置和信任该CA的证书池
+func testCertificate(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gopass test directory"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+	addr := startDirectory(t, testDirectory(serverTLS), nil)
+
+	authenticator := newTestLDAP(t, LDAPConfig{
+		URL:       "ldap://" + addr,
+		StartTLS:  true,
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	if _, err := authenticator.Authenticate("alice", "alice-secret"); err != nil {
+		t.Fatalf("Authenticate over StartTLS failed: %v", err)
+	}
+
+	// 不信任的证书不能降级为明文
+	untrusted := newTestLDAP(t, LDAPConfig{URL: "ldap://" + addr, StartTLS: true})
+	if _, err := untrusted.Authenticate("alice", "alice-secret"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Untrusted certificate should be rejected, got %v", err)
+	}
+}
+
+func TestLDAPS(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+	addr := startDirectory(t, testDirectory(nil), func(l net.Listener) net.Listener {
+		return tls.NewListener(l, serverTLS)
+	})
+
+	authenticator := newTestLDAP(t, LDAPConfig{
+		URL:       "ldaps://" + addr,
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	if _, err := authenticator.Authenticate("bob", "bob-secret"); err != nil {
+		t.Fatalf("Authenticate over ldaps failed: %v", err)
+	}
+}
+
+func TestNewLDAPValidatesConfig(t *testing.T) {
+	cases := []LDAPConfig{
+		{URL: "http://directory", BaseDN: testBaseDN},
+		{URL: "ldap://directory"},
+		{URL: "ldap://directory", BaseDN: testBaseDN, UserFilter: "(uid=alice)"},
+		{URL: "ldaps://directory", BaseDN: testBaseDN, StartTLS: true},
+	}
+	for _, config := range cases {
+		if _, err := NewLDAP(config); err == nil {
+			t.Errorf("Config %+v should be rejected", config)
+		}
+	}
+}
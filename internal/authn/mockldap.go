@@ -0,0 +1,295 @@
+package authn
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// startTLSOID StartTLS 扩展操作（RFC 4511 4.14）
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// MockDirectory 本地开发和测试使用的LDAP目录替身。
+// 只实现简单绑定、搜索（与、或、非、相等和存在过滤器）、StartTLS 和解绑，条目保存在内存中
+type MockDirectory struct {
+	baseDN    string
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	entries  []*mockEntry
+	services map[string]string
+}
+
+// mockEntry 目录中的一个条目
+type mockEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// NewMockDirectory 创建目录替身，tlsConfig 不为nil时支持 StartTLS
+func NewMockDirectory(baseDN string, tlsConfig *tls.Config) *MockDirectory {
+	return &MockDirectory{
+		baseDN:    baseDN,
+		tlsConfig: tlsConfig,
+		services:  make(map[string]string),
+	}
+}
+
+// AddUser 在 ou=people 下添加一个 inetOrgPerson 用户，返回其DN
+func (d *MockDirectory) AddUser(uid, password, mail string) string {
+	dn := "uid=" + uid + ",ou=people," + d.baseDN
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, &mockEntry{
+		dn:       dn,
+		password: password,
+		attributes: map[string][]string{
+			"objectclass": {"top", "person", "inetOrgPerson"},
+			"uid":         {uid},
+			"cn":          {uid},
+			"mail":        {mail},
+		},
+	})
+	return dn
+}
+
+// SetPassword 修改用户密码，模拟在目录中改密码
+func (d *MockDirectory) SetPassword(uid, password string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entry := range d.entries {
+		if strings.EqualFold(entry.attributes["uid"][0], uid) {
+			entry.password = password
+		}
+	}
+}
+
+// AddServiceAccount 添加只能用于绑定和搜索的服务账户。
+// 存在服务账户时，未绑定的连接不能搜索
+func (d *MockDirectory) AddServiceAccount(dn, password string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.services[strings.ToLower(dn)] = password
+}
+
+// Serve 在 listener 上接受连接直到其关闭
+func (d *MockDirectory) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle 处理一个连接上的请求
+func (d *MockDirectory) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("LDAP stand-in: read failed: %v", err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			code := d.bind(request)
+			bound = code == ldap.LDAPResultSuccess
+			d.respond(conn, messageID, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			d.search(conn, messageID, request, bound)
+		case ldap.ApplicationExtendedRequest:
+			if len(request.Children) == 0 || packetString(request.Children[0]) != startTLSOID || d.tlsConfig == nil {
+				d.respond(conn, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError)
+				continue
+			}
+			d.respond(conn, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess)
+			tlsConn := tls.Server(conn, d.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				log.Printf("LDAP stand-in: TLS handshake failed: %v", err)
+				return
+			}
+			conn = tlsConn
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			d.respond(conn, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform)
+		}
+	}
+}
+
+// bind 校验简单绑定，空DN和空密码为匿名绑定
+func (d *MockDirectory) bind(request *ber.Packet) uint16 {
+	if len(request.Children) < 3 || request.Children[2].Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported
+	}
+	dn := packetString(request.Children[1])
+	password := packetString(request.Children[2])
+	if dn == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	if password == "" {
+		return ldap.LDAPResultUnwillingToPerform
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if expected, ok := d.services[strings.ToLower(dn)]; ok && expected == password {
+		return ldap.LDAPResultSuccess
+	}
+	for _, entry := range d.entries {
+		if strings.EqualFold(entry.dn, dn) && entry.password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+// search 返回基准DN下匹配过滤器的条目，超过大小限制时返回 sizeLimitExceeded
+func (d *MockDirectory) search(conn net.Conn, messageID int64, request *ber.Packet, bound bool) {
+	if len(request.Children) < 8 {
+		d.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.services) > 0 && !bound {
+		d.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+		return
+	}
+
+	baseDN := strings.ToLower(packetString(request.Children[0]))
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+
+	var requested []string
+	for _, attribute := range request.Children[7].Children {
+		requested = append(requested, strings.ToLower(packetString(attribute)))
+	}
+
+	sent := int64(0)
+	for _, entry := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.dn), baseDN) || !entry.matches(filter) {
+			continue
+		}
+		if sizeLimit > 0 && sent == sizeLimit {
+			d.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded)
+			return
+		}
+		d.sendEntry(conn, messageID, entry, requested)
+		sent++
+	}
+	d.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+}
+
+// matches 计算过滤器，属性名和值都不区分大小写
+func (e *mockEntry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !e.matches(child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if e.matches(child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !e.matches(filter.Children[0])
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false
+		}
+		attribute := strings.ToLower(packetString(filter.Children[0]))
+		value := packetString(filter.Children[1])
+		for _, v := range e.attributes[attribute] {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		attribute := strings.ToLower(packetString(filter))
+		return attribute == "objectclass" || len(e.attributes[attribute]) > 0
+	default:
+		return false
+	}
+}
+
+// sendEntry 发送一个搜索结果条目，只包含请求的属性
+func (d *MockDirectory) sendEntry(conn net.Conn, messageID int64, entry *mockEntry, requested []string) {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, name := range requested {
+		values, ok := entry.attributes[name]
+		if !ok {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	response.AppendChild(attributes)
+
+	writeMessage(conn, messageID, response)
+}
+
+// respond 发送只含结果码的响应
+func (d *MockDirectory) respond(conn net.Conn, messageID int64, application uint8, code uint16) {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ber.Tag(application), nil, ldap.ApplicationMap[application])
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), "Result Code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	writeMessage(conn, messageID, response)
+}
+
+// writeMessage 将响应包装为 LDAPMessage 写入连接
+func writeMessage(conn net.Conn, messageID int64, response *ber.Packet) {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	message.AppendChild(response)
+	if _, err := conn.Write(message.Bytes()); err != nil {
+		log.Printf("LDAP stand-in: write failed: %v", err)
+	}
+}
+
+// packetString 读取原始类型的内容，上下文类的标签不会填充 ByteValue
+func packetString(p *ber.Packet) string {
+	return p.Data.String()
+}
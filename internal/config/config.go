@@ -0,0 +1,266 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopass/internal/attachment"
+	"gopass/internal/authn"
+	"gopass/internal/crypto"
+	"gopass/internal/mailer"
+	"gopass/internal/webauthn"
+)
+
+// Config 服务器配置，从环境变量读取
+type Config struct {
+	DBPath string
+	Addr   string
+
+	KeyProvider string // file | env | kms
+	KeyFile     string
+	KMSURL      string
+	KMSKeyName  string
+	KMSToken    string
+
+	JWTAlgorithm string // HS256 | EdDSA | ES256
+	JWTSecret    string // 设置后使用固定的HS256密钥，不再从数据库加载签名密钥
+
+	OIDCIssuer       string // 设置后启用OIDC单点登录
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string // 空格分隔
+
+	LDAPURL            string // 设置后由LDAP目录验证团队账户，并关闭自助注册
+	LDAPBindDN         string
+	LDAPBindPassword   string
+	LDAPBaseDN         string
+	LDAPUserFilter     string
+	LDAPUsernameAttr   string
+	LDAPEmailAttr      string
+	LDAPStartTLS       bool
+	LDAPCAFile         string
+	LDAPInsecureVerify bool // 仅用于测试环境，跳过证书校验
+
+	WebAuthnRPID    string // 安全密钥绑定的站点域名，上线后不能再修改
+	WebAuthnOrigins string // 允许使用安全密钥的页面来源，逗号分隔
+
+	BaseURL      string // 邮件中链接指向的站点地址
+	Mailer       string // log | file | smtp
+	MailFrom     string
+	MailFile     string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPSecurity string // starttls | tls | none
+
+	VaultIdleTimeout string // 保险库闲置多久后自动锁定，Go 时长格式，0 表示不自动锁定
+
+	AttachmentStorage string // db | dir
+	AttachmentDir     string
+	AttachmentQuotaMB string // 每个用户的附件总大小上限，0 表示不限制
+
+	PasswordHistory string // 每个条目保留的历史密码数量，0 表示不保留
+}
+
+// MasterKeyEnv env 密钥后端读取根密钥的环境变量
+const MasterKeyEnv = "GOPASS_MASTER_KEY"
+
+// Load 从环境变量加载配置
+func Load() *Config {
+	return &Config{
+		DBPath:      getEnv("GOPASS_DB", "gopass.db"),
+		Addr:        getEnv("GOPASS_ADDR", ":8080"),
+		KeyProvider: getEnv("GOPASS_KEY_PROVIDER", "file"),
+		KeyFile:     getEnv("GOPASS_KEY_FILE", "gopass.key"),
+		KMSURL:      os.Getenv("GOPASS_KMS_URL"),
+		KMSKeyName:  getEnv("GOPASS_KMS_KEY", "gopass"),
+		KMSToken:    os.Getenv("GOPASS_KMS_TOKEN"),
+
+		JWTAlgorithm: getEnv("GOPASS_JWT_ALG", "HS256"),
+		JWTSecret:    os.Getenv("GOPASS_JWT_SECRET"),
+
+		OIDCIssuer:       os.Getenv("GOPASS_OIDC_ISSUER"),
+		OIDCClientID:     os.Getenv("GOPASS_OIDC_CLIENT_ID"),
+		OIDCClientSecret: os.Getenv("GOPASS_OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  getEnv("GOPASS_OIDC_REDIRECT_URL", "http://localhost:8080/api/sso/callback"),
+		OIDCScopes:       getEnv("GOPASS_OIDC_SCOPES", "openid profile email"),
+
+		LDAPURL:            os.Getenv("GOPASS_LDAP_URL"),
+		LDAPBindDN:         os.Getenv("GOPASS_LDAP_BIND_DN"),
+		LDAPBindPassword:   os.Getenv("GOPASS_LDAP_BIND_PASSWORD"),
+		LDAPBaseDN:         os.Getenv("GOPASS_LDAP_BASE_DN"),
+		LDAPUserFilter:     getEnv("GOPASS_LDAP_USER_FILTER", "(uid={username})"),
+		LDAPUsernameAttr:   getEnv("GOPASS_LDAP_USERNAME_ATTR", "uid"),
+		LDAPEmailAttr:      getEnv("GOPASS_LDAP_EMAIL_ATTR", "mail"),
+		LDAPStartTLS:       getEnvBool("GOPASS_LDAP_START_TLS"),
+		LDAPCAFile:         os.Getenv("GOPASS_LDAP_CA_FILE"),
+		LDAPInsecureVerify: getEnvBool("GOPASS_LDAP_INSECURE_SKIP_VERIFY"),
+
+		WebAuthnRPID:    getEnv("GOPASS_WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnOrigins: getEnv("GOPASS_WEBAUTHN_ORIGINS", "http://localhost:8080"),
+
+		BaseURL:      getEnv("GOPASS_BASE_URL", "http://localhost:8080"),
+		Mailer:       getEnv("GOPASS_MAILER", "log"),
+		MailFrom:     getEnv("GOPASS_MAIL_FROM", "GoPass <noreply@localhost>"),
+		MailFile:     getEnv("GOPASS_MAIL_FILE", "mail.txt"),
+		SMTPAddr:     os.Getenv("GOPASS_SMTP_ADDR"),
+		SMTPUsername: os.Getenv("GOPASS_SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("GOPASS_SMTP_PASSWORD"),
+		SMTPSecurity: getEnv("GOPASS_SMTP_SECURITY", mailer.SecuritySTARTTLS),
+
+		VaultIdleTimeout: getEnv("GOPASS_VAULT_IDLE_TIMEOUT", "15m"),
+
+		AttachmentStorage: getEnv("GOPASS_ATTACHMENT_STORAGE", attachment.StorageDB),
+		AttachmentDir:     getEnv("GOPASS_ATTACHMENT_DIR", "attachments"),
+		AttachmentQuotaMB: getEnv("GOPASS_ATTACHMENT_QUOTA_MB", "100"),
+
+		PasswordHistory: getEnv("GOPASS_PASSWORD_HISTORY", "10"),
+	}
+}
+
+// NewKeyProvider 根据配置创建服务器根密钥后端
+func (c *Config) NewKeyProvider() (crypto.KeyProvider, error) {
+	switch c.KeyProvider {
+	case "file":
+		return crypto.NewFileKeyProvider(c.KeyFile)
+	case "env":
+		return crypto.NewEnvKeyProvider(MasterKeyEnv)
+	case "kms":
+		if c.KMSURL == "" {
+			return nil, fmt.Errorf("GOPASS_KMS_URL is required for the kms key provider")
+		}
+		return crypto.NewKMSKeyProvider(c.KMSURL, c.KMSKeyName, c.KMSToken), nil
+	default:
+		return nil, fmt.Errorf("unknown key provider: %s", c.KeyProvider)
+	}
+}
+
+// NewLDAPAuthenticator 根据配置创建LDAP验证器
+func (c *Config) NewLDAPAuthenticator() (*authn.LDAP, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: c.LDAPInsecureVerify}
+	if c.LDAPCAFile != "" {
+		pem, err := os.ReadFile(c.LDAPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GOPASS_LDAP_CA_FILE: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.LDAPCAFile)
+		}
+	}
+
+	return authn.NewLDAP(authn.LDAPConfig{
+		URL:               c.LDAPURL,
+		BindDN:            c.LDAPBindDN,
+		BindPassword:      c.LDAPBindPassword,
+		BaseDN:            c.LDAPBaseDN,
+		UserFilter:        c.LDAPUserFilter,
+		UsernameAttribute: c.LDAPUsernameAttr,
+		EmailAttribute:    c.LDAPEmailAttr,
+		StartTLS:          c.LDAPStartTLS,
+		TLSConfig:         tlsConfig,
+	})
+}
+
+// NewRelyingParty 根据配置创建安全密钥的依赖方
+func (c *Config) NewRelyingParty() *webauthn.RelyingParty {
+	origins := []string{}
+	for _, origin := range strings.Split(c.WebAuthnOrigins, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return &webauthn.RelyingParty{ID: c.WebAuthnRPID, Name: "GoPass", Origins: origins}
+}
+
+// NewMailer 根据配置创建邮件发送器
+func (c *Config) NewMailer() (mailer.Mailer, error) {
+	switch c.Mailer {
+	case "log":
+		return mailer.NewFile("", c.MailFrom), nil
+	case "file":
+		return mailer.NewFile(c.MailFile, c.MailFrom), nil
+	case "smtp":
+		if c.SMTPAddr == "" {
+			return nil, fmt.Errorf("GOPASS_SMTP_ADDR is required for the smtp mailer")
+		}
+		return mailer.NewSMTP(mailer.SMTPConfig{
+			Addr:     c.SMTPAddr,
+			From:     c.MailFrom,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			Security: c.SMTPSecurity,
+		})
+	default:
+		return nil, fmt.Errorf("unknown mailer: %s", c.Mailer)
+	}
+}
+
+// VaultIdle 解析保险库闲置锁定时间
+func (c *Config) VaultIdle() (time.Duration, error) {
+	d, err := time.ParseDuration(c.VaultIdleTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// NewAttachmentStores 根据配置创建新附件写入的存储后端，以及读取切换前上传的附件所需的其他后端
+func (c *Config) NewAttachmentStores() (attachment.Store, []attachment.Store, error) {
+	db, dir := attachment.NewDB(), attachment.NewDir(c.AttachmentDir)
+	switch c.AttachmentStorage {
+	case attachment.StorageDB:
+		return db, []attachment.Store{dir}, nil
+	case attachment.StorageDir:
+		return dir, []attachment.Store{db}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown attachment storage: %s", c.AttachmentStorage)
+	}
+}
+
+// AttachmentQuota 解析每个用户的附件配额（字节）
+func (c *Config) AttachmentQuota() (int64, error) {
+	mb, err := strconv.ParseInt(c.AttachmentQuotaMB, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if mb < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return mb << 20, nil
+}
+
+// PasswordHistoryLimit 解析每个条目保留的历史密码数量
+func (c *Config) PasswordHistoryLimit() (int, error) {
+	n, err := strconv.Atoi(c.PasswordHistory)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return n, nil
+}
+
+// getEnv 读取环境变量，未设置时返回默认值
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvBool 读取布尔型环境变量，未设置或无法解析时为false
+func getEnvBool(key string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(key))
+	return value
+}
@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 基于X25519的密封盒：发送方使用临时密钥与接收方公钥协商出对称密钥，
+// 只有持有接收方私钥的一方才能打开。格式: base64(临时公钥) "." 信封密文
+
+// GenerateKeyPair 生成X25519密钥对
+func GenerateKeyPair() (publicKey, privateKey []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.PublicKey().Bytes(), priv.Bytes(), nil
+}
+
+// SealTo 将数据密封给公钥持有者，aad 会被认证
+func SealTo(publicKey, plaintext, aad []byte) (string, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	key, err := boxKey(shared, ephemeralPublic, publicKey)
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(key)
+
+	ciphertext, err := EncryptWithAAD(base64.StdEncoding.EncodeToString(plaintext), key, aad)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ephemeralPublic) + "." + ciphertext, nil
+}
+
+// OpenSealed 使用私钥打开密封盒
+func OpenSealed(privateKey []byte, sealed string, aad []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(sealed, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid sealed box")
+	}
+
+	ephemeralPublic, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := boxKey(shared, ephemeralPublic, priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(key)
+
+	encoded, err := DecryptWithAAD(parts[1], key, aad)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// boxKey 由共享秘密和双方公钥派生对称密钥
+func boxKey(shared, ephemeralPublic, recipientPublic []byte) ([]byte, error) {
+	info := append([]byte("gopass sealed box"), ephemeralPublic...)
+	info = append(info, recipientPublic...)
+
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
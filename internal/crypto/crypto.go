@@ -3,11 +3,9 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
-	"io"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -30,29 +28,44 @@ func GenerateKey(password string) []byte {
 	return hash[:]
 }
 
-// Encrypt 使用AES-GCM加密数据
+// Encrypt 使用默认算法加密数据，输出带版本和密钥ID的信封格式
 func Encrypt(plaintext string, key []byte) (string, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
+	return EncryptWith(DefaultAlgorithm, plaintext, key, nil)
+}
+
+// Decrypt 解密数据，根据信封头选择算法，同时兼容旧的无头部格式
+func Decrypt(ciphertext string, key []byte) (string, error) {
+	if !IsEnvelope(ciphertext) {
+		return decryptLegacy(ciphertext, key)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	envelope, err := ParseEnvelope(ciphertext)
 	if err != nil {
 		return "", err
 	}
+	return envelope.Open(key, nil)
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+// EncryptWithAAD 加密数据并与附加数据绑定，解密时必须提供相同的附加数据
+func EncryptWithAAD(plaintext string, key, aad []byte) (string, error) {
+	return EncryptWith(DefaultAlgorithm, plaintext, key, aad)
+}
+
+// DecryptWithAAD 解密与附加数据绑定的密文，未绑定的旧密文返回 ErrUnboundCiphertext
+func DecryptWithAAD(ciphertext string, key, aad []byte) (string, error) {
+	if !IsEnvelope(ciphertext) {
+		return "", ErrUnboundCiphertext
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	envelope, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return envelope.Open(key, aad)
 }
 
-// Decrypt 使用AES-GCM解密数据
-func Decrypt(ciphertext string, key []byte) (string, error) {
+// decryptLegacy 解密旧格式 base64(nonce||ciphertext) 的AES-GCM数据
+func decryptLegacy(ciphertext string, key []byte) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
@@ -0,0 +1,215 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Algorithm 信封中记录的AEAD算法
+type Algorithm byte
+
+const (
+	// AlgAES256GCM AES-256-GCM
+	AlgAES256GCM Algorithm = 1
+	// AlgXChaCha20Poly1305 XChaCha20-Poly1305
+	AlgXChaCha20Poly1305 Algorithm = 2
+)
+
+const (
+	// EnvelopeVersion 仅认证信封头部的格式版本
+	EnvelopeVersion byte = 1
+	// EnvelopeVersionBound 额外认证调用方附加数据(AAD)的格式版本
+	EnvelopeVersionBound byte = 2
+
+	// envelopePrefix 信封密文前缀，'$' 不属于base64字母表，可与旧格式区分
+	envelopePrefix = "$gp$"
+)
+
+var (
+	// ErrKeyMismatch 密文由其他密钥加密
+	ErrKeyMismatch = errors.New("ciphertext was encrypted with a different key")
+	// ErrUnsupportedEnvelope 无法识别的信封版本或算法
+	ErrUnsupportedEnvelope = errors.New("unsupported ciphertext envelope")
+	// ErrUnboundCiphertext 密文未绑定附加数据，无法验证其归属
+	ErrUnboundCiphertext = errors.New("ciphertext is not bound to associated data")
+)
+
+// DefaultAlgorithm 新密文使用的算法
+var DefaultAlgorithm = AlgAES256GCM
+
+// String 返回算法名称
+func (a Algorithm) String() string {
+	switch a {
+	case AlgAES256GCM:
+		return "AES-256-GCM"
+	case AlgXChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", byte(a))
+	}
+}
+
+// Envelope 自描述的密文信封: 版本 | 算法 | 密钥ID | nonce | 密文。
+// 版本2的信封在认证头部的同时认证调用方提供的附加数据。
+type Envelope struct {
+	Version    byte
+	Algorithm  Algorithm
+	KeyID      string
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// KeyID 计算密钥标识，用于判断密文由哪个密钥加密
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("gopass-key-id:"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// IsEnvelope 判断密文是否为信封格式
+func IsEnvelope(ciphertext string) bool {
+	return strings.HasPrefix(ciphertext, envelopePrefix)
+}
+
+// header 返回信封头部
+func (e *Envelope) header() []byte {
+	h := make([]byte, 0, 3+len(e.KeyID))
+	h = append(h, e.Version, byte(e.Algorithm), byte(len(e.KeyID)))
+	return append(h, e.KeyID...)
+}
+
+// additionalData 返回参与认证的附加数据: 信封头部 || 调用方AAD
+func (e *Envelope) additionalData(aad []byte) []byte {
+	return append(e.header(), aad...)
+}
+
+// Encode 将信封编码为字符串
+func (e *Envelope) Encode() string {
+	data := e.header()
+	data = append(data, e.Nonce...)
+	data = append(data, e.Ciphertext...)
+	return envelopePrefix + base64.StdEncoding.EncodeToString(data)
+}
+
+// ParseEnvelope 解析信封格式的密文
+func ParseEnvelope(ciphertext string) (*Envelope, error) {
+	if !IsEnvelope(ciphertext) {
+		return nil, ErrUnsupportedEnvelope
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, envelopePrefix))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 3 {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	e := &Envelope{Version: data[0], Algorithm: Algorithm(data[1])}
+	if e.Version != EnvelopeVersion && e.Version != EnvelopeVersionBound {
+		return nil, ErrUnsupportedEnvelope
+	}
+
+	keyIDLen := int(data[2])
+	data = data[3:]
+	if len(data) < keyIDLen {
+		return nil, errors.New("ciphertext too short")
+	}
+	e.KeyID, data = string(data[:keyIDLen]), data[keyIDLen:]
+
+	nonceSize, err := nonceSizeOf(e.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	e.Nonce, e.Ciphertext = data[:nonceSize], data[nonceSize:]
+
+	return e, nil
+}
+
+// EncryptWith 使用指定算法加密，输出信封格式密文。aad 非空时密文与其绑定
+func EncryptWith(alg Algorithm, plaintext string, key, aad []byte) (string, error) {
+	aead, err := newAEAD(alg, key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := RandomBytes(aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+
+	version := EnvelopeVersion
+	if aad != nil {
+		version = EnvelopeVersionBound
+	}
+
+	e := &Envelope{
+		Version:   version,
+		Algorithm: alg,
+		KeyID:     KeyID(key),
+		Nonce:     nonce,
+	}
+	e.Ciphertext = aead.Seal(nil, nonce, []byte(plaintext), e.additionalData(aad))
+
+	return e.Encode(), nil
+}
+
+// Open 使用密钥解密信封。要求绑定 aad 时，未绑定的密文会被拒绝
+func (e *Envelope) Open(key, aad []byte) (string, error) {
+	if e.KeyID != "" && e.KeyID != KeyID(key) {
+		return "", ErrKeyMismatch
+	}
+	if aad != nil && e.Version != EnvelopeVersionBound {
+		return "", ErrUnboundCiphertext
+	}
+
+	aead, err := newAEAD(e.Algorithm, key)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, e.additionalData(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// newAEAD 根据算法创建AEAD实例
+func newAEAD(alg Algorithm, key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case AlgAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, ErrUnsupportedEnvelope
+	}
+}
+
+// nonceSizeOf 返回算法的nonce长度
+func nonceSizeOf(alg Algorithm) (int, error) {
+	switch alg {
+	case AlgAES256GCM:
+		return 12, nil
+	case AlgXChaCha20Poly1305:
+		return chacha20poly1305.NonceSizeX, nil
+	default:
+		return 0, ErrUnsupportedEnvelope
+	}
+}
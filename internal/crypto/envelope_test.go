@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"testing"
+)
+
+// encryptLegacy 生成旧格式 base64(nonce||ciphertext) 的密文
+func encryptLegacy(t *testing.T, plaintext string, key []byte) string {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("Failed to create GCM: %v", err)
+	}
+	nonce, _ := RandomBytes(gcm.NonceSize())
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func TestEnvelopeAlgorithms(t *testing.T) {
+	key := GenerateKey("test-password")
+
+	for _, alg := range []Algorithm{AlgAES256GCM, AlgXChaCha20Poly1305} {
+		t.Run(alg.String(), func(t *testing.T) {
+			ciphertext, err := EncryptWith(alg, "secret", key, nil)
+			if err != nil {
+				t.Fatalf("Failed to encrypt: %v", err)
+			}
+
+			envelope, err := ParseEnvelope(ciphertext)
+			if err != nil {
+				t.Fatalf("Failed to parse envelope: %v", err)
+			}
+			if envelope.Version != EnvelopeVersion || envelope.Algorithm != alg {
+				t.Errorf("Unexpected envelope header: version=%d algorithm=%s", envelope.Version, envelope.Algorithm)
+			}
+			if envelope.KeyID != KeyID(key) {
+				t.Errorf("Envelope key ID should be %s, got %s", KeyID(key), envelope.KeyID)
+			}
+
+			decrypted, err := Decrypt(ciphertext, key)
+			if err != nil {
+				t.Fatalf("Failed to decrypt: %v", err)
+			}
+			if decrypted != "secret" {
+				t.Errorf("Decrypted text mismatch. Got: %s", decrypted)
+			}
+		})
+	}
+}
+
+func TestDecryptLegacyFormat(t *testing.T) {
+	key := GenerateKey("test-password")
+	legacy := encryptLegacy(t, "legacy secret", key)
+
+	if IsEnvelope(legacy) {
+		t.Fatal("Legacy ciphertext should not be detected as envelope")
+	}
+
+	decrypted, err := Decrypt(legacy, key)
+	if err != nil {
+		t.Fatalf("Failed to decrypt legacy ciphertext: %v", err)
+	}
+	if decrypted != "legacy secret" {
+		t.Errorf("Decrypted text mismatch. Got: %s", decrypted)
+	}
+}
+
+func TestEnvelopeKeyMismatch(t *testing.T) {
+	ciphertext, err := Encrypt("secret", GenerateKey("password1"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	if _, err := Decrypt(ciphertext, GenerateKey("password2")); err != ErrKeyMismatch {
+		t.Errorf("Expected ErrKeyMismatch, got %v", err)
+	}
+}
+
+func TestEnvelopeHeaderIsAuthenticated(t *testing.T) {
+	key := GenerateKey("test-password")
+	ciphertext, err := Encrypt("secret", key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	envelope, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		t.Fatalf("Failed to parse envelope: %v", err)
+	}
+
+	// 清空密钥ID会跳过快速检查，但头部已参与认证，解密仍应失败
+	envelope.KeyID = ""
+	if _, err := Decrypt(envelope.Encode(), key); err == nil {
+		t.Error("Decryption should fail when envelope header is modified")
+	}
+}
+
+func TestEncryptDecryptWithAAD(t *testing.T) {
+	key := GenerateKey("test-password")
+	aad := []byte("user=1:entry=2:field=password")
+
+	ciphertext, err := EncryptWithAAD("secret", key, aad)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	decrypted, err := DecryptWithAAD(ciphertext, key, aad)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if decrypted != "secret" {
+		t.Errorf("Decrypted text mismatch. Got: %s", decrypted)
+	}
+
+	// 移植到其他条目的密文必须解密失败
+	if _, err := DecryptWithAAD(ciphertext, key, []byte("user=1:entry=3:field=password")); err == nil {
+		t.Error("Decryption should fail with different associated data")
+	}
+
+	if _, err := Decrypt(ciphertext, key); err == nil {
+		t.Error("Decryption without associated data should fail for bound ciphertext")
+	}
+}
+
+func TestDecryptWithAADRejectsUnbound(t *testing.T) {
+	key := GenerateKey("test-password")
+	aad := []byte("user=1:entry=2:field=password")
+
+	unbound, err := Encrypt("secret", key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	if _, err := DecryptWithAAD(unbound, key, aad); err != ErrUnboundCiphertext {
+		t.Errorf("Expected ErrUnboundCiphertext for unbound envelope, got %v", err)
+	}
+
+	if _, err := DecryptWithAAD(encryptLegacy(t, "secret", key), key, aad); err != ErrUnboundCiphertext {
+		t.Errorf("Expected ErrUnboundCiphertext for legacy ciphertext, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// KeySize 保险库密钥长度（AES-256）
+	KeySize = 32
+	// SaltSize KDF盐长度
+	SaltSize = 16
+)
+
+// KDFParams Argon2id 派生参数
+type KDFParams struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// DefaultKDFParams 默认的 Argon2id 参数
+var DefaultKDFParams = KDFParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// String 将参数编码为 argon2id$v=19$m=...,t=...,p=... 格式
+func (p KDFParams) String() string {
+	return fmt.Sprintf("argon2id$v=%d$m=%d,t=%d,p=%d", argon2.Version, p.Memory, p.Time, p.Threads)
+}
+
+// ParseKDFParams 解析存储的KDF参数
+func ParseKDFParams(s string) (KDFParams, error) {
+	var p KDFParams
+	var version int
+	var threads uint32
+	_, err := fmt.Sscanf(s, "argon2id$v=%d$m=%d,t=%d,p=%d", &version, &p.Memory, &p.Time, &threads)
+	if err != nil {
+		return p, fmt.Errorf("invalid kdf params: %v", err)
+	}
+	if version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+	if p.Memory == 0 || p.Time == 0 || threads == 0 || threads > 255 {
+		return p, errors.New("invalid kdf params")
+	}
+	p.Threads = uint8(threads)
+	return p, nil
+}
+
+// GenerateSalt 生成随机盐
+func GenerateSalt() ([]byte, error) {
+	return RandomBytes(SaltSize)
+}
+
+// GenerateRandomKey 生成随机的256位密钥
+func GenerateRandomKey() ([]byte, error) {
+	return RandomBytes(KeySize)
+}
+
+// RandomBytes 读取n个安全随机字节
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// DeriveKey 使用 Argon2id 从密码派生密钥加密密钥(KEK)
+func DeriveKey(password string, salt []byte, params KDFParams) []byte {
+	return argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, KeySize)
+}
+
+// WrapKey 使用KEK包装密钥
+func WrapKey(kek, key []byte) (string, error) {
+	return Encrypt(base64.StdEncoding.EncodeToString(key), kek)
+}
+
+// UnwrapKey 使用KEK解开被包装的密钥
+func UnwrapKey(kek []byte, wrapped string) ([]byte, error) {
+	encoded, err := Decrypt(wrapped, kek)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		return nil, errors.New("invalid wrapped key length")
+	}
+	return key, nil
+}
+
+// Wipe 清零内存中的密钥材料
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
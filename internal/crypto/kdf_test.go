@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var testKDFParams = KDFParams{Time: 1, Memory: 1024, Threads: 1}
+
+func TestKDFParamsRoundTrip(t *testing.T) {
+	encoded := DefaultKDFParams.String()
+
+	parsed, err := ParseKDFParams(encoded)
+	if err != nil {
+		t.Fatalf("Failed to parse params %q: %v", encoded, err)
+	}
+
+	if parsed != DefaultKDFParams {
+		t.Errorf("Parsed params should equal original. Got: %+v, Expected: %+v", parsed, DefaultKDFParams)
+	}
+
+	if _, err := ParseKDFParams("scrypt$n=16384"); err == nil {
+		t.Error("Should fail with unknown KDF")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	salt, err := GenerateSalt()
+	if err != nil {
+		t.Fatalf("Failed to generate salt: %v", err)
+	}
+
+	key1 := DeriveKey("password1", salt, testKDFParams)
+	key1Again := DeriveKey("password1", salt, testKDFParams)
+	key2 := DeriveKey("password2", salt, testKDFParams)
+
+	if len(key1) != KeySize {
+		t.Errorf("Key length should be %d bytes, got %d", KeySize, len(key1))
+	}
+
+	if !bytes.Equal(key1, key1Again) {
+		t.Error("Same password and salt should derive same key")
+	}
+
+	if bytes.Equal(key1, key2) {
+		t.Error("Different passwords should derive different keys")
+	}
+
+	otherSalt, _ := GenerateSalt()
+	if bytes.Equal(key1, DeriveKey("password1", otherSalt, testKDFParams)) {
+		t.Error("Different salts should derive different keys")
+	}
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	vaultKey, err := GenerateRandomKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	salt, _ := GenerateSalt()
+	kek := DeriveKey("master-password", salt, testKDFParams)
+
+	wrapped, err := WrapKey(kek, vaultKey)
+	if err != nil {
+		t.Fatalf("Failed to wrap key: %v", err)
+	}
+
+	unwrapped, err := UnwrapKey(kek, wrapped)
+	if err != nil {
+		t.Fatalf("Failed to unwrap key: %v", err)
+	}
+
+	if !bytes.Equal(unwrapped, vaultKey) {
+		t.Error("Unwrapped key should equal original key")
+	}
+
+	wrongKEK := DeriveKey("wrong-password", salt, testKDFParams)
+	if _, err := UnwrapKey(wrongKEK, wrapped); err == nil {
+		t.Error("Unwrap should fail with wrong KEK")
+	}
+}
+
+func TestRecoveryKey(t *testing.T) {
+	recoveryKey, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery key: %v", err)
+	}
+
+	kek, err := DeriveRecoveryKEK(recoveryKey)
+	if err != nil {
+		t.Fatalf("Failed to derive recovery KEK: %v", err)
+	}
+	if len(kek) != KeySize {
+		t.Errorf("Recovery KEK length should be %d bytes, got %d", KeySize, len(kek))
+	}
+
+	// 大小写和分隔符不影响派生结果
+	relaxed := strings.ToLower(strings.ReplaceAll(recoveryKey, "-", " "))
+	kekAgain, err := DeriveRecoveryKEK(relaxed)
+	if err != nil {
+		t.Fatalf("Failed to derive recovery KEK from relaxed input: %v", err)
+	}
+	if !bytes.Equal(kek, kekAgain) {
+		t.Error("Recovery KEK should not depend on case or separators")
+	}
+
+	if _, err := DeriveRecoveryKEK("NOT-A-KEY"); err != ErrInvalidRecoveryKey {
+		t.Errorf("Expected ErrInvalidRecoveryKey, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyProvider 服务器根密钥的管理后端。
+// 根密钥不会交给调用方，调用方只能让后端包装或解开数据密钥。
+type KeyProvider interface {
+	// Name 返回后端名称，记录在被包装的密钥旁以便排查
+	Name() string
+	// WrapKey 用根密钥包装数据密钥
+	WrapKey(key []byte) (string, error)
+	// UnwrapKey 解开由 WrapKey 包装的数据密钥
+	UnwrapKey(wrapped string) ([]byte, error)
+}
+
+// localKeyProvider 根密钥保存在本进程内存中的后端
+type localKeyProvider struct {
+	name    string
+	rootKey []byte
+}
+
+func (p *localKeyProvider) Name() string {
+	return p.name
+}
+
+func (p *localKeyProvider) WrapKey(key []byte) (string, error) {
+	return EncryptWithAAD(base64.StdEncoding.EncodeToString(key), p.rootKey, []byte("gopass:server-key"))
+}
+
+func (p *localKeyProvider) UnwrapKey(wrapped string) ([]byte, error) {
+	encoded, err := DecryptWithAAD(wrapped, p.rootKey, []byte("gopass:server-key"))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// NewFileKeyProvider 从本地密钥文件读取根密钥，文件不存在时生成新密钥。
+// 密钥文件应放在数据库目录之外，例如只读挂载的密钥卷。
+func NewFileKeyProvider(path string) (KeyProvider, error) {
+	rootKey, err := LoadOrCreateKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &localKeyProvider{name: "file", rootKey: rootKey}, nil
+}
+
+// LoadOrCreateKeyFile 读取base64编码的根密钥文件，文件不存在时生成新密钥并以0600权限写入
+func LoadOrCreateKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createKeyFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+
+	rootKey, err := decodeRootKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %v", path, err)
+	}
+	return rootKey, nil
+}
+
+// createKeyFile 生成新的根密钥并写入密钥文件
+func createKeyFile(path string) ([]byte, error) {
+	rootKey, err := GenerateRandomKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %v", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(rootKey) + "\n"
+	if err := os.WriteFile(path, []byte(encoded), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %v", err)
+	}
+
+	return rootKey, nil
+}
+
+// NewEnvKeyProvider 从环境变量读取base64编码的根密钥
+func NewEnvKeyProvider(variable string) (KeyProvider, error) {
+	value := os.Getenv(variable)
+	if value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", variable)
+	}
+
+	rootKey, err := decodeRootKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %s: %v", variable, err)
+	}
+	return &localKeyProvider{name: "env", rootKey: rootKey}, nil
+}
+
+// decodeRootKey 解码base64编码的256位根密钥
+func decodeRootKey(encoded string) ([]byte, error) {
+	rootKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(rootKey) != KeySize {
+		return nil, errors.New("root key must be 32 bytes")
+	}
+	return rootKey, nil
+}
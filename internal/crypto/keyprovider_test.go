@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testProviderRoundTrip 验证后端能解开自己包装的密钥
+func testProviderRoundTrip(t *testing.T, provider KeyProvider) {
+	t.Helper()
+
+	dataKey, _ := GenerateRandomKey()
+	wrapped, err := provider.WrapKey(dataKey)
+	if err != nil {
+		t.Fatalf("%s: failed to wrap key: %v", provider.Name(), err)
+	}
+
+	unwrapped, err := provider.UnwrapKey(wrapped)
+	if err != nil {
+		t.Fatalf("%s: failed to unwrap key: %v", provider.Name(), err)
+	}
+
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("%s: unwrapped key should equal original key", provider.Name())
+	}
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "gopass.key")
+
+	provider, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("Failed to create file key provider: %v", err)
+	}
+	testProviderRoundTrip(t, provider)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Key file should be created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Key file should have 0600 permissions, got %o", info.Mode().Perm())
+	}
+
+	// 重新加载同一个密钥文件应能解开之前包装的密钥
+	dataKey, _ := GenerateRandomKey()
+	wrapped, _ := provider.WrapKey(dataKey)
+	reloaded, err := NewFileKeyProvider(path)
+	if err != nil {
+		t.Fatalf("Failed to reload key file: %v", err)
+	}
+	unwrapped, err := reloaded.UnwrapKey(wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Error("Reloaded provider should unwrap keys wrapped before")
+	}
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+	rootKey, _ := GenerateRandomKey()
+	t.Setenv("GOPASS_TEST_MASTER_KEY", base64.StdEncoding.EncodeToString(rootKey))
+
+	provider, err := NewEnvKeyProvider("GOPASS_TEST_MASTER_KEY")
+	if err != nil {
+		t.Fatalf("Failed to create env key provider: %v", err)
+	}
+	testProviderRoundTrip(t, provider)
+
+	t.Setenv("GOPASS_TEST_MASTER_KEY", "too-short")
+	if _, err := NewEnvKeyProvider("GOPASS_TEST_MASTER_KEY"); err == nil {
+		t.Error("Should fail with invalid root key")
+	}
+}
+
+func TestKMSKeyProvider(t *testing.T) {
+	rootKey, _ := GenerateRandomKey()
+	server := httptest.NewServer(NewKMSHandler(map[string][]byte{"gopass": rootKey}, "kms-token"))
+	defer server.Close()
+
+	testProviderRoundTrip(t, NewKMSKeyProvider(server.URL, "gopass", "kms-token"))
+
+	if _, err := NewKMSKeyProvider(server.URL, "gopass", "wrong-token").WrapKey(rootKey); err == nil {
+		t.Error("KMS should reject requests with wrong token")
+	}
+
+	if _, err := NewKMSKeyProvider(server.URL, "unknown", "kms-token").WrapKey(rootKey); err == nil {
+		t.Error("KMS should reject unknown key names")
+	}
+}
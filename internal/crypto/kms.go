@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KMS协议：
+//
+//	POST {base}/v1/keys/{name}/wrap    {"plaintext": "<base64>"}  -> {"ciphertext": "..."}
+//	POST {base}/v1/keys/{name}/unwrap  {"ciphertext": "..."}      -> {"plaintext": "<base64>"}
+//
+// 请求携带 Authorization: Bearer <token>。根密钥只存在于KMS中。
+
+// kmsRequest KMS请求体
+type kmsRequest struct {
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+// kmsResponse KMS响应体
+type kmsResponse struct {
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// kmsKeyProvider 通过HTTP KMS包装密钥的后端
+type kmsKeyProvider struct {
+	baseURL string
+	keyName string
+	token   string
+	client  *http.Client
+}
+
+// NewKMSKeyProvider 创建使用远程KMS的密钥后端
+func NewKMSKeyProvider(baseURL, keyName, token string) KeyProvider {
+	return &kmsKeyProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		keyName: keyName,
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *kmsKeyProvider) Name() string {
+	return "kms:" + p.keyName
+}
+
+func (p *kmsKeyProvider) WrapKey(key []byte) (string, error) {
+	resp, err := p.call("wrap", kmsRequest{Plaintext: base64.StdEncoding.EncodeToString(key)})
+	if err != nil {
+		return "", err
+	}
+	return resp.Ciphertext, nil
+}
+
+func (p *kmsKeyProvider) UnwrapKey(wrapped string) ([]byte, error) {
+	resp, err := p.call("unwrap", kmsRequest{Ciphertext: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+// call 调用KMS操作
+func (p *kmsKeyProvider) call(operation string, body kmsRequest) (*kmsResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/keys/%s/%s", p.baseURL, p.keyName, operation)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kms %s failed: %v", operation, err)
+	}
+	defer resp.Body.Close()
+
+	var result kmsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("kms %s: invalid response: %v", operation, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kms %s failed: %s (%d)", operation, result.Error, resp.StatusCode)
+	}
+	return &result, nil
+}
+
+// NewKMSHandler 返回实现上述KMS协议的本地替身服务，根密钥按名称保存在内存中。
+// 用于开发和测试，生产环境应使用真正的KMS或HSM网关。
+func NewKMSHandler(keys map[string][]byte, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON := func(status int, resp kmsResponse) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(resp)
+		}
+
+		if r.Method != http.MethodPost {
+			writeJSON(http.StatusMethodNotAllowed, kmsResponse{Error: "method not allowed"})
+			return
+		}
+
+		if token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				writeJSON(http.StatusUnauthorized, kmsResponse{Error: "unauthorized"})
+				return
+			}
+		}
+
+		// 路径格式: /v1/keys/{name}/{operation}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 4 || parts[0] != "v1" || parts[1] != "keys" {
+			writeJSON(http.StatusNotFound, kmsResponse{Error: "not found"})
+			return
+		}
+
+		rootKey, ok := keys[parts[2]]
+		if !ok {
+			writeJSON(http.StatusNotFound, kmsResponse{Error: "unknown key"})
+			return
+		}
+		provider := &localKeyProvider{name: "kms", rootKey: rootKey}
+
+		var req kmsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(http.StatusBadRequest, kmsResponse{Error: "invalid request"})
+			return
+		}
+
+		switch parts[3] {
+		case "wrap":
+			key, err := base64.StdEncoding.DecodeString(req.Plaintext)
+			if err != nil {
+				writeJSON(http.StatusBadRequest, kmsResponse{Error: "invalid plaintext"})
+				return
+			}
+			wrapped, err := provider.WrapKey(key)
+			if err != nil {
+				writeJSON(http.StatusInternalServerError, kmsResponse{Error: "wrap failed"})
+				return
+			}
+			writeJSON(http.StatusOK, kmsResponse{Ciphertext: wrapped})
+		case "unwrap":
+			key, err := provider.UnwrapKey(req.Ciphertext)
+			if err != nil {
+				writeJSON(http.StatusBadRequest, kmsResponse{Error: "unwrap failed"})
+				return
+			}
+			writeJSON(http.StatusOK, kmsResponse{Plaintext: base64.StdEncoding.EncodeToString(key)})
+		default:
+			writeJSON(http.StatusNotFound, kmsResponse{Error: "unknown operation"})
+		}
+	})
+}
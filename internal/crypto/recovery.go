@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// recoveryKeySize 恢复密钥的随机字节数（160位）
+const recoveryKeySize = 20
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrInvalidRecoveryKey 恢复密钥格式不正确
+var ErrInvalidRecoveryKey = errors.New("invalid recovery key")
+
+// GenerateRecoveryKey 生成高熵恢复密钥，格式为每4个字符一组的base32字符串
+func GenerateRecoveryKey() (string, error) {
+	raw, err := RandomBytes(recoveryKeySize)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := recoveryEncoding.EncodeToString(raw)
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// DeriveRecoveryKEK 从恢复密钥派生KEK。恢复密钥本身熵足够高，使用HKDF即可，无需慢哈希
+func DeriveRecoveryKEK(recoveryKey string) ([]byte, error) {
+	normalized := strings.ToUpper(recoveryKey)
+	normalized = strings.NewReplacer("-", "", " ", "").Replace(normalized)
+
+	raw, err := recoveryEncoding.DecodeString(normalized)
+	if err != nil || len(raw) != recoveryKeySize {
+		return nil, ErrInvalidRecoveryKey
+	}
+
+	kek := make([]byte, KeySize)
+	reader := hkdf.New(sha256.New, raw, nil, []byte("gopass recovery key"))
+	if _, err := io.ReadFull(reader, kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"errors"
+)
+
+// Shamir秘密共享，在GF(2^8)上逐字节进行，约简多项式为 x^8+x^4+x^3+x+1 (0x11b)。
+// 每份共享的格式为: x坐标(1字节) || 各字节多项式在x处的值。
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+func init() {
+	// 以3为生成元构造指数表和对数表
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		x = gfMulSlow(x, 3)
+	}
+}
+
+// gfMulSlow 不查表的乘法，仅用于构造表
+func gfMulSlow(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// SplitSecret 将秘密拆分为 n 份，任意 threshold 份可以还原
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret must not be empty")
+	}
+	if threshold < 2 || threshold > n {
+		return nil, errors.New("threshold must be between 2 and the number of shares")
+	}
+	if n > 255 {
+		return nil, errors.New("at most 255 shares are supported")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for j, s := range secret {
+		// 常数项为秘密字节，其余系数随机
+		coefficients[0] = s
+		random, err := RandomBytes(threshold - 1)
+		if err != nil {
+			return nil, err
+		}
+		copy(coefficients[1:], random)
+
+		for i := range shares {
+			shares[i][j+1] = evaluatePolynomial(coefficients, shares[i][0])
+		}
+	}
+	Wipe(coefficients)
+
+	return shares, nil
+}
+
+// evaluatePolynomial 用霍纳法计算多项式在x处的值
+func evaluatePolynomial(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = gfMul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// CombineShares 使用拉格朗日插值从共享中还原秘密。
+// 共享数量少于阈值时不会报错，但得到的结果是错误的，调用方应校验还原出的秘密。
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+
+	length := len(shares[0])
+	if length < 2 {
+		return nil, errors.New("invalid share")
+	}
+
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != length {
+			return nil, errors.New("shares have different lengths")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("invalid or duplicate share")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, length-1)
+	for j := range secret {
+		var value byte
+		for i, si := range shares {
+			// 拉格朗日基多项式在0处的值: prod(xm / (xm - xi))，GF(2^8)中减法即异或
+			basis := byte(1)
+			for m, sm := range shares {
+				if m == i {
+					continue
+				}
+				basis = gfMul(basis, gfDiv(sm[0], sm[0]^si[0]))
+			}
+			value ^= gfMul(si[j+1], basis)
+		}
+		secret[j] = value
+	}
+
+	return secret, nil
+}
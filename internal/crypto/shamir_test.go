@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombineSecret(t *testing.T) {
+	secret, _ := GenerateRandomKey()
+
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	// 任意3份都能还原
+	subsets := [][]int{{0, 1, 2}, {0, 2, 4}, {1, 3, 4}, {4, 2, 0}, {0, 1, 2, 3, 4}}
+	for _, subset := range subsets {
+		var selected [][]byte
+		for _, i := range subset {
+			selected = append(selected, shares[i])
+		}
+
+		combined, err := CombineShares(selected)
+		if err != nil {
+			t.Fatalf("Failed to combine shares %v: %v", subset, err)
+		}
+		if !bytes.Equal(combined, secret) {
+			t.Errorf("Shares %v should reconstruct the secret", subset)
+		}
+	}
+
+	// 少于阈值的共享无法还原
+	combined, err := CombineShares(shares[:2])
+	if err == nil && bytes.Equal(combined, secret) {
+		t.Error("Two shares should not reconstruct a 3-of-5 secret")
+	}
+}
+
+func TestSplitSecretInvalidParameters(t *testing.T) {
+	secret := []byte("secret")
+
+	if _, err := SplitSecret(secret, 3, 4); err == nil {
+		t.Error("Should fail when threshold exceeds share count")
+	}
+	if _, err := SplitSecret(secret, 3, 1); err == nil {
+		t.Error("Should fail with threshold below 2")
+	}
+	if _, err := SplitSecret(nil, 3, 2); err == nil {
+		t.Error("Should fail with empty secret")
+	}
+
+	shares, _ := SplitSecret(secret, 3, 2)
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Should fail with duplicate shares")
+	}
+}
+
+func TestSealedBox(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	aad := []byte("owner=1:trustee=2")
+
+	sealed, err := SealTo(publicKey, []byte("share"), aad)
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+
+	opened, err := OpenSealed(privateKey, sealed, aad)
+	if err != nil {
+		t.Fatalf("Failed to open sealed box: %v", err)
+	}
+	if string(opened) != "share" {
+		t.Errorf("Opened data mismatch. Got: %s", opened)
+	}
+
+	_, otherPrivate, _ := GenerateKeyPair()
+	if _, err := OpenSealed(otherPrivate, sealed, aad); err == nil {
+		t.Error("Sealed box should not open with another private key")
+	}
+
+	if _, err := OpenSealed(privateKey, sealed, []byte("owner=1:trustee=3")); err == nil {
+		t.Error("Sealed box should not open with different associated data")
+	}
+}
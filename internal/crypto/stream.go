@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 大文件的流式加密格式: 头部 "GPS" | 版本 | 算法，随后是逐块加密的密文。
+// 明文按 StreamChunkSize 分块，每块的 nonce 由块序号和末块标志组成，
+// 附加数据为头部 || 调用方AAD，因此块被重排、截断或拼接都会导致解密失败。
+// 每个文件必须使用独立的随机密钥，nonce 不含随机部分
+
+const (
+	// StreamChunkSize 流式加密的明文分块大小
+	StreamChunkSize = 64 * 1024
+	// StreamVersion 流式密文的格式版本
+	StreamVersion byte = 1
+
+	streamMagic = "GPS"
+)
+
+var (
+	// ErrStreamCorrupt 流式密文被篡改、截断或使用了错误的密钥
+	ErrStreamCorrupt = errors.New("encrypted stream is corrupt or truncated")
+)
+
+// streamHeader 返回流式密文头部
+func streamHeader(alg Algorithm) []byte {
+	return append([]byte(streamMagic), StreamVersion, byte(alg))
+}
+
+// streamNonce 由块序号和末块标志生成 nonce
+func streamNonce(nonce []byte, counter uint64, last bool) []byte {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// streamReader 按块处理数据，预读一个字节以判断当前块是否为最后一块
+type streamReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	nonce   []byte
+	counter uint64
+	// in 当前块的输入缓冲，长度为块大小加一字节预读
+	in      []byte
+	pending int
+	out     []byte
+	done    bool
+	err     error
+	process func(last bool, chunk []byte) ([]byte, error)
+}
+
+// Read 实现 io.Reader
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.fill()
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// fill 读取并处理下一块
+func (s *streamReader) fill() {
+	n, err := io.ReadFull(s.src, s.in[s.pending:])
+	s.pending += n
+	last := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		s.err = err
+		return
+	}
+
+	size := len(s.in) - 1
+	if last {
+		size = s.pending
+	}
+	out, err := s.process(last, s.in[:size])
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.counter++
+	s.out = out
+
+	s.pending = copy(s.in, s.in[size:s.pending])
+	s.done = last
+}
+
+// NewEncryptReader 返回读取 src 明文的流式密文的 Reader，aad 将密文绑定到调用方的上下文
+func NewEncryptReader(src io.Reader, key, aad []byte) (io.Reader, error) {
+	alg := DefaultAlgorithm
+	aead, err := newAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := streamHeader(alg)
+	s := &streamReader{
+		src:   src,
+		aead:  aead,
+		aad:   append(header, aad...),
+		nonce: make([]byte, aead.NonceSize()),
+		in:    make([]byte, StreamChunkSize+1),
+		out:   header,
+	}
+	sealed := make([]byte, 0, StreamChunkSize+aead.Overhead())
+	s.process = func(last bool, chunk []byte) ([]byte, error) {
+		return s.aead.Seal(sealed[:0], streamNonce(s.nonce, s.counter, last), chunk, s.aad), nil
+	}
+	return s, nil
+}
+
+// NewDecryptReader 返回读取 src 流式密文的明文的 Reader。
+// 只有最后一块验证通过后才返回 io.EOF，截断的密文返回 ErrStreamCorrupt
+func NewDecryptReader(src io.Reader, key, aad []byte) (io.Reader, error) {
+	header := make([]byte, len(streamMagic)+2)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, ErrStreamCorrupt
+	}
+	if !bytes.Equal(header[:len(streamMagic)], []byte(streamMagic)) || header[len(streamMagic)] != StreamVersion {
+		return nil, ErrUnsupportedEnvelope
+	}
+	aead, err := newAEAD(Algorithm(header[len(streamMagic)+1]), key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &streamReader{
+		src:   src,
+		aead:  aead,
+		aad:   append(header, aad...),
+		nonce: make([]byte, aead.NonceSize()),
+		in:    make([]byte, StreamChunkSize+aead.Overhead()+1),
+	}
+	opened := make([]byte, 0, StreamChunkSize)
+	s.process = func(last bool, chunk []byte) ([]byte, error) {
+		plaintext, err := s.aead.Open(opened[:0], streamNonce(s.nonce, s.counter, last), chunk, s.aad)
+		if err != nil {
+			return nil, ErrStreamCorrupt
+		}
+		return plaintext, nil
+	}
+	return s, nil
+}
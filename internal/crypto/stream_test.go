@@ -0,0 +1,132 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// encryptStream 加密 plaintext 并返回完整的流式密文
+func encryptStream(t *testing.T, plaintext, key, aad []byte) []byte {
+	r, err := NewEncryptReader(bytes.NewReader(plaintext), key, aad)
+	if err != nil {
+		t.Fatalf("Failed to create encrypt reader: %v", err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to encrypt stream: %v", err)
+	}
+	return ciphertext
+}
+
+// decryptStream 解密完整的流式密文
+func decryptStream(ciphertext, key, aad []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), key, aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key, _ := GenerateRandomKey()
+	aad := []byte("attachment:1")
+
+	for _, size := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 5} {
+		plaintext, _ := RandomBytes(size)
+		ciphertext := encryptStream(t, plaintext, key, aad)
+
+		decrypted, err := decryptStream(ciphertext, key, aad)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Decrypted %d bytes do not match plaintext", size)
+		}
+	}
+}
+
+func TestStreamSmallReads(t *testing.T) {
+	key, _ := GenerateRandomKey()
+	plaintext, _ := RandomBytes(2*StreamChunkSize + 100)
+
+	// 逐字节读取明文和密文
+	ciphertext := encryptStream(t, plaintext, key, nil)
+	r, _ := NewEncryptReader(bytes.NewReader(plaintext), key, nil)
+	var streamed bytes.Buffer
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		streamed.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+	}
+	if !bytes.Equal(streamed.Bytes(), ciphertext) {
+		t.Error("Ciphertext read byte by byte should match")
+	}
+
+	d, err := NewDecryptReader(&streamed, key, nil)
+	if err != nil {
+		t.Fatalf("Failed to create decrypt reader: %v", err)
+	}
+	var decrypted bytes.Buffer
+	for {
+		n, err := d.Read(buf)
+		decrypted.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to decrypt: %v", err)
+		}
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Error("Decrypted data does not match plaintext")
+	}
+}
+
+func TestStreamRejectsTampering(t *testing.T) {
+	key, _ := GenerateRandomKey()
+	otherKey, _ := GenerateRandomKey()
+	aad := []byte("attachment:1")
+	plaintext, _ := RandomBytes(2*StreamChunkSize + 10)
+	ciphertext := encryptStream(t, plaintext, key, aad)
+	chunk := StreamChunkSize + 16
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[len(flipped)-1] ^= 1
+
+	// 删除中间的一块
+	header := len(streamMagic) + 2
+	dropped := append(bytes.Clone(ciphertext[:header+chunk]), ciphertext[header+2*chunk:]...)
+
+	cases := map[string]struct {
+		ciphertext []byte
+		key        []byte
+		aad        []byte
+	}{
+		"Wrong key":              {ciphertext, otherKey, aad},
+		"Wrong AAD":              {ciphertext, key, []byte("attachment:2")},
+		"Flipped bit":            {flipped, key, aad},
+		"Truncated at chunk":     {ciphertext[:header+2*chunk], key, aad},
+		"Truncated inside chunk": {ciphertext[:header+chunk+100], key, aad},
+		"Dropped chunk":          {dropped, key, aad},
+		"Header only":            {ciphertext[:header], key, aad},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decryptStream(c.ciphertext, c.key, c.aad); err != ErrStreamCorrupt {
+				t.Errorf("Expected ErrStreamCorrupt, got %v", err)
+			}
+		})
+	}
+
+	if _, err := decryptStream([]byte("not a stream"), key, aad); err != ErrUnsupportedEnvelope {
+		t.Errorf("Expected ErrUnsupportedEnvelope, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -13,7 +14,7 @@ var DB *sql.DB
 // InitDB 初始化数据库连接
 func InitDB(dataSourceName string) error {
 	var err error
-	DB, err = sql.Open("sqlite3", dataSourceName)
+	DB, err = sql.Open("sqlite3", withForeignKeys(dataSourceName))
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
@@ -26,6 +27,19 @@ func InitDB(dataSourceName string) error {
 	return createTables()
 }
 
+// withForeignKeys 在连接串中开启外键约束。
+// SQLite 的 foreign_keys 设置只对单个连接生效，写在连接串里才能覆盖连接池中的每个连接
+func withForeignKeys(dataSourceName string) string {
+	if strings.Contains(dataSourceName, "_foreign_keys=") || strings.Contains(dataSourceName, "_fk=") {
+		return dataSourceName
+	}
+	separator := "?"
+	if strings.Contains(dataSourceName, "?") {
+		separator = "&"
+	}
+	return dataSourceName + separator + "_foreign_keys=on"
+}
+
 // createTables 创建数据库表
 func createTables() error {
 	queries := []string{
@@ -34,6 +48,24 @@ func createTables() error {
 			username TEXT UNIQUE NOT NULL,
 			password_hash TEXT NOT NULL,
 			email TEXT UNIQUE NOT NULL,
+			kdf_salt TEXT,
+			kdf_params TEXT,
+			vault_key TEXT,
+			vault_key_id TEXT,
+			recovery_key TEXT,
+			public_key TEXT,
+			private_key TEXT,
+			totp_secret TEXT,
+			totp_enabled INTEGER NOT NULL DEFAULT 0,
+			totp_last_counter INTEGER NOT NULL DEFAULT 0,
+			failed_logins INTEGER NOT NULL DEFAULT 0,
+			locked_until DATETIME,
+			vault_format INTEGER NOT NULL DEFAULT 0,
+			key_generation INTEGER NOT NULL DEFAULT 1,
+			pending_vault_key TEXT,
+			auth_source TEXT NOT NULL DEFAULT 'local',
+			webauthn_handle TEXT UNIQUE,
+			email_verified_at DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -49,19 +81,181 @@ func createTables() error {
 		`CREATE TABLE IF NOT EXISTS passwords (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			user_id INTEGER NOT NULL,
+			item_type TEXT NOT NULL DEFAULT 'login',
 			title TEXT NOT NULL,
 			website TEXT,
 			username TEXT,
 			password TEXT NOT NULL,
 			category TEXT,
 			notes TEXT,
+			totp_secret TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			custom_fields TEXT NOT NULL DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
+		`CREATE TABLE IF NOT EXISTS server_keys (
+			name TEXT PRIMARY KEY,
+			wrapped_key TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			refresh_token_hash TEXT NOT NULL,
+			previous_token_hash TEXT,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip_address TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			last_used_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS mfa_backup_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS webauthn_credentials (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			credential_id TEXT UNIQUE NOT NULL,
+			public_key BLOB NOT NULL,
+			sign_count INTEGER NOT NULL DEFAULT 0,
+			aaguid TEXT NOT NULL DEFAULT '',
+			transports TEXT NOT NULL DEFAULT '[]',
+			created_at DATETIME NOT NULL,
+			last_used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS email_tokens (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			purpose TEXT NOT NULL,
+			email TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS login_devices (
+			user_id INTEGER NOT NULL,
+			device_hash TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			first_seen_at DATETIME NOT NULL,
+			last_seen_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, device_hash),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL,
+			vault_key TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			categories TEXT NOT NULL DEFAULT '[]',
+			expires_at DATETIME,
+			created_at DATETIME NOT NULL,
+			last_used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS oidc_identities (
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (issuer, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS jwt_keys (
+			kid TEXT PRIMARY KEY,
+			algorithm TEXT NOT NULL,
+			active INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			retired_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS emergency_grants (
+			owner_id INTEGER PRIMARY KEY,
+			threshold INTEGER NOT NULL,
+			wait_hours INTEGER NOT NULL,
+			key_id TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS emergency_shares (
+			owner_id INTEGER NOT NULL,
+			trustee_id INTEGER NOT NULL,
+			share TEXT NOT NULL,
+			PRIMARY KEY (owner_id, trustee_id),
+			FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (trustee_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS emergency_requests (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			owner_id INTEGER NOT NULL,
+			requester_id INTEGER NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			available_at DATETIME NOT NULL,
+			decided_at DATETIME,
+			FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS emergency_approvals (
+			request_id INTEGER NOT NULL,
+			trustee_id INTEGER NOT NULL,
+			share TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (request_id, trustee_id),
+			FOREIGN KEY (request_id) REFERENCES emergency_requests(id) ON DELETE CASCADE,
+			FOREIGN KEY (trustee_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS password_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			password_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			password TEXT NOT NULL,
+			replaced_at DATETIME NOT NULL,
+			FOREIGN KEY (password_id) REFERENCES passwords(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			password_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			file_key TEXT NOT NULL,
+			storage TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (password_id) REFERENCES passwords(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS attachment_blobs (
+			attachment_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (attachment_id, seq)
+		)`,
 		`CREATE INDEX IF NOT EXISTS idx_passwords_user_id ON passwords(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_passwords_category ON passwords(category)`,
 		`CREATE INDEX IF NOT EXISTS idx_categories_user_id ON categories(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_password_history_password_id ON password_history(password_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_password_id ON attachments(password_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments(user_id)`,
 	}
 
 	for _, query := range queries {
@@ -70,10 +264,91 @@ func createTables() error {
 		}
 	}
 
+	if err := migrateTables(); err != nil {
+		return err
+	}
+
 	log.Println("Database tables created successfully")
 	return nil
 }
 
+// migrateTables 为旧版本数据库补充新增的列
+func migrateTables() error {
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"users", "kdf_salt", "TEXT"},
+		{"users", "kdf_params", "TEXT"},
+		{"users", "vault_key", "TEXT"},
+		{"users", "vault_key_id", "TEXT"},
+		{"users", "vault_format", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "key_generation", "INTEGER NOT NULL DEFAULT 1"},
+		{"users", "pending_vault_key", "TEXT"},
+		{"users", "recovery_key", "TEXT"},
+		{"users", "public_key", "TEXT"},
+		{"users", "private_key", "TEXT"},
+		{"users", "totp_secret", "TEXT"},
+		{"users", "totp_enabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "totp_last_counter", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "failed_logins", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "locked_until", "DATETIME"},
+		{"users", "auth_source", "TEXT NOT NULL DEFAULT 'local'"},
+		{"users", "webauthn_handle", "TEXT"},
+		{"users", "email_verified_at", "DATETIME"},
+		{"passwords", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"passwords", "item_type", "TEXT NOT NULL DEFAULT 'login'"},
+		{"passwords", "payload", "TEXT NOT NULL DEFAULT ''"},
+		{"passwords", "custom_fields", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, col := range columns {
+		exists, err := columnExists(col.table, col.column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect table %s: %v", col.table, err)
+		}
+		if exists {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)
+		if _, err := DB.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", col.table, col.column, err)
+		}
+	}
+
+	// ALTER TABLE 不能添加带 UNIQUE 约束的列，升级的数据库用唯一索引实现与新建表相同的约束
+	if _, err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_webauthn_handle ON users(webauthn_handle)"); err != nil {
+		return fmt.Errorf("failed to create index on users.webauthn_handle: %v", err)
+	}
+
+	return nil
+}
+
+// columnExists 检查表中是否存在指定列
+func columnExists(table, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name, ctype  string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
 // CloseDB 关闭数据库连接
 func CloseDB() error {
 	if DB != nil {
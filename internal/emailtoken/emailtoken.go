@@ -0,0 +1,110 @@
+package emailtoken
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// 邮件中发送的一次性令牌，用于验证邮箱和重置密码。
+// 令牌绑定签发时的邮箱地址，数据库中只保存其SHA-256哈希；同一用途只有最新签发的令牌有效。
+
+// 令牌用途
+const (
+	// PurposeVerify 验证邮箱
+	PurposeVerify = "verify"
+	// PurposeReset 重置登录密码
+	PurposeReset = "reset"
+)
+
+const (
+	// VerifyTTL 邮箱验证链接的有效期
+	VerifyTTL = 48 * time.Hour
+	// ResetTTL 密码重置链接的有效期
+	ResetTTL = time.Hour
+)
+
+// ErrTokenInvalid 令牌不存在、已过期或已使用
+var ErrTokenInvalid = errors.New("email token is invalid or has expired")
+
+// Create 为用户签发新令牌，同一用途尚未使用的旧令牌作废
+func Create(userID int, purpose, email string, ttl time.Duration) (string, error) {
+	raw, err := crypto.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("DELETE FROM email_tokens WHERE user_id = ? AND purpose = ?", userID, purpose); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hashToken(token), userID, purpose, email, now, now.Add(ttl),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// Validate 检查令牌是否有效但不消耗它，返回用户ID和签发时的邮箱
+func Validate(token, purpose string) (int, string, error) {
+	var userID int
+	var email string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT user_id, email, expires_at, used_at FROM email_tokens WHERE token_hash = ? AND purpose = ?",
+		hashToken(token), purpose,
+	).Scan(&userID, &email, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		return 0, "", ErrTokenInvalid
+	}
+	return userID, email, nil
+}
+
+// Consume 校验并消耗令牌，并发提交同一令牌时只有一次成功
+func Consume(token, purpose string) (int, string, error) {
+	userID, email, err := Validate(token, purpose)
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE email_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), hashToken(token),
+	)
+	if err != nil {
+		return 0, "", err
+	}
+	if used, _ := result.RowsAffected(); used == 0 {
+		return 0, "", ErrTokenInvalid
+	}
+	return userID, email, nil
+}
+
+// hashToken 计算令牌的哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"gopass/internal/apitoken"
+	"gopass/internal/authn"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/mfa"
+	"gopass/internal/models"
+	"gopass/internal/session"
+	"gopass/internal/utils"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegenerateRecoveryKey 生成新的恢复密钥，旧恢复密钥随即失效
+func RegenerateRecoveryKey(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	recoveryKey, err := vault.RegenerateRecoveryKey(userID, encryptionKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create recovery key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Recovery key created successfully",
+		Data: map[string]interface{}{
+			"recovery_key": recoveryKey,
+		},
+	})
+}
+
+// ChangePassword 修改主密码，保险库密钥用新密码重新包装，其他会话和个人访问令牌全部失效
+func ChangePassword(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	// 目录账户的密码在目录中修改，登录时再用旧密码重新包装保险库
+	var source string
+	if err := database.DB.QueryRow("SELECT auth_source FROM users WHERE id = ?", userID).Scan(&source); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	if source != authn.SourceLocal {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Password is managed by your directory",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.CurrentPassword) {
+		return
+	}
+
+	if valid, msg := utils.ValidatePassword(req.NewPassword, 8, true); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "新密码不能与当前密码相同",
+		})
+		return
+	}
+
+	if err := vault.ChangePassword(userID, req.CurrentPassword, req.NewPassword); err != nil {
+		vaultError(c, "Failed to change password", err)
+		return
+	}
+
+	// 与通过恢复密钥重置密码相同，个人访问令牌也全部失效
+	revoked, _ := session.RevokeUser(userID, c.GetString("session_id"))
+	tokens, _ := apitoken.RevokeUser(userID)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password changed successfully",
+		Data: map[string]interface{}{
+			"revoked_sessions": revoked,
+			"revoked_tokens":   tokens,
+		},
+	})
+}
+
+// ChangeEmail 修改邮箱，其他会话全部下线
+func ChangeEmail(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	req.Email = utils.SanitizeInput(req.Email)
+	if !utils.ValidateEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "邮箱格式不正确",
+		})
+		return
+	}
+
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND id != ?)", req.Email, userID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	if exists {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Email already exists",
+		})
+		return
+	}
+
+	// 新邮箱需要重新验证
+	_, err = database.DB.Exec("UPDATE users SET email = ?, email_verified_at = NULL, updated_at = ? WHERE id = ?", req.Email, time.Now(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to change email",
+		})
+		return
+	}
+
+	revoked, _ := session.RevokeUser(userID, c.GetString("session_id"))
+
+	if err := sendVerificationEmail(userID, c.GetString("username"), req.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Email changed successfully",
+		Data: map[string]interface{}{
+			"email":            req.Email,
+			"revoked_sessions": revoked,
+		},
+	})
+}
+
+// DeleteAccount 永久删除账户及其全部密码条目和分类。
+// 会话、备用码、紧急访问等关联数据由外键级联删除
+func DeleteAccount(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	// 启用两步验证的账户还需要第二因素
+	enabled, err := mfa.Enabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	if enabled {
+		if err := mfa.Verify(userID, req.Code); err != nil {
+			c.JSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Message: "Invalid verification code",
+			})
+			return
+		}
+	}
+
+	// 附件元数据随账户级联删除，内容需要另外从存储后端清理
+	stored, err := listStoredAttachments(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	err = vault.RemoveTrustee(tx, userID)
+	if err == nil {
+		statements := []string{
+			"DELETE FROM passwords WHERE user_id = ?",
+			"DELETE FROM categories WHERE user_id = ?",
+			"DELETE FROM users WHERE id = ?",
+		}
+		for _, statement := range statements {
+			if _, err = tx.Exec(statement, userID); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete account",
+		})
+		return
+	}
+
+	vault.ForgetUser(userID)
+	removeAttachmentContent(stored)
+	log.Printf("Deleted account of user %d", userID)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Account deleted successfully",
+	})
+}
+
+// verifyPassword 敏感操作前重新验证当前登录密码。
+// 与登录共用限速，会话被盗用时不能借此无限猜测密码
+func verifyPassword(c *gin.Context, userID int, password string) bool {
+	ipKey := c.ClientIP()
+	userKey := usernameKey(c.GetString("username"))
+	if !checkRateLimit(c, loginIPLimiter, ipKey) || !checkRateLimit(c, loginUserLimiter, userKey) {
+		return false
+	}
+
+	var passwordHash string
+	err := database.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&passwordHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return false
+	}
+
+	if !crypto.CheckPasswordHash(password, passwordHash) {
+		loginIPLimiter.Record(ipKey)
+		loginUserLimiter.Record(userKey)
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid credentials",
+		})
+		return false
+	}
+
+	loginUserLimiter.Reset(userKey)
+	return true
+}
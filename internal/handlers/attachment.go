@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopass/internal/attachment"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 新附件写入的存储后端、按名称查找的全部后端和每个用户的附件配额（字节，0 表示不限制）
+var (
+	attachmentStore  attachment.Store = attachment.NewDB()
+	attachmentStores                  = map[string]attachment.Store{attachment.StorageDB: attachmentStore}
+	attachmentQuota  int64            = 100 << 20
+)
+
+// multipartOverhead 上传请求中文件内容以外的部分（表单边界和头部）允许的大小
+const multipartOverhead = 1 << 20
+
+// errQuotaExceeded 上传的文件超出用户剩余的附件配额
+var errQuotaExceeded = errors.New("attachment quota exceeded")
+
+// SetAttachmentStorage 设置新附件写入的存储后端。
+// others 用于读取和删除切换后端前上传的附件，每个附件记录了保存它的后端
+func SetAttachmentStorage(primary attachment.Store, others ...attachment.Store) {
+	attachmentStore = primary
+	attachmentStores = map[string]attachment.Store{primary.Name(): primary}
+	for _, store := range others {
+		attachmentStores[store.Name()] = store
+	}
+}
+
+// SetAttachmentQuota 设置每个用户的附件配额，0 表示不限制
+func SetAttachmentQuota(quota int64) {
+	attachmentQuota = quota
+}
+
+// quotaReader 统计读取的字节数，超出 limit 时返回 errQuotaExceeded
+type quotaReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+// Read 实现 io.Reader
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.read += int64(n)
+	if q.limit > 0 && q.read > q.limit {
+		return n, errQuotaExceeded
+	}
+	return n, err
+}
+
+// storedAttachment 已从数据库删除、需要清理内容的附件
+type storedAttachment struct {
+	id, storage string
+}
+
+// attachmentUsage 返回用户所有附件的总大小
+func attachmentUsage(userID int) (int64, error) {
+	var used int64
+	err := database.DB.QueryRow("SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = ?", userID).Scan(&used)
+	return used, err
+}
+
+// attachmentCounts 返回用户每个条目的附件数量
+func attachmentCounts(userID int) (map[int]int, error) {
+	rows, err := database.DB.Query("SELECT password_id, COUNT(*) FROM attachments WHERE user_id = ? GROUP BY password_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var passwordID, count int
+		if err := rows.Scan(&passwordID, &count); err != nil {
+			return nil, err
+		}
+		counts[passwordID] = count
+	}
+	return counts, rows.Err()
+}
+
+// loadAttachments 读取并解密附件元数据，passwordID 为0时返回用户的全部附件
+func loadAttachments(userID, passwordID int, key []byte) ([]models.Attachment, error) {
+	query := "SELECT id, password_id, name, content_type, size, created_at FROM attachments WHERE user_id = ?"
+	args := []interface{}{userID}
+	if passwordID != 0 {
+		query += " AND password_id = ?"
+		args = append(args, passwordID)
+	}
+	rows, err := database.DB.Query(query+" ORDER BY created_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.PasswordID, &a.Name, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if a.Name, err = vault.DecryptAttachmentField(key, userID, a.ID, "name", a.Name); err != nil {
+			return nil, err
+		}
+		if a.ContentType, err = vault.DecryptAttachmentField(key, userID, a.ID, "content_type", a.ContentType); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// listStoredAttachments 返回即将随条目或账户删除的附件，passwordID 为0时返回用户的全部附件
+func listStoredAttachments(userID, passwordID int) ([]storedAttachment, error) {
+	query := "SELECT id, storage FROM attachments WHERE user_id = ?"
+	args := []interface{}{userID}
+	if passwordID != 0 {
+		query += " AND password_id = ?"
+		args = append(args, passwordID)
+	}
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stored []storedAttachment
+	for rows.Next() {
+		var a storedAttachment
+		if err := rows.Scan(&a.id, &a.storage); err != nil {
+			return nil, err
+		}
+		stored = append(stored, a)
+	}
+	return stored, rows.Err()
+}
+
+// removeAttachmentContent 删除已从数据库移除的附件的内容，失败只记录日志
+func removeAttachmentContent(stored []storedAttachment) {
+	for _, a := range stored {
+		store, ok := attachmentStores[a.storage]
+		if !ok {
+			log.Printf("Attachment %s is stored in unconfigured storage %s", a.id, a.storage)
+			continue
+		}
+		if err := store.Delete(a.id); err != nil {
+			log.Printf("Failed to remove content of attachment %s: %v", a.id, err)
+		}
+	}
+}
+
+// openAttachment 打开附件并返回解密后的内容，调用方负责关闭返回的 Closer
+func openAttachment(key []byte, userID int, id, wrappedKey, storage string) (io.Reader, io.Closer, error) {
+	store, ok := attachmentStores[storage]
+	if !ok {
+		return nil, nil, errors.New("attachment storage " + storage + " is not configured")
+	}
+
+	fileKey, err := vault.OpenAttachmentKey(key, userID, id, wrappedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(fileKey)
+
+	content, err := store.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := crypto.NewDecryptReader(content, fileKey, vault.AttachmentContentAAD(userID, id))
+	if err != nil {
+		content.Close()
+		return nil, nil, err
+	}
+	return plaintext, content, nil
+}
+
+// GetAttachments 获取条目的附件列表和附件配额使用情况
+func GetAttachments(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	passwordID, ok := ownedEntryID(c, userID)
+	if !ok {
+		return
+	}
+
+	attachments, err := loadAttachments(userID, passwordID, encryptionKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	used, err := attachmentUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Attachments retrieved successfully",
+		Data: map[string]interface{}{
+			"attachments": attachments,
+			"used":        used,
+			"quota":       attachmentQuota,
+		},
+	})
+}
+
+// UploadAttachment 上传条目附件。文件以 multipart/form-data 的 file 字段上传，
+// 边接收边加密写入存储后端，不会把整个文件读入内存
+func UploadAttachment(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	passwordID, ok := ownedEntryID(c, userID)
+	if !ok {
+		return
+	}
+
+	used, err := attachmentUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	var remaining int64
+	if attachmentQuota > 0 {
+		remaining = attachmentQuota - used
+		if remaining <= 0 {
+			c.JSON(http.StatusRequestEntityTooLarge, models.APIResponse{
+				Success: false,
+				Message: "Attachment quota exceeded",
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, remaining+multipartOverhead)
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "File must be uploaded as multipart/form-data",
+		})
+		return
+	}
+
+	// 跳过 file 字段之前的其他表单字段
+	part, err := reader.NextPart()
+	for err == nil && part.FormName() != "file" {
+		part, err = reader.NextPart()
+	}
+	if err != nil || part.FileName() == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "No file uploaded",
+		})
+		return
+	}
+	defer part.Close()
+
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(part.FileName(), "\\", "/")))
+	if name == "" || name == "." || name == ".." || name == "/" || len(name) > 255 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid file name",
+		})
+		return
+	}
+	contentType := part.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(contentType); err != nil || len(contentType) > 255 {
+		contentType = "application/octet-stream"
+	}
+
+	id, err := attachment.NewID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save attachment",
+		})
+		return
+	}
+
+	fileKey, wrappedKey, err := vault.NewAttachmentKey(encryptionKey, userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to encrypt attachment",
+		})
+		return
+	}
+	defer crypto.Wipe(fileKey)
+
+	encryptedName, err := vault.EncryptAttachmentField(encryptionKey, userID, id, "name", name)
+	var encryptedType string
+	if err == nil {
+		encryptedType, err = vault.EncryptAttachmentField(encryptionKey, userID, id, "content_type", contentType)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to encrypt attachment",
+		})
+		return
+	}
+
+	counter := &quotaReader{r: part, limit: remaining}
+	ciphertext, err := crypto.NewEncryptReader(counter, fileKey, vault.AttachmentContentAAD(userID, id))
+	if err == nil {
+		_, err = attachmentStore.Put(id, ciphertext)
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, errQuotaExceeded) || errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, models.APIResponse{
+			Success: false,
+			Message: "Attachment quota exceeded",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to store attachment of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save attachment",
+		})
+		return
+	}
+
+	// 同时进行的上传可能共同超出配额，写入元数据时再检查一次
+	now := time.Now()
+	result, err := database.DB.Exec(`
+		INSERT INTO attachments (id, user_id, password_id, name, content_type, size, file_key, storage, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE ? = 0 OR (SELECT COALESCE(SUM(size), 0) FROM attachments WHERE user_id = ?) + ? <= ?`,
+		id, userID, passwordID, encryptedName, encryptedType, counter.read, wrappedKey, attachmentStore.Name(), now,
+		attachmentQuota, userID, counter.read, attachmentQuota,
+	)
+	var inserted int64
+	if err == nil {
+		inserted, err = result.RowsAffected()
+	}
+	if err != nil || inserted == 0 {
+		removeAttachmentContent([]storedAttachment{{id: id, storage: attachmentStore.Name()}})
+		if err == nil {
+			c.JSON(http.StatusRequestEntityTooLarge, models.APIResponse{
+				Success: false,
+				Message: "Attachment quota exceeded",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save attachment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Attachment uploaded successfully",
+		Data: models.Attachment{
+			ID:          id,
+			PasswordID:  passwordID,
+			Name:        name,
+			ContentType: contentType,
+			Size:        counter.read,
+			CreatedAt:   now,
+		},
+	})
+}
+
+// DownloadAttachment 下载并解密附件
+func DownloadAttachment(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	passwordID, ok := ownedEntryID(c, userID)
+	if !ok {
+		return
+	}
+
+	id := c.Param("attachmentId")
+	var name, contentType, wrappedKey, storage string
+	var size int64
+	err := database.DB.QueryRow(
+		"SELECT name, content_type, size, file_key, storage FROM attachments WHERE id = ? AND password_id = ? AND user_id = ?",
+		id, passwordID, userID,
+	).Scan(&name, &contentType, &size, &wrappedKey, &storage)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Attachment not found",
+		})
+		return
+	}
+	if err == nil {
+		name, err = vault.DecryptAttachmentField(encryptionKey, userID, id, "name", name)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	plaintext, closer, err := openAttachment(encryptionKey, userID, id, wrappedKey, storage)
+	if err != nil {
+		log.Printf("Failed to open attachment %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to decrypt attachment",
+		})
+		return
+	}
+	defer closer.Close()
+
+	// 发送响应头前先解密第一块，密钥错误或内容损坏时仍可返回错误
+	buffered := bufio.NewReaderSize(plaintext, crypto.StreamChunkSize)
+	if _, err := buffered.Peek(1); err != nil && err != io.EOF {
+		log.Printf("Failed to decrypt attachment %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to decrypt attachment",
+		})
+		return
+	}
+
+	// 始终作为下载返回，避免上传的 HTML 等文件在本站点内被浏览器执行
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", buffered, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": name}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// DeleteAttachment 删除条目附件
+func DeleteAttachment(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	passwordID, ok := ownedEntryID(c, userID)
+	if !ok {
+		return
+	}
+
+	id := c.Param("attachmentId")
+	var storage string
+	err := database.DB.QueryRow(
+		"SELECT storage FROM attachments WHERE id = ? AND password_id = ? AND user_id = ?", id, passwordID, userID,
+	).Scan(&storage)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Attachment not found",
+		})
+		return
+	}
+	if err == nil {
+		_, err = database.DB.Exec("DELETE FROM attachments WHERE id = ? AND user_id = ?", id, userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete attachment",
+		})
+		return
+	}
+
+	removeAttachmentContent([]storedAttachment{{id: id, storage: storage}})
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Attachment deleted successfully",
+	})
+}
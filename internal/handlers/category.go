@@ -34,7 +34,7 @@ func GetCategories(c *gin.Context) {
 	for rows.Next() {
 		var cat models.Category
 		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.CreatedAt)
-		if err != nil {
+		if err != nil || !tokenAllowsCategory(c, cat.Name) {
 			continue
 		}
 		cat.UserID = userID
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"gopass/internal/authn"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/utils"
+	"gopass/internal/vault"
+)
+
+var (
+	errDirectoryEmailRequired = errors.New("directory account has no email address")
+	errDirectoryEmailTaken    = errors.New("email is already used by another account")
+	errDirectoryUsernameTaken = errors.New("username is already used by a local account")
+)
+
+var (
+	// authenticators 按账户来源验证密码，本地账户始终可用
+	authenticators = map[string]authn.Authenticator{authn.SourceLocal: authn.Local{}}
+	// directory 配置的目录，本地不存在的用户名交给它验证；为nil时只有本地账户
+	directory authn.Authenticator
+)
+
+// SetDirectory 启用目录验证。目录账户由它验证密码，目录中的新用户首次登录时自动创建账户
+func SetDirectory(authenticator authn.Authenticator) {
+	authenticators[authenticator.Source()] = authenticator
+	directory = authenticator
+}
+
+// authenticatorFor 返回验证该账户的后端。用户名在本地不存在时交给目录，
+// 未配置目录时仍由本地验证，以便执行同样耗时的bcrypt比较
+func authenticatorFor(found bool, source string) authn.Authenticator {
+	if found {
+		return authenticators[source]
+	}
+	if directory != nil {
+		return directory
+	}
+	return authn.Local{}
+}
+
+// directoryUser 查找目录用户对应的本地账户，不存在时创建。
+// 新账户没有保险库，首次登录时用目录密码建立
+func directoryUser(source string, identity *authn.Identity) (models.User, sql.NullTime, error) {
+	var user models.User
+	var userSource string
+	var lockedUntil sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT id, username, password_hash, email, auth_source, locked_until FROM users WHERE username = ?",
+		identity.Username,
+	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &userSource, &lockedUntil)
+	if err == nil {
+		// 同名的本地账户不能被目录接管
+		if userSource != source {
+			return user, lockedUntil, errDirectoryUsernameTaken
+		}
+		return user, lockedUntil, nil
+	}
+	if err != sql.ErrNoRows {
+		return user, lockedUntil, err
+	}
+
+	email := utils.SanitizeInput(identity.Email)
+	if email == "" || !utils.ValidateEmail(email) {
+		return user, lockedUntil, errDirectoryEmailRequired
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", email).Scan(&exists); err != nil {
+		return user, lockedUntil, err
+	}
+	if exists {
+		return user, lockedUntil, errDirectoryEmailTaken
+	}
+
+	// 目录中的邮箱由管理员维护，视为已验证
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password_hash, email, email_verified_at, auth_source, vault_format, created_at, updated_at) VALUES (?, '', ?, ?, ?, ?, ?, ?)",
+		identity.Username, email, time.Now().UTC(), source, vault.CurrentFormat, time.Now(), time.Now(),
+	)
+	if err != nil {
+		return user, lockedUntil, err
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return user, lockedUntil, err
+	}
+
+	log.Printf("Provisioned user %s from %s directory", identity.Username, source)
+	return models.User{ID: int(userID), Username: identity.Username, Email: email}, lockedUntil, nil
+}
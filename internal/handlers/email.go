@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopass/internal/apitoken"
+	"gopass/internal/database"
+	"gopass/internal/emailtoken"
+	"gopass/internal/mailer"
+	"gopass/internal/models"
+	"gopass/internal/session"
+	"gopass/internal/utils"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 邮件发送器和邮件中链接指向的站点地址，默认写入服务器日志
+var (
+	mailSender mailer.Mailer = mailer.NewFile("", "GoPass <noreply@localhost>")
+	publicURL                = "http://localhost:8080"
+)
+
+// SetMailer 设置邮件发送器和站点地址
+func SetMailer(m mailer.Mailer, baseURL string) {
+	mailSender = m
+	publicURL = strings.TrimRight(baseURL, "/")
+}
+
+// sendMail 在后台发送邮件，失败只记录日志，不影响请求结果
+func sendMail(msg mailer.Message) {
+	go func() {
+		if err := mailSender.Send(msg); err != nil {
+			log.Printf("Failed to send mail to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+// sendVerificationEmail 签发邮箱验证令牌并发送验证链接
+func sendVerificationEmail(userID int, username, email string) error {
+	token, err := emailtoken.Create(userID, emailtoken.PurposeVerify, email, emailtoken.VerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	sendMail(mailer.Message{
+		To:      email,
+		Subject: "GoPass 邮箱验证",
+		Body: fmt.Sprintf(
+			"%s，您好：\n\n请打开以下链接验证您的邮箱，链接 %d 小时内有效：\n\n%s/#verify_email=%s\n\n验证后才能通过邮件重置密码和接收新设备登录提醒。如果这不是您的操作，请忽略本邮件。\n",
+			username, int(emailtoken.VerifyTTL.Hours()), publicURL, token,
+		),
+	})
+	return nil
+}
+
+// emailVerified 查询用户邮箱是否已验证
+func emailVerified(userID int) (bool, error) {
+	var verifiedAt sql.NullTime
+	err := database.DB.QueryRow("SELECT email_verified_at FROM users WHERE id = ?", userID).Scan(&verifiedAt)
+	return verifiedAt.Valid, err
+}
+
+// notifyNewDevice 记录登录设备，在已验证的邮箱收到新设备登录提醒
+func notifyNewDevice(user models.User, verified bool, userAgent, ip string) {
+	isNew, err := session.RecordDevice(user.ID, userAgent)
+	if err != nil {
+		log.Printf("Failed to record login device of user %d: %v", user.ID, err)
+		return
+	}
+	if !isNew || !verified {
+		return
+	}
+
+	if userAgent == "" {
+		userAgent = "未知"
+	}
+	sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "GoPass 新设备登录提醒",
+		Body: fmt.Sprintf(
+			"%s，您好：\n\n您的账户刚刚在一台新设备上登录：\n\n时间：%s\nIP地址：%s\n设备：%s\n\n如果这不是您本人的操作，请立即修改密码并在“会话管理”中注销该设备。\n",
+			user.Username, time.Now().UTC().Format("2006-01-02 15:04:05 MST"), ip, userAgent,
+		),
+	})
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱
+func VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	userID, email, err := emailtoken.Consume(req.Token, emailtoken.PurposeVerify)
+	if err == emailtoken.ErrTokenInvalid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Verification link is invalid or has expired",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	// 签发后邮箱已修改，令牌验证的是旧地址
+	result, err := database.DB.Exec(
+		"UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ?", time.Now().UTC(), userID, email,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Verification link is invalid or has expired",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Email verified successfully",
+		Data: map[string]interface{}{
+			"email": email,
+		},
+	})
+}
+
+// ResendVerificationEmail 重新发送邮箱验证链接
+func ResendVerificationEmail(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var username, email string
+	var verifiedAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT username, email, email_verified_at FROM users WHERE id = ?", userID,
+	).Scan(&username, &email, &verifiedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	if verifiedAt.Valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Email is already verified",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, mailLimiter, emailKey(email)) {
+		return
+	}
+	mailLimiter.Record(emailKey(email))
+
+	if err := sendVerificationEmail(userID, username, email); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to send verification email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Verification email sent",
+	})
+}
+
+// RequestPasswordReset 向已验证的邮箱发送重置密码链接。
+// 无论邮箱是否存在都返回相同的响应，避免泄露注册信息
+func RequestPasswordReset(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	req.Email = utils.SanitizeInput(req.Email)
+	if !utils.ValidateEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "邮箱格式不正确",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, mailLimiter, c.ClientIP()) || !checkRateLimit(c, mailLimiter, emailKey(req.Email)) {
+		return
+	}
+	mailLimiter.Record(c.ClientIP())
+	mailLimiter.Record(emailKey(req.Email))
+
+	// 目录账户的密码由目录管理，不能在这里重置。邮箱不区分大小写，邮件发往账户中保存的地址
+	var userID int
+	var username, email string
+	err := database.DB.QueryRow(
+		"SELECT id, username, email FROM users WHERE email = ? COLLATE NOCASE AND auth_source = 'local' AND email_verified_at IS NOT NULL",
+		req.Email,
+	).Scan(&userID, &username, &email)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	if err == nil {
+		token, err := emailtoken.Create(userID, emailtoken.PurposeReset, email, emailtoken.ResetTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+			})
+			return
+		}
+
+		sendMail(mailer.Message{
+			To:      email,
+			Subject: "GoPass 重置密码",
+			Body: fmt.Sprintf(
+				"%s，您好：\n\n我们收到了重置您登录密码的请求。请打开以下链接，并输入注册时获得的恢复密钥设置新密码，链接 %d 分钟内有效：\n\n%s/#reset_token=%s\n\n保险库使用恢复密钥加密，没有恢复密钥无法重置密码。如果这不是您的操作，请忽略本邮件，您的密码不会改变。\n",
+				username, int(emailtoken.ResetTTL.Minutes()), publicURL, token,
+			),
+		})
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "If the email belongs to a verified account, a reset link has been sent",
+	})
+}
+
+// ConfirmPasswordReset 使用邮件中的令牌和恢复密钥重置登录密码
+func ConfirmPasswordReset(c *gin.Context) {
+	var req models.PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, recoverLimiter, c.ClientIP()) {
+		return
+	}
+
+	if valid, msg := utils.ValidatePassword(req.NewPassword, 8, true); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	userID, email, err := emailtoken.Validate(req.Token, emailtoken.PurposeReset)
+	if err == emailtoken.ErrTokenInvalid {
+		recoverLimiter.Record(c.ClientIP())
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Reset link is invalid or has expired",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	// 签发后邮箱已修改时令牌作废
+	var username string
+	err = database.DB.QueryRow("SELECT username FROM users WHERE id = ? AND email = ?", userID, email).Scan(&username)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Reset link is invalid or has expired",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	// 与使用用户名找回共享每个账户的尝试次数
+	if !checkRateLimit(c, recoverLimiter, usernameKey(username)) {
+		return
+	}
+
+	err = vault.ResetPassword(userID, req.RecoveryKey, req.NewPassword)
+	if err == vault.ErrWrongRecoveryKey {
+		recoverLimiter.Record(c.ClientIP())
+		recoverLimiter.Record(usernameKey(username))
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid recovery key",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	// 恢复密钥输错时链接仍可使用，密码重置成功后才消耗令牌
+	emailtoken.Consume(req.Token, emailtoken.PurposeReset)
+
+	session.RevokeUser(userID, "")
+	apitoken.RevokeUser(userID)
+	resetLoginFailures(userID)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password reset successfully",
+	})
+}
+
+// emailKey 邮箱限速键，忽略大小写和首尾空格
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,710 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 紧急访问流程：
+//  1. 用户指定受托人和门限K，保险库密钥被拆分为N份分别密封给受托人
+//  2. 任一受托人可发起申请，等待期内用户可以否决
+//  3. 受托人批准时将自己的共享转密封给申请人
+//  4. 等待期结束且批准数达到K后，申请人可还原保险库密钥并读取条目
+
+// SetupEmergencyAccess 设置（或替换）当前用户的紧急访问受托人
+func SetupEmergencyAccess(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.EmergencyAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	trusteeIDs, msg := resolveTrustees(userID, req.Trustees)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	if req.Threshold < 2 || req.Threshold > len(trusteeIDs) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Threshold must be between 2 and the number of trustees",
+		})
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := vault.DistributeShares(tx, userID, encryptionKey, trusteeIDs, req.Threshold); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to distribute key shares",
+		})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO emergency_grants (owner_id, threshold, wait_hours, key_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT(owner_id) DO UPDATE SET
+			threshold = excluded.threshold,
+			wait_hours = excluded.wait_hours,
+			key_id = excluded.key_id,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, req.Threshold, req.WaitHours, crypto.KeyID(encryptionKey),
+	)
+	if err == nil {
+		// 受托人变更后，进行中的申请不再有效
+		_, err = tx.Exec("UPDATE emergency_requests SET status = 'cancelled', decided_at = CURRENT_TIMESTAMP WHERE owner_id = ? AND status IN ('pending', 'granted')", userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save emergency access",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Emergency access configured successfully",
+		Data: map[string]interface{}{
+			"trustees":   req.Trustees,
+			"threshold":  req.Threshold,
+			"wait_hours": req.WaitHours,
+		},
+	})
+}
+
+// GetEmergencyAccess 获取当前用户的紧急访问设置及针对自己的申请
+func GetEmergencyAccess(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var threshold, waitHours int
+	err := database.DB.QueryRow("SELECT threshold, wait_hours FROM emergency_grants WHERE owner_id = ?", userID).Scan(&threshold, &waitHours)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Emergency access is not configured",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	trustees := []string{}
+	rows, err := database.DB.Query(`
+		SELECT u.username FROM emergency_shares s JOIN users u ON u.id = s.trustee_id
+		WHERE s.owner_id = ? ORDER BY u.username`, userID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var username string
+			if rows.Scan(&username) == nil {
+				trustees = append(trustees, username)
+			}
+		}
+	}
+
+	requests, err := queryEmergencyRequests("r.owner_id = ?", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Emergency access retrieved successfully",
+		Data: map[string]interface{}{
+			"trustees":   trustees,
+			"threshold":  threshold,
+			"wait_hours": waitHours,
+			"requests":   requests,
+		},
+	})
+}
+
+// DeleteEmergencyAccess 取消紧急访问，销毁所有受托人持有的共享
+func DeleteEmergencyAccess(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM emergency_shares WHERE owner_id = ?",
+		"DELETE FROM emergency_grants WHERE owner_id = ?",
+		"UPDATE emergency_requests SET status = 'cancelled', decided_at = CURRENT_TIMESTAMP WHERE owner_id = ? AND status IN ('pending', 'granted')",
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement, userID); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete emergency access",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Emergency access deleted successfully",
+	})
+}
+
+// GetTrustedOwners 获取将当前用户设为受托人的用户及相关申请
+func GetTrustedOwners(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT u.username, g.threshold, g.wait_hours
+		FROM emergency_shares s
+		JOIN emergency_grants g ON g.owner_id = s.owner_id
+		JOIN users u ON u.id = s.owner_id
+		WHERE s.trustee_id = ? ORDER BY u.username`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer rows.Close()
+
+	owners := []map[string]interface{}{}
+	for rows.Next() {
+		var username string
+		var threshold, waitHours int
+		if err := rows.Scan(&username, &threshold, &waitHours); err != nil {
+			continue
+		}
+		owners = append(owners, map[string]interface{}{
+			"owner":      username,
+			"threshold":  threshold,
+			"wait_hours": waitHours,
+		})
+	}
+
+	requests, err := queryEmergencyRequests(
+		"r.owner_id IN (SELECT owner_id FROM emergency_shares WHERE trustee_id = ?)", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Trusted owners retrieved successfully",
+		Data: map[string]interface{}{
+			"owners":   owners,
+			"requests": requests,
+		},
+	})
+}
+
+// CreateEmergencyRequest 受托人发起紧急访问申请，等待期从此刻开始计算
+func CreateEmergencyRequest(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.EmergencyRequestCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	var ownerID, waitHours int
+	err := database.DB.QueryRow(`
+		SELECT g.owner_id, g.wait_hours
+		FROM emergency_grants g
+		JOIN users u ON u.id = g.owner_id
+		JOIN emergency_shares s ON s.owner_id = g.owner_id AND s.trustee_id = ?
+		WHERE u.username = ?`, userID, req.Owner).Scan(&ownerID, &waitHours)
+	if err != nil {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "You are not a trustee of this user",
+		})
+		return
+	}
+
+	var exists bool
+	database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM emergency_requests WHERE owner_id = ? AND requester_id = ? AND status IN ('pending', 'granted'))",
+		ownerID, userID,
+	).Scan(&exists)
+	if exists {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "An emergency request for this user is already open",
+		})
+		return
+	}
+
+	availableAt := time.Now().UTC().Add(time.Duration(waitHours) * time.Hour)
+	result, err := database.DB.Exec(
+		"INSERT INTO emergency_requests (owner_id, requester_id, available_at) VALUES (?, ?, ?)",
+		ownerID, userID, availableAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create emergency request",
+		})
+		return
+	}
+
+	requestID, _ := result.LastInsertId()
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Emergency request created successfully",
+		Data: map[string]interface{}{
+			"id":           requestID,
+			"available_at": availableAt,
+		},
+	})
+}
+
+// ApproveEmergencyRequest 受托人批准申请，将自己的共享转交给申请人
+func ApproveEmergencyRequest(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	request := getEmergencyRequest(c)
+	if request == nil {
+		return
+	}
+
+	if request.Status != "pending" {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Emergency request is no longer pending",
+		})
+		return
+	}
+
+	var sealed string
+	err := database.DB.QueryRow(
+		"SELECT share FROM emergency_shares WHERE owner_id = ? AND trustee_id = ?",
+		request.OwnerID, userID,
+	).Scan(&sealed)
+	if err != nil {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "You are not a trustee of this user",
+		})
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	share, err := vault.OpenShare(request.OwnerID, userID, encryptionKey, sealed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to open key share",
+		})
+		return
+	}
+	defer crypto.Wipe(share)
+
+	requesterKey, err := vault.PublicKey(database.DB, request.RequesterID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Requester has no key pair",
+		})
+		return
+	}
+
+	approval, err := vault.SealApproval(request.ID, userID, requesterKey, share)
+	if err == nil {
+		_, err = database.DB.Exec(
+			"INSERT OR REPLACE INTO emergency_approvals (request_id, trustee_id, share) VALUES (?, ?, ?)",
+			request.ID, userID, approval,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to approve emergency request",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Emergency request approved successfully",
+	})
+}
+
+// DenyEmergencyRequest 用户否决针对自己的申请，已授予的访问也会被撤销
+func DenyEmergencyRequest(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	request := getEmergencyRequest(c)
+	if request == nil {
+		return
+	}
+
+	if request.OwnerID != userID {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Only the vault owner can deny an emergency request",
+		})
+		return
+	}
+
+	if request.Status != "pending" && request.Status != "granted" {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Emergency request is already closed",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE emergency_requests SET status = 'denied', decided_at = CURRENT_TIMESTAMP WHERE id = ?", request.ID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM emergency_approvals WHERE request_id = ?", request.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to deny emergency request",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Emergency request denied successfully",
+	})
+}
+
+// GetEmergencyVault 申请人在等待期结束且批准数达到门限后读取用户的条目
+func GetEmergencyVault(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	request := getEmergencyRequest(c)
+	if request == nil {
+		return
+	}
+
+	if request.RequesterID != userID {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Only the requester can access the vault",
+		})
+		return
+	}
+
+	if request.Status != "pending" && request.Status != "granted" {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Emergency request is " + request.Status,
+		})
+		return
+	}
+
+	if time.Now().Before(request.AvailableAt) {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Waiting period has not ended yet",
+			Data: map[string]interface{}{
+				"available_at": request.AvailableAt,
+			},
+		})
+		return
+	}
+
+	if request.Approvals < request.Threshold {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Not enough approvals (%d of %d)", request.Approvals, request.Threshold),
+		})
+		return
+	}
+
+	var keyID string
+	if err := database.DB.QueryRow("SELECT key_id FROM emergency_grants WHERE owner_id = ?", request.OwnerID).Scan(&keyID); err != nil {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Emergency access has been revoked",
+		})
+		return
+	}
+
+	approvals := make(map[int]string)
+	rows, err := database.DB.Query("SELECT trustee_id, share FROM emergency_approvals WHERE request_id = ?", request.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	for rows.Next() {
+		var trusteeID int
+		var share string
+		if rows.Scan(&trusteeID, &share) == nil {
+			approvals[trusteeID] = share
+		}
+	}
+	rows.Close()
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	ownerKey, err := vault.ReconstructVaultKey(request.ID, userID, encryptionKey, approvals, keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reconstruct vault key",
+		})
+		return
+	}
+	defer crypto.Wipe(ownerKey)
+
+	// 状态必须先记录为已授权，所有者才能看到保险库已被访问
+	if request.Status == "pending" {
+		_, err = database.DB.Exec("UPDATE emergency_requests SET status = 'granted', decided_at = CURRENT_TIMESTAMP WHERE id = ?", request.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to grant emergency access",
+			})
+			return
+		}
+	}
+
+	rows, err = database.DB.Query("SELECT "+passwordColumns+" FROM passwords WHERE user_id = ? ORDER BY created_at DESC", request.OwnerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer rows.Close()
+
+	var passwords []models.Password
+	for rows.Next() {
+		var p models.Password
+		if err := scanPassword(rows, &p); err != nil {
+			continue
+		}
+
+		if err := vault.DecryptEntry(ownerKey, request.OwnerID, &p); err != nil {
+			passwords = append(passwords, undecryptableEntry(request.OwnerID, p, err))
+			continue
+		}
+		p.UserID = request.OwnerID
+
+		passwords = append(passwords, p)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Emergency vault retrieved successfully",
+		Data:    passwords,
+	})
+}
+
+// resolveTrustees 将受托人用户名解析为用户ID，出错时返回错误信息
+func resolveTrustees(ownerID int, usernames []string) ([]int, string) {
+	seen := make(map[string]bool)
+	var trusteeIDs []int
+	for _, username := range usernames {
+		username = strings.TrimSpace(username)
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+
+		var trusteeID int
+		err := database.DB.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&trusteeID)
+		if err != nil {
+			return nil, "Unknown trustee: " + username
+		}
+		if trusteeID == ownerID {
+			return nil, "You cannot be your own trustee"
+		}
+		if _, err := vault.PublicKey(database.DB, trusteeID); err != nil {
+			return nil, "Trustee has not logged in since emergency access was introduced: " + username
+		}
+		trusteeIDs = append(trusteeIDs, trusteeID)
+	}
+	return trusteeIDs, ""
+}
+
+// getEmergencyRequest 读取路径中指定的申请，当前用户必须是该用户本人或其受托人
+func getEmergencyRequest(c *gin.Context) *models.EmergencyRequest {
+	userID := getUserID(c)
+
+	requestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request ID",
+		})
+		return nil
+	}
+
+	requests, err := queryEmergencyRequests(
+		"r.id = ? AND (r.owner_id = ? OR r.owner_id IN (SELECT owner_id FROM emergency_shares WHERE trustee_id = ?) OR r.requester_id = ?)",
+		requestID, userID, userID, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return nil
+	}
+	if len(requests) == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Emergency request not found",
+		})
+		return nil
+	}
+	return &requests[0]
+}
+
+// queryEmergencyRequests 按条件查询紧急访问申请及其批准数
+func queryEmergencyRequests(condition string, args ...interface{}) ([]models.EmergencyRequest, error) {
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.owner_id, o.username, r.requester_id, q.username, r.status,
+			(SELECT COUNT(*) FROM emergency_approvals a WHERE a.request_id = r.id),
+			COALESCE((SELECT threshold FROM emergency_grants g WHERE g.owner_id = r.owner_id), 0),
+			r.created_at, r.available_at
+		FROM emergency_requests r
+		JOIN users o ON o.id = r.owner_id
+		JOIN users q ON q.id = r.requester_id
+		WHERE `+condition+` ORDER BY r.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.EmergencyRequest{}
+	for rows.Next() {
+		var r models.EmergencyRequest
+		err := rows.Scan(&r.ID, &r.OwnerID, &r.Owner, &r.RequesterID, &r.Requester, &r.Status,
+			&r.Approvals, &r.Threshold, &r.CreatedAt, &r.AvailableAt)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
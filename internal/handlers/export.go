@@ -1,16 +1,26 @@
 package handlers
 
 import (
+	"archive/zip"
+	"database/sql"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"path"
 	"strings"
 	"time"
 
 	"gopass/internal/crypto"
 	"gopass/internal/database"
+	"gopass/internal/mfa"
 	"gopass/internal/models"
+	"gopass/internal/session"
+	"gopass/internal/utils"
+	"gopass/internal/vault"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,12 +32,13 @@ func ExportData(c *gin.Context) {
 		return
 	}
 
-	// 查询用户的所有密码条目
-	rows, err := database.DB.Query(`
-		SELECT title, website, username, password, category, notes, created_at
-		FROM passwords WHERE user_id = ? ORDER BY created_at DESC`,
-		userID,
-	)
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	entries, err := loadExportEntries(userID, encryptionKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -35,48 +46,367 @@ func ExportData(c *gin.Context) {
 		})
 		return
 	}
-	defer rows.Close()
+
+	// 个人访问令牌只能导出允许的分类
+	allowed := entries[:0]
+	var undecryptable []int
+	for _, p := range entries {
+		if !tokenAllowsCategory(c, p.Category) {
+			continue
+		}
+		if p.Undecryptable {
+			undecryptable = append(undecryptable, p.ID)
+		}
+		allowed = append(allowed, p)
+	}
+	entries = allowed
+
+	// CSV 无法表示损坏的条目，拒绝导出，避免用户误以为备份是完整的
+	if len(undecryptable) > 0 {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("%d password entries cannot be decrypted and cannot be exported as CSV, download the full archive instead", len(undecryptable)),
+			Code:    models.CodeUndecryptableEntries,
+			Data: map[string]interface{}{
+				"entry_ids": undecryptable,
+			},
+		})
+		return
+	}
 
 	// 设置响应头
 	c.Header("Content-Type", "text/csv")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=gopass_export_%s.csv", time.Now().Format("20060102_150405")))
 
-	// 创建CSV写入器
-	writer := csv.NewWriter(c.Writer)
-	defer writer.Flush()
+	writeEntriesCSV(c.Writer, entries)
+}
 
-	// 写入CSV头部
-	writer.Write([]string{"Title", "Website", "Username", "Password", "Category", "Notes", "Created At"})
+// ExportArchive 导出账户的全部个人数据（账户信息、分类、条目、历史密码和附件）为ZIP归档，用于数据可携带请求和完整备份
+func ExportArchive(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
 
-	// 解密密钥
-	encryptionKey := crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
 
-	// 写入数据行
-	for rows.Next() {
-		var title, website, username, encryptedPassword, category, notes string
-		var createdAt time.Time
+	account, err := loadExportAccount(userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
 
-		err := rows.Scan(&title, &website, &username, &encryptedPassword, &category, &notes, &createdAt)
+	categories, err := loadExportCategories(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	entries, err := loadExportEntries(userID, encryptionKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	// 归档是损坏条目的备份途径，某个条目的历史密码无法解密时只记录条目ID，不影响整个归档
+	history := []models.PasswordHistory{}
+	for _, p := range entries {
+		entryHistory, err := vault.PasswordHistory(encryptionKey, userID, p.ID, passwordHistoryLimit)
 		if err != nil {
+			log.Printf("Password history of entry %d of user %d cannot be decrypted: %v", p.ID, userID, err)
+			history = append(history, models.PasswordHistory{PasswordID: p.ID, Undecryptable: true})
 			continue
 		}
+		history = append(history, entryHistory...)
+	}
+
+	// 附件可能很大，归档先写入临时文件，出错时仍可返回JSON错误
+	tmp, err := os.CreateTemp("", "gopass-export-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create archive",
+		})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
-		// 解密密码
-		decryptedPassword, err := crypto.Decrypt(encryptedPassword, encryptionKey)
+	archive := zip.NewWriter(tmp)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"account.json", account},
+		{"categories.json", categories},
+		{"passwords.json", entries},
+		{"password_history.json", history},
+	}
+	for _, file := range files {
+		if err == nil {
+			err = writeArchiveJSON(archive, file.name, file.data)
+		}
+	}
+	if err == nil {
+		var w io.Writer
+		if w, err = archive.Create("passwords.csv"); err == nil {
+			err = writeEntriesCSV(w, entries)
+		}
+	}
+	if err == nil {
+		var attachments []archiveAttachment
+		if attachments, err = writeArchiveAttachments(archive, userID, encryptionKey); err == nil {
+			err = writeArchiveJSON(archive, "attachments.json", attachments)
+		}
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = tmp.Stat()
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("Failed to create account archive of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create archive",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("gopass_account_%s.zip", time.Now().Format("20060102_150405"))
+	c.DataFromReader(http.StatusOK, info.Size(), "application/zip", tmp, map[string]string{
+		"Content-Disposition": "attachment; filename=" + filename,
+	})
+}
+
+// archiveAttachment 归档中的附件说明，File 为附件内容在归档中的路径
+type archiveAttachment struct {
+	models.Attachment
+	File string `json:"file"`
+}
+
+// writeArchiveAttachments 解密用户的所有附件并写入归档的 attachments/ 目录
+func writeArchiveAttachments(archive *zip.Writer, userID int, encryptionKey []byte) ([]archiveAttachment, error) {
+	attachments, err := loadAttachments(userID, 0, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []archiveAttachment{}
+	for _, a := range attachments {
+		var wrappedKey, storage string
+		err := database.DB.QueryRow("SELECT file_key, storage FROM attachments WHERE id = ?", a.ID).Scan(&wrappedKey, &storage)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, closer, err := openAttachment(encryptionKey, userID, a.ID, wrappedKey, storage)
+		if err != nil {
+			return nil, err
+		}
+		file := path.Join("attachments", a.ID, a.Name)
+		w, err := archive.Create(file)
+		if err == nil {
+			_, err = io.Copy(w, plaintext)
+		}
+		closer.Close()
 		if err != nil {
-			decryptedPassword = "[DECRYPTION_ERROR]"
+			return nil, err
+		}
+
+		result = append(result, archiveAttachment{Attachment: a, File: file})
+	}
+	return result, nil
+}
+
+// loadExportEntries 读取并解密用户的所有密码条目，无法解密的条目以占位返回
+func loadExportEntries(userID int, encryptionKey []byte) ([]models.Password, error) {
+	rows, err := database.DB.Query("SELECT "+passwordColumns+" FROM passwords WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.Password{}
+	for rows.Next() {
+		var p models.Password
+		if err := scanPassword(rows, &p); err != nil {
+			continue
+		}
+		p.UserID = userID
+
+		if err := vault.DecryptEntry(encryptionKey, userID, &p); err != nil {
+			p = undecryptableEntry(userID, p, err)
+		}
+		entries = append(entries, p)
+	}
+	return entries, rows.Err()
+}
+
+// loadExportCategories 读取用户的所有分类
+func loadExportCategories(userID int) ([]models.Category, error) {
+	rows, err := database.DB.Query(
+		"SELECT id, name, description, created_at FROM categories WHERE user_id = ? ORDER BY name",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var cat models.Category
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.CreatedAt); err != nil {
+			continue
 		}
+		cat.UserID = userID
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// loadExportAccount 汇总账户信息、登录会话、登录设备和紧急访问设置
+func loadExportAccount(userID int, sessionID string) (map[string]interface{}, error) {
+	var user models.User
+	var emailVerifiedAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT id, username, email, email_verified_at, created_at, updated_at FROM users WHERE id = ?", userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &emailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	var verifiedAt *time.Time
+	if emailVerifiedAt.Valid {
+		verifiedAt = &emailVerifiedAt.Time
+	}
 
+	mfaEnabled, err := mfa.Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	securityKeys, err := mfa.SecurityKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := session.List(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := session.Devices(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	trustees := []string{}
+	rows, err := database.DB.Query(`
+		SELECT u.username FROM emergency_shares s JOIN users u ON u.id = s.trustee_id
+		WHERE s.owner_id = ? ORDER BY u.username`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var username string
+		if rows.Scan(&username) == nil {
+			trustees = append(trustees, username)
+		}
+	}
+
+	return map[string]interface{}{
+		"user":               user,
+		"email_verified_at":  verifiedAt,
+		"two_factor_enabled": mfaEnabled,
+		"security_keys":      securityKeys,
+		"sessions":           sessions,
+		"login_devices":      devices,
+		"emergency_trustees": trustees,
+		"exported_at":        time.Now().UTC(),
+	}, rows.Err()
+}
+
+// writeArchiveJSON 向归档写入格式化的JSON文件
+func writeArchiveJSON(archive *zip.Writer, name string, data interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// writeEntriesCSV 按导入接口可识别的格式写出密码条目。
+// 无法解密的条目不写入CSV，归档中的 passwords.json 以 undecryptable 标记列出
+func writeEntriesCSV(w io.Writer, entries []models.Password) error {
+	writer := csv.NewWriter(w)
+
+	// 写入CSV头部
+	writer.Write([]string{"Title", "Website", "Username", "Password", "Category", "Notes", "Created At", "TOTP", "Type", "Fields"})
+
+	// 写入数据行
+	for _, p := range entries {
+		if p.Undecryptable {
+			continue
+		}
+		fields, err := csvItemFields(p)
+		if err != nil {
+			return err
+		}
 		writer.Write([]string{
-			title,
-			website,
-			username,
-			decryptedPassword,
-			category,
-			notes,
-			createdAt.Format("2006-01-02 15:04:05"),
+			p.Title,
+			p.Website,
+			p.Username,
+			p.Password,
+			p.Category,
+			p.Notes,
+			p.CreatedAt.Format("2006-01-02 15:04:05"),
+			p.TOTPSecret,
+			p.Type,
+			fields,
 		})
 	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvFields CSV中 Fields 列保存的类型专属字段和自定义字段
+type csvFields struct {
+	Card     *models.CardFields     `json:"card,omitempty"`
+	Identity *models.IdentityFields `json:"identity,omitempty"`
+	SSHKey   *models.SSHKeyFields   `json:"ssh_key,omitempty"`
+	Custom   []models.CustomField   `json:"custom,omitempty"`
+}
+
+// csvItemFields 将条目的类型专属字段和自定义字段编码为JSON，都没有时为空字符串
+func csvItemFields(p models.Password) (string, error) {
+	if p.Card == nil && p.Identity == nil && p.SSHKey == nil && len(p.Fields) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(csvFields{Card: p.Card, Identity: p.Identity, SSHKey: p.SSHKey, Custom: p.Fields})
+	return string(data), err
 }
 
 // ImportData 从CSV导入数据
@@ -86,6 +416,12 @@ func ImportData(c *gin.Context) {
 		return
 	}
 
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
 	// 获取上传的文件
 	file, _, err := c.Request.FormFile("file")
 	if err != nil {
@@ -121,14 +457,11 @@ func ImportData(c *gin.Context) {
 	if len(header) < 4 || !strings.EqualFold(header[0], "Title") || !strings.EqualFold(header[3], "Password") {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Invalid CSV format. Expected headers: Title, Website, Username, Password, Category, Notes, Created At",
+			Message: "Invalid CSV format. Expected headers: Title, Website, Username, Password, Category, Notes, Created At, TOTP, Type, Fields",
 		})
 		return
 	}
 
-	// 加密密钥
-	encryptionKey := crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
-
 	// 导入数据
 	imported := 0
 	failed := 0
@@ -145,6 +478,7 @@ func ImportData(c *gin.Context) {
 		password := record[3]
 		category := ""
 		notes := ""
+		totpSecret := ""
 
 		if len(record) > 1 {
 			website = record[1]
@@ -158,26 +492,47 @@ func ImportData(c *gin.Context) {
 		if len(record) > 5 {
 			notes = record[5]
 		}
+		if len(record) > 7 {
+			totpSecret = strings.TrimSpace(record[7])
+		}
+
+		req := models.PasswordRequest{
+			Title:      title,
+			Website:    website,
+			Username:   username,
+			Password:   password,
+			Category:   category,
+			Notes:      notes,
+			TOTPSecret: totpSecret,
+		}
+		if len(record) > 8 {
+			req.Type = record[8]
+		}
+		if len(record) > 9 && record[9] != "" {
+			var fields csvFields
+			if err := json.Unmarshal([]byte(record[9]), &fields); err != nil {
+				failed++
+				continue
+			}
+			req.Card, req.Identity, req.SSHKey, req.Fields = fields.Card, fields.Identity, fields.SSHKey, fields.Custom
+		}
 
-		// 验证必填字段
-		if title == "" || password == "" {
+		// 验证必填字段和类型专属字段，个人访问令牌只能导入到允许的分类
+		if valid, _ := utils.ValidateTOTPSecret(totpSecret); !valid {
 			failed++
 			continue
 		}
-
-		// 加密密码
-		encryptedPassword, err := crypto.Encrypt(password, encryptionKey)
-		if err != nil {
+		if valid, _ := prepareItem(&req); !valid {
+			failed++
+			continue
+		}
+		if title == "" || !tokenAllowsCategory(c, category) {
 			failed++
 			continue
 		}
 
-		// 插入数据库
-		_, err = database.DB.Exec(`
-			INSERT INTO passwords (user_id, title, website, username, password, category, notes, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			userID, title, website, username, encryptedPassword, category, notes, time.Now(), time.Now(),
-		)
+		// 加密并插入数据库
+		_, err := insertPasswordEntry(userID, encryptionKey, req)
 		if err != nil {
 			failed++
 			continue
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// passwordHistoryLimit 每个条目保留的历史密码数量，0 表示不保留
+var passwordHistoryLimit = 10
+
+// SetPasswordHistoryLimit 设置每个条目保留的历史密码数量
+func SetPasswordHistoryLimit(limit int) {
+	passwordHistoryLimit = limit
+}
+
+// currentPassword 在事务中读取并解密条目当前的密码，条目不存在时返回 sql.ErrNoRows
+func currentPassword(tx *sql.Tx, key []byte, userID, passwordID int) (string, error) {
+	var encrypted string
+	err := tx.QueryRow("SELECT password FROM passwords WHERE id = ? AND user_id = ?", passwordID, userID).Scan(&encrypted)
+	if err != nil {
+		return "", err
+	}
+	return vault.DecryptField(key, userID, passwordID, "password", encrypted)
+}
+
+// GetPasswordHistory 获取条目被替换的旧密码，从新到旧排列
+func GetPasswordHistory(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	passwordID, ok := ownedEntryID(c, userID)
+	if !ok {
+		return
+	}
+
+	history, err := vault.PasswordHistory(encryptionKey, userID, passwordID, passwordHistoryLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to decrypt password history",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password history retrieved successfully",
+		Data:    history,
+	})
+}
+
+// RestorePasswordHistory 恢复条目的一条历史密码，当前密码写入历史
+func RestorePasswordHistory(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	passwordID, ok := ownedEntryID(c, userID)
+	if !ok {
+		return
+	}
+
+	historyID, err := strconv.Atoi(c.Param("historyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid history ID",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	err = vault.RestorePasswordHistory(tx, encryptionKey, userID, passwordID, historyID, time.Now(), passwordHistoryLimit)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Password history not found",
+		})
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to restore password",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password restored successfully",
+	})
+}
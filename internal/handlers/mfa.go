@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/mfa"
+	"gopass/internal/models"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// mfaTicketTTL 密码验证通过后提交第二因素的时限
+	mfaTicketTTL = 5 * time.Minute
+	// maxMFAAttempts 每张票据允许的验证码尝试次数
+	maxMFAAttempts = 5
+)
+
+// pendingLogin 已通过密码验证、等待第二因素的登录。
+// 保险库密钥以 "mfa:<票据>" 为键暂存在密钥缓存中，challenge 为安全密钥认证的挑战
+type pendingLogin struct {
+	user      models.User
+	challenge string
+	expiresAt time.Time
+	attempts  int
+}
+
+var (
+	pendingMu     sync.Mutex
+	pendingLogins = make(map[string]*pendingLogin)
+)
+
+// beginMFALogin 暂存已解锁的保险库密钥并返回第二步登录使用的票据
+func beginMFALogin(user models.User, vaultKey []byte, challenge string) (string, error) {
+	ticket, err := auth.NewSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	now := time.Now()
+	for id, pending := range pendingLogins {
+		if now.After(pending.expiresAt) {
+			vault.Forget("mfa:" + id)
+			delete(pendingLogins, id)
+		}
+	}
+
+	pendingLogins[ticket] = &pendingLogin{user: user, challenge: challenge, expiresAt: now.Add(mfaTicketTTL)}
+	vault.Store("mfa:"+ticket, user.ID, vaultKey, mfaTicketTTL, 0)
+	return ticket, nil
+}
+
+// takePendingLogin 取出有效的待验证登录并计入一次尝试
+func takePendingLogin(ticket string) (*pendingLogin, bool) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	pending, ok := pendingLogins[ticket]
+	if !ok {
+		return nil, false
+	}
+	pending.attempts++
+	if time.Now().After(pending.expiresAt) || pending.attempts > maxMFAAttempts {
+		vault.Forget("mfa:" + ticket)
+		delete(pendingLogins, ticket)
+		return nil, false
+	}
+	return pending, true
+}
+
+// finishPendingLogin 删除票据，返回暂存的保险库密钥
+func finishPendingLogin(ticket string, userID int) ([]byte, bool) {
+	pendingMu.Lock()
+	delete(pendingLogins, ticket)
+	pendingMu.Unlock()
+
+	key, ok := vault.Key("mfa:"+ticket, userID)
+	vault.Forget("mfa:" + ticket)
+	return key, ok
+}
+
+// LoginMFA 登录第二步：校验TOTP验证码或备用码后创建会话
+func LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, loginIPLimiter, c.ClientIP()) {
+		return
+	}
+
+	pending, ok := takePendingLogin(req.MFAToken)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Login expired, please sign in again",
+		})
+		return
+	}
+
+	if !checkSecondFactorLimit(c, pending.user) {
+		return
+	}
+
+	if err := mfa.Verify(pending.user.ID, req.Code); err != nil {
+		recordSecondFactorFailure(c, pending.user)
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid verification code",
+		})
+		return
+	}
+
+	completeMFALogin(c, req.MFAToken, pending)
+}
+
+// completeMFALogin 第二因素验证通过后取出保险库密钥并创建会话
+func completeMFALogin(c *gin.Context, ticket string, pending *pendingLogin) {
+	vaultKey, ok := finishPendingLogin(ticket, pending.user.ID)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Login expired, please sign in again",
+		})
+		return
+	}
+	defer crypto.Wipe(vaultKey)
+
+	loginSucceeded(pending.user)
+	data := startSession(c, pending.user, vaultKey)
+	if data == nil {
+		return
+	}
+	issueMissingRecoveryKey(pending.user.ID, vaultKey, data)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Login successful",
+		Data:    data,
+	})
+}
+
+// GetMFAStatus 获取两步验证状态
+func GetMFAStatus(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	totpEnabled, err := mfa.TOTPEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	keys, err := mfa.SecurityKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	remaining, _ := mfa.BackupCodesRemaining(userID)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor status retrieved successfully",
+		Data: map[string]interface{}{
+			"enabled":                totpEnabled || len(keys) > 0,
+			"totp_enabled":           totpEnabled,
+			"security_keys":          len(keys),
+			"backup_codes_remaining": remaining,
+		},
+	})
+}
+
+// SetupTOTP 生成新的TOTP密钥和二维码，需调用 EnableTOTP 确认后才生效
+func SetupTOTP(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	secret, uri, err := mfa.Setup(userID, c.GetString("username"))
+	if err == mfa.ErrAlreadyEnabled {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to set up two-factor authentication",
+		})
+		return
+	}
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate QR code",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Scan the QR code and confirm with a code from your app",
+		Data: map[string]interface{}{
+			"secret":      secret,
+			"otpauth_uri": uri,
+			"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		},
+	})
+}
+
+// EnableTOTP 用应用生成的验证码确认并启用两步验证，返回一次性备用码
+func EnableTOTP(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	codes, err := mfa.Enable(userID, req.Code)
+	switch err {
+	case nil:
+	case mfa.ErrInvalidCode:
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid verification code",
+		})
+		return
+	case mfa.ErrNotEnrolled:
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Two-factor authentication is not set up",
+		})
+		return
+	case mfa.ErrAlreadyEnabled:
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Two-factor authentication is already enabled",
+		})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication enabled successfully",
+		Data: map[string]interface{}{
+			"backup_codes": codes,
+		},
+	})
+}
+
+// DisableTOTP 关闭两步验证，需要主密码和当前验证码（或备用码）
+func DisableTOTP(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	enabled, err := mfa.TOTPEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Authenticator app is not enabled",
+		})
+		return
+	}
+
+	if !verifyMFAReauth(c, userID) {
+		return
+	}
+
+	if err := mfa.Disable(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Two-factor authentication disabled successfully",
+	})
+}
+
+// RegenerateBackupCodes 生成新的备用码，旧备用码全部作废
+func RegenerateBackupCodes(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	if !verifyMFAReauth(c, userID) {
+		return
+	}
+
+	codes, err := mfa.RegenerateBackupCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create backup codes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Backup codes created successfully",
+		Data: map[string]interface{}{
+			"backup_codes": codes,
+		},
+	})
+}
+
+// verifyMFAReauth 校验主密码和第二因素
+func verifyMFAReauth(c *gin.Context, userID int) bool {
+	var req models.MFAReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return false
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return false
+	}
+
+	err := mfa.Verify(userID, req.Code)
+	if err == mfa.ErrNotEnrolled {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Two-factor authentication is not enabled",
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid verification code",
+		})
+		return false
+	}
+	return true
+}
@@ -4,13 +4,17 @@ import (
 	"net/http"
 	"strings"
 
+	"gopass/internal/apitoken"
 	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
 	"gopass/internal/models"
+	"gopass/internal/session"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware JWT认证中间件
+// AuthMiddleware 认证中间件，接受登录会话的JWT和个人访问令牌
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -35,6 +39,11 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := tokenParts[1]
+		if strings.HasPrefix(token, apitoken.Prefix) {
+			authenticateAPIToken(c, token)
+			return
+		}
+
 		claims, err := auth.ValidateToken(token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.APIResponse{
@@ -45,13 +54,99 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 会话被撤销（退出登录、远程下线）后令牌立即失效
+		if err := session.Validate(claims.SessionID, claims.UserID); err != nil {
+			c.JSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Message: "Session has expired or been revoked",
+			})
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储到上下文中
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
 
+// authenticateAPIToken 使用个人访问令牌认证。
+// 令牌解开的保险库密钥只在本次请求内有效，不进入会话密钥缓存
+func authenticateAPIToken(c *gin.Context, token string) {
+	t, vaultKey, err := apitoken.Authenticate(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid token",
+		})
+		c.Abort()
+		return
+	}
+	defer crypto.Wipe(vaultKey)
+
+	var username string
+	if err := database.DB.QueryRow("SELECT username FROM users WHERE id = ?", t.UserID).Scan(&username); err != nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid token",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", t.UserID)
+	c.Set("username", username)
+	c.Set("api_token", t)
+	c.Set("api_token_vault_key", vaultKey)
+	c.Next()
+}
+
+// SessionRequired 只允许登录会话访问，拒绝个人访问令牌
+func SessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if getAPIToken(c) != nil {
+			c.JSON(http.StatusForbidden, models.APIResponse{
+				Success: false,
+				Message: "This endpoint is not available to API tokens",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope 要求个人访问令牌具有指定权限，登录会话不受限制
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := getAPIToken(c); t != nil && !t.HasScope(scope) {
+			c.JSON(http.StatusForbidden, models.APIResponse{
+				Success: false,
+				Message: "API token is missing the " + scope + " scope",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// getAPIToken 返回当前请求使用的个人访问令牌，登录会话返回nil
+func getAPIToken(c *gin.Context) *apitoken.Token {
+	if t, ok := c.Get("api_token"); ok {
+		return t.(*apitoken.Token)
+	}
+	return nil
+}
+
+// tokenAllowsCategory 检查当前请求能否访问该分类的条目
+func tokenAllowsCategory(c *gin.Context, category string) bool {
+	t := getAPIToken(c)
+	return t == nil || t.AllowsCategory(category)
+}
+
 // CORSMiddleware CORS中间件
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -68,3 +163,11 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// GetJWKS 返回JWT验证公钥集合（标准JWKS格式，不使用APIResponse包装）
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"keys": auth.PublicJWKS(),
+	})
+}
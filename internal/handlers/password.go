@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"database/sql"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopass/internal/crypto"
 	"gopass/internal/database"
 	"gopass/internal/models"
 	"gopass/internal/utils"
+	"gopass/internal/vault"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +24,12 @@ func CreatePassword(c *gin.Context) {
 		return
 	}
 
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
 	var req models.PasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -54,6 +64,24 @@ func CreatePassword(c *gin.Context) {
 		return
 	}
 
+	// 两步验证密钥中的 & 等字符是URI的一部分，不做转义
+	req.TOTPSecret = strings.TrimSpace(req.TOTPSecret)
+	if valid, msg := utils.ValidateTOTPSecret(req.TOTPSecret); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	if valid, msg := prepareItem(&req); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
 	// 清理输入
 	req.Title = utils.SanitizeInput(req.Title)
 	req.Website = utils.SanitizeInput(req.Website)
@@ -61,23 +89,16 @@ func CreatePassword(c *gin.Context) {
 	req.Category = utils.SanitizeInput(req.Category)
 	req.Notes = utils.SanitizeInput(req.Notes)
 
-	// 加密密码
-	encryptionKey := crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
-	encryptedPassword, err := crypto.Encrypt(req.Password, encryptionKey)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+	if !tokenAllowsCategory(c, req.Category) {
+		c.JSON(http.StatusForbidden, models.APIResponse{
 			Success: false,
-			Message: "Failed to encrypt password",
+			Message: "API token cannot access this category",
 		})
 		return
 	}
 
-	// 插入密码条目
-	result, err := database.DB.Exec(`
-		INSERT INTO passwords (user_id, title, website, username, password, category, notes, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		userID, req.Title, req.Website, req.Username, encryptedPassword, req.Category, req.Notes, time.Now(), time.Now(),
-	)
+	// 插入并加密密码条目
+	passwordID, err := insertPasswordEntry(userID, encryptionKey, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -86,8 +107,6 @@ func CreatePassword(c *gin.Context) {
 		return
 	}
 
-	passwordID, _ := result.LastInsertId()
-
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
 		Message: "Password entry created successfully",
@@ -104,11 +123,25 @@ func GetPasswords(c *gin.Context) {
 		return
 	}
 
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
 	category := c.Query("category")
-	search := c.Query("search")
+	itemType := c.Query("type")
+	search := strings.ToLower(strings.TrimSpace(c.Query("search")))
 
-	query := `SELECT id, title, website, username, password, category, notes, created_at, updated_at 
-			  FROM passwords WHERE user_id = ?`
+	if itemType != "" && !utils.ValidateItemType(itemType) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid item type",
+		})
+		return
+	}
+
+	query := "SELECT " + passwordColumns + " FROM passwords WHERE user_id = ?"
 	args := []interface{}{userID}
 
 	if category != "" {
@@ -116,10 +149,9 @@ func GetPasswords(c *gin.Context) {
 		args = append(args, category)
 	}
 
-	if search != "" {
-		query += " AND (title LIKE ? OR website LIKE ? OR username LIKE ?)"
-		searchPattern := "%" + search + "%"
-		args = append(args, searchPattern, searchPattern, searchPattern)
+	if itemType != "" {
+		query += " AND item_type = ?"
+		args = append(args, itemType)
 	}
 
 	query += " ORDER BY created_at DESC"
@@ -134,25 +166,37 @@ func GetPasswords(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var passwords []models.Password
-	encryptionKey := crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
+	counts, err := attachmentCounts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
 
+	var passwords []models.Password
 	for rows.Next() {
 		var p models.Password
-		var encryptedPassword string
-		err := rows.Scan(&p.ID, &p.Title, &p.Website, &p.Username, &encryptedPassword, &p.Category, &p.Notes, &p.CreatedAt, &p.UpdatedAt)
-		if err != nil {
+		if err := scanPassword(rows, &p); err != nil || !tokenAllowsCategory(c, p.Category) {
 			continue
 		}
+		p.Attachments = counts[p.ID]
 
-		// 解密密码
-		decryptedPassword, err := crypto.Decrypt(encryptedPassword, encryptionKey)
-		if err != nil {
+		// 无法解密的条目以占位返回，搜索时无法匹配
+		if err := vault.DecryptEntry(encryptionKey, userID, &p); err != nil {
+			if search == "" {
+				passwords = append(passwords, undecryptableEntry(userID, p, err))
+			}
 			continue
 		}
-		p.Password = decryptedPassword
 		p.UserID = userID
 
+		// 标题、网站和用户名均已加密，搜索只能在解密后进行
+		if search != "" && !matchesSearch(p, search) {
+			continue
+		}
+
 		passwords = append(passwords, p)
 	}
 
@@ -170,6 +214,12 @@ func GetPassword(c *gin.Context) {
 		return
 	}
 
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
 	passwordID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -180,14 +230,8 @@ func GetPassword(c *gin.Context) {
 	}
 
 	var p models.Password
-	var encryptedPassword string
-	err = database.DB.QueryRow(`
-		SELECT id, title, website, username, password, category, notes, created_at, updated_at
-		FROM passwords WHERE id = ? AND user_id = ?`,
-		passwordID, userID,
-	).Scan(&p.ID, &p.Title, &p.Website, &p.Username, &encryptedPassword, &p.Category, &p.Notes, &p.CreatedAt, &p.UpdatedAt)
-
-	if err != nil {
+	row := database.DB.QueryRow("SELECT "+passwordColumns+" FROM passwords WHERE id = ? AND user_id = ?", passwordID, userID)
+	if err := scanPassword(row, &p); err != nil || !tokenAllowsCategory(c, p.Category) {
 		c.JSON(http.StatusNotFound, models.APIResponse{
 			Success: false,
 			Message: "Password entry not found",
@@ -195,17 +239,14 @@ func GetPassword(c *gin.Context) {
 		return
 	}
 
-	// 解密密码
-	encryptionKey := crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
-	decryptedPassword, err := crypto.Decrypt(encryptedPassword, encryptionKey)
-	if err != nil {
+	// 解密条目
+	if err := vault.DecryptEntry(encryptionKey, userID, &p); err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Message: "Failed to decrypt password",
 		})
 		return
 	}
-	p.Password = decryptedPassword
 	p.UserID = userID
 
 	c.JSON(http.StatusOK, models.APIResponse{
@@ -259,6 +300,12 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
 	passwordID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -277,39 +324,61 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	// 加密密码
-	encryptionKey := crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
-	encryptedPassword, err := crypto.Encrypt(req.Password, encryptionKey)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+	req.TOTPSecret = strings.TrimSpace(req.TOTPSecret)
+	if valid, msg := utils.ValidateTOTPSecret(req.TOTPSecret); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Failed to encrypt password",
+			Message: msg,
 		})
 		return
 	}
 
-	// 更新密码条目
-	result, err := database.DB.Exec(`
-		UPDATE passwords SET title = ?, website = ?, username = ?, password = ?, category = ?, notes = ?, updated_at = ?
-		WHERE id = ? AND user_id = ?`,
-		req.Title, req.Website, req.Username, encryptedPassword, req.Category, req.Notes, time.Now(), passwordID, userID,
-	)
+	if valid, msg := prepareItem(&req); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	if !tokenCanAccessEntry(c, userID, passwordID) {
+		return
+	}
+
+	if !tokenAllowsCategory(c, req.Category) {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "API token cannot access this category",
+		})
+		return
+	}
+
+	// 加密条目
+	encrypted, err := vault.EncryptEntry(encryptionKey, userID, passwordID, passwordFromRequest(req))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to update password entry",
+			Message: "Failed to encrypt password",
 		})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	// 更新密码条目
+	err = updatePasswordEntry(userID, passwordID, encryptionKey, req.Password, encrypted)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.APIResponse{
 			Success: false,
 			Message: "Password entry not found",
 		})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to update password entry",
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -333,6 +402,20 @@ func DeletePassword(c *gin.Context) {
 		return
 	}
 
+	if !tokenCanAccessEntry(c, userID, passwordID) {
+		return
+	}
+
+	// 附件元数据随条目级联删除，内容需要另外从存储后端清理
+	stored, err := listStoredAttachments(userID, passwordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to delete password entry",
+		})
+		return
+	}
+
 	result, err := database.DB.Exec("DELETE FROM passwords WHERE id = ? AND user_id = ?", passwordID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
@@ -351,12 +434,265 @@ func DeletePassword(c *gin.Context) {
 		return
 	}
 
+	removeAttachmentContent(stored)
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "Password entry deleted successfully",
 	})
 }
 
+// insertPasswordEntry 插入密码条目。密文绑定条目ID，因此先插入占位行取得ID，再在同一事务中写入密文
+func insertPasswordEntry(userID int, key []byte, req models.PasswordRequest) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO passwords (user_id, item_type, title, website, username, password, category, notes, created_at, updated_at)
+		VALUES (?, ?, '', '', '', '', ?, '', ?, ?)`,
+		userID, req.Type, req.Category, time.Now(), time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	passwordID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	encrypted, err := vault.EncryptEntry(key, userID, int(passwordID), passwordFromRequest(req))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE passwords SET title = ?, website = ?, username = ?, password = ?, notes = ?, totp_secret = ?, payload = ?, custom_fields = ? WHERE id = ?",
+		encrypted.Title, encrypted.Website, encrypted.Username, encrypted.Password, encrypted.Notes, encrypted.TOTPSecret, encrypted.Payload,
+		encrypted.FieldsData, passwordID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return passwordID, tx.Commit()
+}
+
+// updatePasswordEntry 更新密码条目。密码改变时在同一事务中把旧密码写入历史，条目不存在时返回 sql.ErrNoRows
+func updatePasswordEntry(userID, passwordID int, key []byte, password string, encrypted models.Password) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	previous, err := currentPassword(tx, key, userID, passwordID)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		// 旧密码无法解密时仍允许覆盖，只是不记录历史
+		log.Printf("Not recording password history of entry %d: %v", passwordID, err)
+	} else if previous != password {
+		if err := vault.AddPasswordHistory(tx, key, userID, passwordID, previous, now, passwordHistoryLimit); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE passwords SET item_type = ?, title = ?, website = ?, username = ?, password = ?, category = ?, notes = ?, totp_secret = ?, payload = ?, custom_fields = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?`,
+		encrypted.Type, encrypted.Title, encrypted.Website, encrypted.Username, encrypted.Password, encrypted.Category, encrypted.Notes, encrypted.TOTPSecret, encrypted.Payload,
+		encrypted.FieldsData, now, passwordID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tokenCanAccessEntry 个人访问令牌限制了分类时，检查已有条目是否在允许的分类中。
+// 不允许访问的条目按不存在处理
+func tokenCanAccessEntry(c *gin.Context, userID, passwordID int) bool {
+	if getAPIToken(c) == nil {
+		return true
+	}
+
+	var category string
+	err := database.DB.QueryRow("SELECT category FROM passwords WHERE id = ? AND user_id = ?", passwordID, userID).Scan(&category)
+	if err != nil || !tokenAllowsCategory(c, category) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Password entry not found",
+		})
+		return false
+	}
+	return true
+}
+
+// ownedEntryID 解析路径中的条目ID并检查条目属于当前用户、令牌可以访问，失败时已写入响应
+func ownedEntryID(c *gin.Context, userID int) (int, bool) {
+	passwordID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid password ID",
+		})
+		return 0, false
+	}
+
+	var category string
+	err = database.DB.QueryRow("SELECT category FROM passwords WHERE id = ? AND user_id = ?", passwordID, userID).Scan(&category)
+	if err != nil || !tokenAllowsCategory(c, category) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Password entry not found",
+		})
+		return 0, false
+	}
+	return passwordID, true
+}
+
+// passwordFromRequest 将请求转换为待加密的条目
+func passwordFromRequest(req models.PasswordRequest) models.Password {
+	return models.Password{
+		Type:       req.Type,
+		Title:      req.Title,
+		Website:    req.Website,
+		Username:   req.Username,
+		Password:   req.Password,
+		Category:   req.Category,
+		Notes:      req.Notes,
+		TOTPSecret: req.TOTPSecret,
+		Card:       req.Card,
+		Identity:   req.Identity,
+		SSHKey:     req.SSHKey,
+		Fields:     req.Fields,
+	}
+}
+
+// prepareItem 验证并清理条目类型、类型专属字段和自定义字段，只保留与类型对应的字段。未指定类型时为登录条目
+func prepareItem(req *models.PasswordRequest) (bool, string) {
+	if req.Type == "" {
+		req.Type = models.ItemTypeLogin
+	}
+
+	card, identity, sshKey := req.Card, req.Identity, req.SSHKey
+	req.Card, req.Identity, req.SSHKey = nil, nil, nil
+	switch req.Type {
+	case models.ItemTypeCard:
+		if card != nil {
+			card.Number = utils.NormalizeCardNumber(card.Number)
+			card.Expiry = strings.TrimSpace(card.Expiry)
+			card.CVV = strings.TrimSpace(card.CVV)
+		}
+		req.Card = card
+	case models.ItemTypeIdentity:
+		req.Identity = identity
+	case models.ItemTypeSSHKey:
+		req.SSHKey = sshKey
+	}
+
+	if valid, msg := utils.ValidateItem(*req); !valid {
+		return false, msg
+	}
+
+	for i := range req.Fields {
+		field := &req.Fields[i]
+		field.Name = strings.TrimSpace(field.Name)
+		field.Kind = strings.ToLower(strings.TrimSpace(field.Kind))
+		if field.Kind == "" {
+			field.Kind = models.FieldKindText
+		}
+		switch field.Kind {
+		case models.FieldKindBoolean:
+			field.Value = strings.ToLower(strings.TrimSpace(field.Value))
+		case models.FieldKindLink:
+			field.Value = strings.TrimSpace(field.Value)
+		}
+	}
+	if valid, msg := utils.ValidateCustomFields(req.Fields); !valid {
+		return false, msg
+	}
+
+	switch {
+	case req.Card != nil:
+		req.Card.Brand = utils.CardBrand(req.Card.Number)
+	case req.SSHKey != nil:
+		publicKey, fingerprint, err := utils.SSHKeyInfo(req.SSHKey.PrivateKey, req.SSHKey.PublicKey, req.Password)
+		if err != nil {
+			return false, "SSH私钥格式不正确"
+		}
+		req.SSHKey.PublicKey, req.SSHKey.Fingerprint = publicKey, fingerprint
+	}
+	sanitizeItem(req)
+	return true, ""
+}
+
+// sanitizeItem 清理类型专属字段和自定义字段名。卡号、私钥和公钥与密码字段相同，不做转义
+func sanitizeItem(req *models.PasswordRequest) {
+	if req.Card != nil {
+		req.Card.Cardholder = utils.SanitizeInput(req.Card.Cardholder)
+	}
+	if req.Identity != nil {
+		for _, field := range identityFields(req.Identity) {
+			*field = utils.SanitizeInput(*field)
+		}
+	}
+	for i := range req.Fields {
+		req.Fields[i].Name = utils.SanitizeInput(req.Fields[i].Name)
+	}
+}
+
+// identityFields 返回身份信息的所有文本字段
+func identityFields(identity *models.IdentityFields) []*string {
+	return []*string{
+		&identity.FirstName, &identity.LastName, &identity.Email, &identity.Phone, &identity.Company, &identity.Address,
+		&identity.City, &identity.State, &identity.PostalCode, &identity.Country, &identity.BirthDate, &identity.IDNumber,
+	}
+}
+
+// passwordColumns 读取密码条目的列，顺序与 scanPassword 一致
+const passwordColumns = "id, item_type, title, website, username, password, category, notes, totp_secret, payload, custom_fields, created_at, updated_at"
+
+// rowScanner *sql.Row 和 *sql.Rows 共有的方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPassword 读取 passwordColumns 查询出的一行
+func scanPassword(row rowScanner, p *models.Password) error {
+	return row.Scan(
+		&p.ID, &p.Type, &p.Title, &p.Website, &p.Username, &p.Password, &p.Category, &p.Notes, &p.TOTPSecret, &p.Payload,
+		&p.FieldsData, &p.CreatedAt, &p.UpdatedAt,
+	)
+}
+
+// matchesSearch 检查解密后的条目是否匹配搜索词，search 需为小写
+func matchesSearch(p models.Password, search string) bool {
+	fields := []string{p.Title, p.Website, p.Username}
+	if p.Card != nil {
+		fields = append(fields, p.Card.Cardholder)
+	}
+	if p.Identity != nil {
+		fields = append(fields, p.Identity.FirstName, p.Identity.LastName, p.Identity.Email, p.Identity.Company)
+	}
+	// 自定义字段的值可能是PIN等敏感数据，只搜索字段名称
+	for _, field := range p.Fields {
+		fields = append(fields, field.Name)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
 // getUserID 从上下文中获取用户ID
 func getUserID(c *gin.Context) int {
 	userID, exists := c.Get("user_id")
@@ -369,3 +705,78 @@ func getUserID(c *gin.Context) int {
 	}
 	return userID.(int)
 }
+
+// undecryptableEntry 返回无法解密的条目的占位，只保留未加密的列。
+// 列表和导出以此提示用户有条目损坏，而不是静默地丢弃
+func undecryptableEntry(userID int, p models.Password, err error) models.Password {
+	log.Printf("Password entry %d of user %d cannot be decrypted: %v", p.ID, userID, err)
+	return models.Password{
+		ID:            p.ID,
+		UserID:        userID,
+		Type:          p.Type,
+		Category:      p.Category,
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+		Attachments:   p.Attachments,
+		Undecryptable: true,
+	}
+}
+
+// getVaultKey 获取当前会话已解锁的保险库密钥
+func getVaultKey(c *gin.Context, userID int) []byte {
+	// 个人访问令牌在认证时已解开保险库密钥，返回副本供调用方清零
+	if tokenKey, ok := c.Get("api_token_vault_key"); ok {
+		key := append([]byte(nil), tokenKey.([]byte)...)
+		if !checkVaultKey(c, userID, key) {
+			crypto.Wipe(key)
+			return nil
+		}
+		return key
+	}
+
+	sessionID := c.GetString("session_id")
+	key, ok := vault.Key(sessionID, userID)
+	if !ok {
+		c.JSON(http.StatusLocked, models.APIResponse{
+			Success: false,
+			Message: "Vault is locked, enter your master password to unlock it",
+			Code:    models.CodeVaultLocked,
+		})
+		return nil
+	}
+	if !checkVaultKey(c, userID, key) {
+		crypto.Wipe(key)
+		vault.Forget(sessionID)
+		return nil
+	}
+	return key
+}
+
+// checkVaultKey 拒绝已被轮换的保险库密钥，失败时写入响应并返回false。
+// 会话缓存的旧密钥需要重新解锁，令牌包装的旧密钥在轮换时已经作废
+func checkVaultKey(c *gin.Context, userID int, key []byte) bool {
+	err := vault.CheckKey(userID, key)
+	if err == vault.ErrStaleKey && getAPIToken(c) != nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid token",
+		})
+		return false
+	}
+	if err == vault.ErrStaleKey {
+		c.JSON(http.StatusLocked, models.APIResponse{
+			Success: false,
+			Message: "Vault key has been rotated, enter your master password to unlock it",
+			Code:    models.CodeVaultLocked,
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// MaxFailedLogins 连续失败多少次后锁定账户
+	MaxFailedLogins = 5
+	// LockoutDuration 账户锁定时长，管理员可以用 unlock-user 提前解锁
+	LockoutDuration = 15 * time.Minute
+)
+
+var (
+	// 同一IP可以尝试多个账户，限制比单个用户名宽松
+	loginIPLimiter   = ratelimit.New(20, time.Second, 15*time.Minute, time.Hour)
+	loginUserLimiter = ratelimit.New(MaxFailedLogins, time.Second, 15*time.Minute, time.Hour)
+	registerLimiter  = ratelimit.New(5, time.Minute, time.Hour, 24*time.Hour)
+	recoverLimiter   = ratelimit.New(5, time.Second, time.Hour, 24*time.Hour)
+	// 发送邮件的接口可能被用来向他人邮箱发送垃圾邮件
+	mailLimiter = ratelimit.New(3, time.Minute, time.Hour, 24*time.Hour)
+)
+
+// checkRateLimit 超出限制时写入429响应并返回false
+func checkRateLimit(c *gin.Context, limiter *ratelimit.Limiter, key string) bool {
+	wait, ok := limiter.Allow(key)
+	if ok {
+		return true
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, models.APIResponse{
+		Success: false,
+		Message: "Too many attempts, please try again later",
+	})
+	return false
+}
+
+// usernameKey 用户名限速键，忽略大小写和首尾空格
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// accountLocked 检查账户是否处于锁定期
+func accountLocked(lockedUntil sql.NullTime) bool {
+	return lockedUntil.Valid && time.Now().Before(lockedUntil.Time)
+}
+
+// checkAccountLock 账户处于锁定期时写入与限速相同的429响应并返回false
+func checkAccountLock(c *gin.Context, lockedUntil sql.NullTime) bool {
+	if !accountLocked(lockedUntil) {
+		return true
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(lockedUntil.Time).Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, models.APIResponse{
+		Success: false,
+		Message: "Too many attempts, please try again later",
+	})
+	return false
+}
+
+// recordLoginFailure 记录一次密码或第二因素错误，连续失败达到上限时锁定账户
+func recordLoginFailure(userID int, username string) {
+	lockedUntil := time.Now().UTC().Add(LockoutDuration)
+	_, err := database.DB.Exec(`
+		UPDATE users SET
+			failed_logins = CASE WHEN failed_logins + 1 >= ? THEN 0 ELSE failed_logins + 1 END,
+			locked_until = CASE WHEN failed_logins + 1 >= ? THEN ? ELSE locked_until END
+		WHERE id = ?`,
+		MaxFailedLogins, MaxFailedLogins, lockedUntil, userID,
+	)
+	if err != nil {
+		log.Printf("Failed to record login failure of user %d: %v", userID, err)
+		return
+	}
+
+	// 计数在锁定时归零
+	var failures int
+	var locked sql.NullTime
+	database.DB.QueryRow("SELECT failed_logins, locked_until FROM users WHERE id = ?", userID).Scan(&failures, &locked)
+	if failures == 0 && accountLocked(locked) {
+		log.Printf("Account %s locked until %s after %d failed login attempts", username, locked.Time.Format(time.RFC3339), MaxFailedLogins)
+	}
+}
+
+// checkSecondFactorLimit 检查第二因素尝试的按用户限速和账户锁定，超出时写入响应并返回false。
+// 第二因素与密码共用失败计数，持有密码的人不能靠反复获取新票据无限猜测验证码
+func checkSecondFactorLimit(c *gin.Context, user models.User) bool {
+	if !checkRateLimit(c, loginUserLimiter, usernameKey(user.Username)) {
+		return false
+	}
+
+	var lockedUntil sql.NullTime
+	if err := database.DB.QueryRow("SELECT locked_until FROM users WHERE id = ?", user.ID).Scan(&lockedUntil); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return false
+	}
+	return checkAccountLock(c, lockedUntil)
+}
+
+// recordSecondFactorFailure 记录一次第二因素验证失败，与密码错误一样计入限速和账户锁定
+func recordSecondFactorFailure(c *gin.Context, user models.User) {
+	loginIPLimiter.Record(c.ClientIP())
+	loginUserLimiter.Record(usernameKey(user.Username))
+	recordLoginFailure(user.ID, user.Username)
+}
+
+// loginSucceeded 全部认证步骤通过、即将创建会话时清除用户的失败计数
+func loginSucceeded(user models.User) {
+	loginUserLimiter.Reset(usernameKey(user.Username))
+	resetLoginFailures(user.ID)
+}
+
+// resetLoginFailures 登录成功后清除失败计数
+func resetLoginFailures(userID int) {
+	database.DB.Exec("UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ? AND (failed_logins > 0 OR locked_until IS NOT NULL)", userID)
+}
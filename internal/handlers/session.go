@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"gopass/internal/auth"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startSession 为已通过验证的用户创建会话，缓存保险库密钥并签发令牌。
+// 失败时已写入错误响应并返回nil
+func startSession(c *gin.Context, user models.User, vaultKey []byte) map[string]interface{} {
+	sessionID, refreshToken, err := session.Create(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create session",
+		})
+		return nil
+	}
+
+	// 生成JWT令牌
+	token, err := auth.GenerateToken(user.ID, user.Username, sessionID)
+	if err != nil {
+		session.Revoke(sessionID)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return nil
+	}
+	storeSessionKey(sessionID, user.ID, vaultKey)
+
+	verified, err := emailVerified(user.ID)
+	if err != nil {
+		log.Printf("Failed to load email status of user %d: %v", user.ID, err)
+	}
+	notifyNewDevice(user, verified, c.Request.UserAgent(), c.ClientIP())
+
+	return map[string]interface{}{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+		"user": map[string]interface{}{
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"email_verified": verified,
+		},
+	}
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	userID, sessionID, refreshToken, err := session.Refresh(req.RefreshToken)
+	if err == session.ErrSessionInvalid || err == session.ErrTokenReused {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Session has expired or been revoked",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to refresh session",
+		})
+		return
+	}
+
+	var username string
+	if err := database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Session has expired or been revoked",
+		})
+		return
+	}
+
+	token, err := auth.GenerateToken(userID, username, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to generate token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Token refreshed successfully",
+		Data: map[string]interface{}{
+			"token":         token,
+			"refresh_token": refreshToken,
+			"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+		},
+	})
+}
+
+// Logout 退出登录，撤销当前会话
+func Logout(c *gin.Context) {
+	if err := session.Revoke(c.GetString("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// GetSessions 获取当前用户的所有登录会话
+func GetSessions(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	sessions, err := session.List(userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Sessions retrieved successfully",
+		Data:    sessions,
+	})
+}
+
+// RevokeSession 撤销指定会话，例如丢失设备上的登录
+func RevokeSession(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	sessionID := c.Param("id")
+	sessions, err := session.List(userID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	found := false
+	for _, s := range sessions {
+		if s.ID == sessionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return
+	}
+
+	if err := session.Revoke(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions 撤销除当前会话外的所有会话
+func RevokeOtherSessions(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	revoked, err := session.RevokeUser(userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Sessions revoked successfully",
+		Data: map[string]interface{}{
+			"revoked": revoked,
+		},
+	})
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/oidc"
+	"gopass/internal/utils"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ssoStateTTL 跳转到身份提供者后完成授权的时限
+	ssoStateTTL = 10 * time.Minute
+	// ssoTicketTTL 单点登录成功后输入主密码的时限
+	ssoTicketTTL = 5 * time.Minute
+	// maxSSOUnlockAttempts 每张票据允许的主密码尝试次数
+	maxSSOUnlockAttempts = 5
+)
+
+var (
+	errSSOEmailRequired = errors.New("identity provider did not return an email address")
+	errSSOEmailTaken    = errors.New("email is already used by a local account")
+)
+
+// oidcProvider 已配置的身份提供者，为nil时单点登录关闭
+var oidcProvider *oidc.Provider
+
+// SetOIDCProvider 设置单点登录使用的身份提供者
+func SetOIDCProvider(provider *oidc.Provider) {
+	oidcProvider = provider
+}
+
+// ssoAuthorization 已发起、等待身份提供者回调的授权，以 state 为键
+type ssoAuthorization struct {
+	verifier  string
+	nonce     string
+	expiresAt time.Time
+}
+
+// ssoLogin 已通过单点登录、等待输入主密码的登录
+type ssoLogin struct {
+	user       models.User
+	needsSetup bool
+	expiresAt  time.Time
+	attempts   int
+}
+
+var (
+	ssoMu             sync.Mutex
+	ssoAuthorizations = make(map[string]*ssoAuthorization)
+	ssoLogins         = make(map[string]*ssoLogin)
+)
+
+// GetSSOStatus 返回是否启用了单点登录，供登录页决定是否显示入口
+func GetSSOStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Single sign-on status retrieved successfully",
+		Data: map[string]interface{}{
+			"enabled": oidcProvider != nil,
+		},
+	})
+}
+
+// SSOLogin 生成 state、nonce 和 PKCE 验证码后跳转到身份提供者
+func SSOLogin(c *gin.Context) {
+	if oidcProvider == nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Single sign-on is not configured",
+		})
+		return
+	}
+
+	state, err := auth.NewSessionID()
+	if err == nil {
+		var nonce, verifier, challenge, authURL string
+		nonce, err = auth.NewSessionID()
+		if err == nil {
+			verifier, challenge, err = oidc.NewPKCE()
+		}
+		if err == nil {
+			authURL, err = oidcProvider.AuthCodeURL(state, nonce, challenge)
+		}
+		if err == nil {
+			ssoMu.Lock()
+			sweepSSOLocked(time.Now())
+			ssoAuthorizations[state] = &ssoAuthorization{
+				verifier:  verifier,
+				nonce:     nonce,
+				expiresAt: time.Now().Add(ssoStateTTL),
+			}
+			ssoMu.Unlock()
+
+			c.Redirect(http.StatusFound, authURL)
+			return
+		}
+	}
+
+	log.Printf("Failed to start single sign-on: %v", err)
+	c.JSON(http.StatusBadGateway, models.APIResponse{
+		Success: false,
+		Message: "Identity provider is unavailable",
+	})
+}
+
+// SSOCallback 身份提供者回调：换取并校验ID令牌，按 sub 查找或自动创建用户，
+// 然后带着票据跳回登录页输入主密码。票据放在URL片段中，不会发送到服务器日志
+func SSOCallback(c *gin.Context) {
+	if oidcProvider == nil {
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape("Single sign-on is not configured"))
+		return
+	}
+
+	ssoMu.Lock()
+	authorization, ok := ssoAuthorizations[c.Query("state")]
+	delete(ssoAuthorizations, c.Query("state"))
+	ssoMu.Unlock()
+
+	if !ok || time.Now().After(authorization.expiresAt) {
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape("Sign-in expired, please try again"))
+		return
+	}
+	if errorCode := c.Query("error"); errorCode != "" {
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape("Sign-in was cancelled: "+errorCode))
+		return
+	}
+
+	claims, err := oidcProvider.Exchange(c.Query("code"), authorization.verifier, authorization.nonce)
+	if err != nil {
+		log.Printf("Single sign-on failed: %v", err)
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape("Sign-in failed"))
+		return
+	}
+
+	user, needsSetup, err := findOrProvisionSSOUser(oidcProvider.Issuer(), claims)
+	if err == errSSOEmailRequired || err == errSSOEmailTaken {
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape(err.Error()))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to provision single sign-on user %s: %v", claims.Subject, err)
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape("Sign-in failed"))
+		return
+	}
+
+	ticket, err := auth.NewSessionID()
+	if err != nil {
+		c.Redirect(http.StatusFound, "/#sso_error="+url.QueryEscape("Sign-in failed"))
+		return
+	}
+
+	ssoMu.Lock()
+	ssoLogins[ticket] = &ssoLogin{user: user, needsSetup: needsSetup, expiresAt: time.Now().Add(ssoTicketTTL)}
+	ssoMu.Unlock()
+
+	fragment := url.Values{}
+	fragment.Set("sso_token", ticket)
+	fragment.Set("username", user.Username)
+	if needsSetup {
+		fragment.Set("setup", "1")
+	}
+	c.Redirect(http.StatusFound, "/#"+fragment.Encode())
+}
+
+// SSOUnlock 单点登录第二步：输入主密码解锁保险库。
+// 自动创建的账户首次登录时设置主密码，并返回只显示一次的恢复密钥
+func SSOUnlock(c *gin.Context) {
+	var req models.SSOUnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, loginIPLimiter, c.ClientIP()) {
+		return
+	}
+
+	ssoMu.Lock()
+	pending, ok := ssoLogins[req.SSOToken]
+	if ok {
+		pending.attempts++
+		if time.Now().After(pending.expiresAt) || pending.attempts > maxSSOUnlockAttempts {
+			delete(ssoLogins, req.SSOToken)
+			ok = false
+		}
+	}
+	ssoMu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Sign-in expired, please try again",
+		})
+		return
+	}
+
+	var vaultKey []byte
+	var extra map[string]interface{}
+	var err error
+	if pending.needsSetup {
+		if valid, msg := utils.ValidatePassword(req.Password, 8, true); !valid {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: msg,
+			})
+			return
+		}
+
+		var recoveryKey string
+		vaultKey, recoveryKey, err = vault.Setup(pending.user.ID, req.Password)
+		extra = map[string]interface{}{"recovery_key": recoveryKey}
+	} else {
+		vaultKey, err = vault.Unlock(pending.user.ID, req.Password)
+	}
+
+	if err == vault.ErrWrongPassword {
+		loginIPLimiter.Record(c.ClientIP())
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid master password",
+		})
+		return
+	}
+	if err != nil {
+		vaultError(c, "Failed to unlock vault", err)
+		return
+	}
+	defer crypto.Wipe(vaultKey)
+
+	ssoMu.Lock()
+	delete(ssoLogins, req.SSOToken)
+	ssoMu.Unlock()
+
+	finishLogin(c, pending.user, vaultKey, extra)
+}
+
+// findOrProvisionSSOUser 按签发者和 sub 查找关联的用户，不存在时自动创建。
+// 自动创建的账户没有主密码，needsSetup 为true
+func findOrProvisionSSOUser(issuer string, claims *oidc.Claims) (models.User, bool, error) {
+	var user models.User
+	var passwordHash string
+	err := database.DB.QueryRow(`
+		SELECT u.id, u.username, u.email, u.password_hash
+		FROM oidc_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = ? AND i.subject = ?`,
+		issuer, claims.Subject,
+	).Scan(&user.ID, &user.Username, &user.Email, &passwordHash)
+	if err == nil {
+		return user, passwordHash == "", nil
+	}
+	if err != sql.ErrNoRows {
+		return user, false, err
+	}
+
+	// 不按邮箱关联已有的本地账户，否则身份提供者中的同名邮箱即可接管账户
+	email := utils.SanitizeInput(claims.Email)
+	if email == "" || !utils.ValidateEmail(email) {
+		return user, false, errSSOEmailRequired
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", email).Scan(&exists); err != nil {
+		return user, false, err
+	}
+	if exists {
+		return user, false, errSSOEmailTaken
+	}
+
+	username, err := availableUsername(claims)
+	if err != nil {
+		return user, false, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return user, false, err
+	}
+	defer tx.Rollback()
+
+	// 身份提供者已验证的邮箱无需再验证
+	verifiedAt := sql.NullTime{Time: time.Now().UTC(), Valid: claims.EmailVerified}
+	result, err := tx.Exec(
+		"INSERT INTO users (username, password_hash, email, email_verified_at, vault_format, created_at, updated_at) VALUES (?, '', ?, ?, ?, ?, ?)",
+		username, email, verifiedAt, vault.CurrentFormat, time.Now(), time.Now(),
+	)
+	if err != nil {
+		return user, false, err
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return user, false, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO oidc_identities (issuer, subject, user_id) VALUES (?, ?, ?)", issuer, claims.Subject, userID); err != nil {
+		return user, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return user, false, err
+	}
+
+	log.Printf("Provisioned user %s for single sign-on subject %s", username, claims.Subject)
+	return models.User{ID: int(userID), Username: username, Email: email}, true, nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// availableUsername 根据 preferred_username 或邮箱生成可用的用户名，重名时追加数字
+func availableUsername(claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "-")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if valid, _ := utils.ValidateUsername(base); !valid {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", candidate).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
+
+// ssoLinked 检查账户是否由单点登录创建，这类账户不能用主密码直接登录
+func ssoLinked(userID int) (bool, error) {
+	var linked bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM oidc_identities WHERE user_id = ?)", userID).Scan(&linked)
+	return linked, err
+}
+
+// sweepSSOLocked 清理过期的授权和票据，调用方需持有锁
+func sweepSSOLocked(now time.Time) {
+	for state, authorization := range ssoAuthorizations {
+		if now.After(authorization.expiresAt) {
+			delete(ssoAuthorizations, state)
+		}
+	}
+	for ticket, pending := range ssoLogins {
+		if now.After(pending.expiresAt) {
+			delete(ssoLogins, ticket)
+		}
+	}
+}
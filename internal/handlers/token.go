@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"gopass/internal/apitoken"
+	"gopass/internal/crypto"
+	"gopass/internal/models"
+	"gopass/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAPITokens 获取当前用户的个人访问令牌
+func GetAPITokens(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	tokens, err := apitoken.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API tokens retrieved successfully",
+		Data:    tokens,
+	})
+}
+
+// CreateAPIToken 创建个人访问令牌，令牌只在此次响应中返回
+func CreateAPIToken(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	name := utils.SanitizeInput(req.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "令牌名称长度必须在1到100个字符之间",
+		})
+		return
+	}
+
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !apitoken.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Unknown scope: " + scope + ". Valid scopes: " + strings.Join(apitoken.Scopes, ", "),
+			})
+			return
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "At least one scope is required",
+		})
+		return
+	}
+
+	categories := []string{}
+	for _, category := range req.Categories {
+		category = utils.SanitizeInput(category)
+		if valid, msg := utils.ValidateCategory(category); !valid || category == "" {
+			if msg == "" {
+				msg = "分类名称不能为空"
+			}
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: msg,
+			})
+			return
+		}
+		if !containsString(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	token, t, err := apitoken.Create(userID, encryptionKey, name, scopes, categories, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create API token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "API token created successfully. Copy it now, it will not be shown again",
+		Data: map[string]interface{}{
+			"token":     token,
+			"api_token": t,
+		},
+	})
+}
+
+// RevokeAPIToken 撤销个人访问令牌
+func RevokeAPIToken(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	err := apitoken.Revoke(userID, c.Param("id"))
+	if err == apitoken.ErrNotFound {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "API token not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke API token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API token revoked successfully",
+	})
+}
+
+// containsString 检查切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
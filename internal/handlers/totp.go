@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/models"
+	"gopass/internal/otp"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPasswordTOTP 计算密码条目中两步验证密钥的当前验证码
+func GetPasswordTOTP(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	encryptionKey := getVaultKey(c, userID)
+	if encryptionKey == nil {
+		return
+	}
+	defer crypto.Wipe(encryptionKey)
+
+	passwordID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid password ID",
+		})
+		return
+	}
+
+	var category, ciphertext string
+	err = database.DB.QueryRow(
+		"SELECT category, totp_secret FROM passwords WHERE id = ? AND user_id = ?", passwordID, userID,
+	).Scan(&category, &ciphertext)
+	if err != nil || !tokenAllowsCategory(c, category) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Password entry not found",
+		})
+		return
+	}
+
+	if ciphertext == "" {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Password entry has no TOTP secret",
+		})
+		return
+	}
+
+	secret, err := vault.DecryptField(encryptionKey, userID, passwordID, "totp_secret", ciphertext)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to decrypt TOTP secret",
+		})
+		return
+	}
+
+	key, err := otp.Parse(secret)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, models.APIResponse{
+			Success: false,
+			Message: "Stored TOTP secret is invalid",
+		})
+		return
+	}
+
+	now := time.Now()
+	code := key.Code(now)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "TOTP code generated successfully",
+		Data: models.TOTPCodeResponse{
+			Code:      code,
+			Remaining: key.Remaining(now),
+			Period:    key.Period,
+			Digits:    len(code),
+			Steam:     key.Steam,
+			Issuer:    key.Issuer,
+			Account:   key.Account,
+		},
+	})
+}
@@ -2,14 +2,19 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 	"time"
 
-	"gopass/internal/auth"
+	"gopass/internal/apitoken"
+	"gopass/internal/authn"
 	"gopass/internal/crypto"
 	"gopass/internal/database"
+	"gopass/internal/mfa"
 	"gopass/internal/models"
+	"gopass/internal/session"
 	"gopass/internal/utils"
+	"gopass/internal/vault"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,6 +30,21 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// 启用目录后账户来自目录，不允许抢注同事的用户名
+	if directory != nil {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Message: "Registration is disabled, sign in with your directory account",
+		})
+		return
+	}
+
+	// 每个IP每天只能注册少量账户
+	if !checkRateLimit(c, registerLimiter, c.ClientIP()) {
+		return
+	}
+	registerLimiter.Record(c.ClientIP())
+
 	// 验证输入
 	if valid, msg := utils.ValidateUsername(req.Username); !valid {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -83,10 +103,31 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// 生成保险库密钥并用主密码派生的密钥包装
+	vaultKey, wrapped, err := vault.NewVaultKey(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create vault key",
+		})
+		return
+	}
+
+	// 生成恢复密钥，独立包装保险库密钥，忘记密码时可用它重置
+	recoveryKey, recoveryWrapped, err := vault.NewRecoveryKey(vaultKey)
+	crypto.Wipe(vaultKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to create recovery key",
+		})
+		return
+	}
+
 	// 插入用户
 	result, err := database.DB.Exec(
-		"INSERT INTO users (username, password_hash, email, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		req.Username, hashedPassword, req.Email, time.Now(), time.Now(),
+		"INSERT INTO users (username, password_hash, email, kdf_salt, kdf_params, vault_key, vault_key_id, recovery_key, vault_format, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		req.Username, hashedPassword, req.Email, wrapped.Salt, wrapped.Params, wrapped.VaultKey, wrapped.KeyID, recoveryWrapped, vault.CurrentFormat, time.Now(), time.Now(),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
@@ -98,15 +139,91 @@ func Register(c *gin.Context) {
 
 	userID, _ := result.LastInsertId()
 
+	if err := sendVerificationEmail(int(userID), req.Username, req.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
 		Message: "User created successfully",
 		Data: map[string]interface{}{
-			"user_id": userID,
+			"user_id":      userID,
+			"recovery_key": recoveryKey,
 		},
 	})
 }
 
+// RecoverAccount 使用恢复密钥重置登录密码
+func RecoverAccount(c *gin.Context) {
+	var req models.RecoverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, recoverLimiter, c.ClientIP()) || !checkRateLimit(c, recoverLimiter, usernameKey(req.Username)) {
+		return
+	}
+
+	if valid, msg := utils.ValidatePassword(req.NewPassword, 8, true); !valid {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	var userID int
+	err := database.DB.QueryRow("SELECT id FROM users WHERE username = ?", req.Username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		recoverLimiter.Record(c.ClientIP())
+		recoverLimiter.Record(usernameKey(req.Username))
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid recovery key",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	err = vault.ResetPassword(userID, req.RecoveryKey, req.NewPassword)
+	if err == vault.ErrWrongRecoveryKey {
+		recoverLimiter.Record(c.ClientIP())
+		recoverLimiter.Record(usernameKey(req.Username))
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid recovery key",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	// 密码已重置，之前登录的设备和个人访问令牌全部失效，账户锁定随之解除
+	session.RevokeUser(userID, "")
+	apitoken.RevokeUser(userID)
+	resetLoginFailures(userID)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Password reset successfully",
+	})
+}
+
 // Login 用户登录
 func Login(c *gin.Context) {
 	var req models.LoginRequest
@@ -118,21 +235,94 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 查询用户
+	// 按IP和用户名限速
+	ipKey := c.ClientIP()
+	userKey := usernameKey(req.Username)
+	if !checkRateLimit(c, loginIPLimiter, ipKey) || !checkRateLimit(c, loginUserLimiter, userKey) {
+		return
+	}
+
+	// 查询用户，目录账户首次登录时本地还没有记录
 	var user models.User
+	var source string
+	var lockedUntil sql.NullTime
 	err := database.DB.QueryRow(
-		"SELECT id, username, password_hash, email FROM users WHERE username = ?",
+		"SELECT id, username, password_hash, email, auth_source, locked_until FROM users WHERE username = ?",
 		req.Username,
-	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email)
+	).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &source, &lockedUntil)
+	found := err == nil
 
-	if err == sql.ErrNoRows {
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	// 账户锁定期间不验证密码，与限速使用相同的响应
+	if found && !checkAccountLock(c, lockedUntil) {
+		return
+	}
+
+	// 按账户来源验证密码
+	authenticator := authenticatorFor(found, source)
+	if authenticator == nil {
+		log.Printf("Login of %s failed: authentication source %q is not configured", user.Username, source)
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Message: "Authentication service is unavailable",
+		})
+		return
+	}
+
+	identity, err := authenticator.Authenticate(req.Username, req.Password)
+	if err == authn.ErrInvalidCredentials {
+		loginIPLimiter.Record(ipKey)
+		loginUserLimiter.Record(userKey)
+		if found {
+			recordLoginFailure(user.ID, user.Username)
+		}
 		c.JSON(http.StatusUnauthorized, models.APIResponse{
 			Success: false,
 			Message: "Invalid credentials",
 		})
 		return
 	}
+	if err != nil {
+		log.Printf("Login of %s failed: %v", req.Username, err)
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Message: "Authentication service is unavailable",
+		})
+		return
+	}
 
+	// 目录中验证通过的用户，找到或创建对应的本地账户
+	if !found {
+		source = authenticator.Source()
+		user, lockedUntil, err = directoryUser(source, identity)
+		if err == errDirectoryEmailRequired || err == errDirectoryEmailTaken || err == errDirectoryUsernameTaken {
+			c.JSON(http.StatusConflict, models.APIResponse{
+				Success: false,
+				Message: "Cannot create account: " + err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+			})
+			return
+		}
+		if !checkAccountLock(c, lockedUntil) {
+			return
+		}
+	}
+
+	// 单点登录账户的主密码只用于解锁保险库，登录必须经过身份提供者
+	linked, err := ssoLinked(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -140,36 +330,156 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
-
-	// 验证密码
-	if !crypto.CheckPasswordHash(req.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, models.APIResponse{
+	if linked {
+		c.JSON(http.StatusForbidden, models.APIResponse{
 			Success: false,
-			Message: "Invalid credentials",
+			Message: "This account signs in with single sign-on",
 		})
 		return
 	}
 
-	// 生成JWT令牌
-	token, err := auth.GenerateToken(user.ID, user.Username)
+	// 解开保险库密钥，仅在会话期间保存在内存中
+	vaultKey, extra, ok := unlockLoginVault(c, user, source, req)
+	if !ok {
+		return
+	}
+	defer crypto.Wipe(vaultKey)
+
+	finishLogin(c, user, vaultKey, extra)
+}
+
+// unlockLoginVault 用登录密码解开保险库密钥，失败时写入响应并返回false。
+// 目录账户的保险库由目录密码包装：首次登录时建立保险库并返回恢复密钥；
+// 目录中改过密码后，需要提供旧密码重新包装
+func unlockLoginVault(c *gin.Context, user models.User, source string, req models.LoginRequest) ([]byte, map[string]interface{}, bool) {
+	if source != authn.SourceLocal && user.PasswordHash == "" {
+		vaultKey, recoveryKey, err := vault.Setup(user.ID, req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to unlock vault",
+			})
+			return nil, nil, false
+		}
+		return vaultKey, map[string]interface{}{"recovery_key": recoveryKey}, true
+	}
+
+	vaultKey, err := vault.Unlock(user.ID, req.Password)
+	if err == vault.ErrWrongPassword && source != authn.SourceLocal {
+		if req.PreviousPassword == "" {
+			c.JSON(http.StatusConflict, models.APIResponse{
+				Success: false,
+				Message: "Your directory password has changed, enter your previous password to unlock the vault",
+				Data: map[string]interface{}{
+					"previous_password_required": true,
+				},
+			})
+			return nil, nil, false
+		}
+
+		err = vault.ChangePassword(user.ID, req.PreviousPassword, req.Password)
+		if err == vault.ErrWrongPassword {
+			loginIPLimiter.Record(c.ClientIP())
+			c.JSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Message: "Invalid previous password",
+			})
+			return nil, nil, false
+		}
+		if err == nil {
+			vaultKey, err = vault.Unlock(user.ID, req.Password)
+		}
+	}
+	if err != nil {
+		vaultError(c, "Failed to unlock vault", err)
+		return nil, nil, false
+	}
+	return vaultKey, nil, true
+}
+
+// finishLogin 主密码验证通过后完成登录：启用了两步验证时先返回票据，否则直接创建会话。
+// extra 中的字段会附加到响应数据中
+func finishLogin(c *gin.Context, user models.User, vaultKey []byte, extra map[string]interface{}) {
+	// 启用了两步验证时，先返回票据，验证码通过后再签发令牌
+	mfaEnabled, err := mfa.Enabled(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
-			Message: "Failed to generate token",
+			Message: "Database error",
+		})
+		return
+	}
+	if mfaEnabled {
+		methods, options, err := mfaMethods(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+			})
+			return
+		}
+
+		challenge := ""
+		if options != nil {
+			challenge = options.Challenge
+		}
+		ticket, err := beginMFALogin(user, vaultKey, challenge)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to create session",
+			})
+			return
+		}
+
+		data := map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    ticket,
+			"mfa_methods":  methods,
+		}
+		if options != nil {
+			data["webauthn"] = options
+		}
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Two-factor authentication required",
+			Data:    mergeData(data, extra),
 		})
 		return
 	}
 
+	loginSucceeded(user)
+	data := startSession(c, user, vaultKey)
+	if data == nil {
+		return
+	}
+	data = mergeData(data, extra)
+	issueMissingRecoveryKey(user.ID, vaultKey, data)
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "Login successful",
-		Data: map[string]interface{}{
-			"token": token,
-			"user": map[string]interface{}{
-				"id":       user.ID,
-				"username": user.Username,
-				"email":    user.Email,
-			},
-		},
+		Data:    data,
 	})
 }
+
+// issueMissingRecoveryKey 账户还没有恢复密钥时（例如从旧版本迁移的账户）生成一个，加入登录响应中展示一次。
+// 只在全部认证步骤通过后调用，失败时不影响登录，下次登录会再次尝试
+func issueMissingRecoveryKey(userID int, vaultKey []byte, data map[string]interface{}) {
+	recoveryKey, err := vault.EnsureRecoveryKey(userID, vaultKey)
+	if err != nil {
+		log.Printf("Failed to issue recovery key to user %d: %v", userID, err)
+		return
+	}
+	if recoveryKey != "" {
+		data["recovery_key"] = recoveryKey
+	}
+}
+
+// mergeData 将 extra 中的字段合并到响应数据中
+func mergeData(data, extra map[string]interface{}) map[string]interface{} {
+	for key, value := range extra {
+		data[key] = value
+	}
+	return data
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopass/internal/apitoken"
+	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/models"
+	"gopass/internal/session"
+	"gopass/internal/vault"
+
+	"github.com/gin-gonic/gin"
+)
+
+// vaultIdleTimeout 会话的保险库密钥闲置多久后自动锁定，0表示只在会话结束时锁定
+var vaultIdleTimeout = 15 * time.Minute
+
+// SetVaultIdleTimeout 设置保险库闲置锁定时间
+func SetVaultIdleTimeout(d time.Duration) {
+	vaultIdleTimeout = d
+}
+
+// storeSessionKey 缓存会话的保险库密钥，闲置超时后自动锁定
+func storeSessionKey(sessionID string, userID int, vaultKey []byte) {
+	vault.Store(sessionID, userID, vaultKey, auth.SessionTTL, vaultIdleTimeout)
+}
+
+// vaultError 写入保险库解锁、迁移或轮换失败的响应。
+// 有条目无法解密时操作已整体回滚，响应中列出这些条目，而不是笼统地报错
+func vaultError(c *gin.Context, message string, err error) {
+	var undecryptable *vault.UndecryptableError
+	if errors.As(err, &undecryptable) {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s: %d password entries cannot be decrypted, the vault was left unchanged", message, len(undecryptable.EntryIDs)),
+			Code:    models.CodeUndecryptableEntries,
+			Data: map[string]interface{}{
+				"entry_ids": undecryptable.EntryIDs,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, models.APIResponse{
+		Success: false,
+		Message: message,
+	})
+}
+
+// UnlockVault 使用主密码重新解锁当前会话的保险库
+func UnlockVault(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	// 与登录共用限速，会话被盗用时不能借此猜测主密码
+	ipKey := c.ClientIP()
+	userKey := usernameKey(c.GetString("username"))
+	if !checkRateLimit(c, loginIPLimiter, ipKey) || !checkRateLimit(c, loginUserLimiter, userKey) {
+		return
+	}
+
+	vaultKey, err := vault.Unlock(userID, req.Password)
+	if err == vault.ErrWrongPassword {
+		loginIPLimiter.Record(ipKey)
+		loginUserLimiter.Record(userKey)
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid master password",
+		})
+		return
+	}
+	if err != nil {
+		vaultError(c, "Failed to unlock vault", err)
+		return
+	}
+	defer crypto.Wipe(vaultKey)
+
+	loginUserLimiter.Reset(userKey)
+	storeSessionKey(c.GetString("session_id"), userID, vaultKey)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Vault unlocked",
+		Data:    vaultStatus(c, userID),
+	})
+}
+
+// LockVault 立即锁定当前会话的保险库，会话本身保持登录
+func LockVault(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	vault.Forget(c.GetString("session_id"))
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Vault locked",
+		Data:    vaultStatus(c, userID),
+	})
+}
+
+// GetVaultStatus 查询当前会话的保险库是否已解锁
+func GetVaultStatus(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Vault status retrieved successfully",
+		Data:    vaultStatus(c, userID),
+	})
+}
+
+// vaultStatus 当前会话的保险库状态
+func vaultStatus(c *gin.Context, userID int) map[string]interface{} {
+	return map[string]interface{}{
+		"locked":       !vault.Unlocked(c.GetString("session_id"), userID),
+		"idle_timeout": int(vaultIdleTimeout.Seconds()),
+	}
+}
+
+// RotateVaultKey 轮换当前用户的保险库密钥并重新加密所有条目
+func RotateVaultKey(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	newKey, result, err := vault.Rotate(userID, req.Password)
+	if err == vault.ErrWrongPassword {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Invalid credentials",
+		})
+		return
+	}
+	if err != nil {
+		vaultError(c, "Failed to rotate vault key", err)
+		return
+	}
+	defer crypto.Wipe(newKey)
+
+	// 当前会话继续使用新密钥，其他会话需要重新登录；个人访问令牌包装的是旧密钥，全部作废
+	sessionID := c.GetString("session_id")
+	storeSessionKey(sessionID, userID, newKey)
+	session.RevokeUser(userID, sessionID)
+	apitoken.RevokeUser(userID)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Vault key rotated successfully",
+		Data:    result,
+	})
+}
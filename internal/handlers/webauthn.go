@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopass/internal/mfa"
+	"gopass/internal/models"
+	"gopass/internal/utils"
+	"gopass/internal/webauthn"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registrationTTL 开始注册到提交验证器响应的时限
+const registrationTTL = 5 * time.Minute
+
+// pendingRegistration 等待验证器响应的安全密钥注册
+type pendingRegistration struct {
+	challenge string
+	expiresAt time.Time
+}
+
+var (
+	// relyingParty 安全密钥的依赖方配置
+	relyingParty = &webauthn.RelyingParty{ID: "localhost", Name: "GoPass", Origins: []string{"http://localhost:8080"}}
+
+	registrationMu       sync.Mutex
+	pendingRegistrations = make(map[int]*pendingRegistration)
+)
+
+// SetRelyingParty 设置安全密钥绑定的站点域名和允许的页面来源
+func SetRelyingParty(rp *webauthn.RelyingParty) {
+	relyingParty = rp
+}
+
+// mfaMethods 返回用户可用于登录第二步的方式。注册了安全密钥时同时生成认证选项，否则选项为nil
+func mfaMethods(userID int) ([]string, *webauthn.RequestOptions, error) {
+	methods := []string{}
+
+	totpEnabled, err := mfa.TOTPEnabled(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if totpEnabled {
+		methods = append(methods, "totp")
+	}
+
+	keys, err := mfa.SecurityKeys(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var options *webauthn.RequestOptions
+	if len(keys) > 0 {
+		challenge, err := webauthn.NewChallenge()
+		if err != nil {
+			return nil, nil, err
+		}
+		request := relyingParty.RequestOptions(challenge, descriptors(keys))
+		options = &request
+		methods = append(methods, "webauthn")
+	}
+
+	return append(methods, "backup_code"), options, nil
+}
+
+// descriptors 返回安全密钥的凭据描述
+func descriptors(keys []mfa.SecurityKey) []webauthn.CredentialDescriptor {
+	list := make([]webauthn.CredentialDescriptor, len(keys))
+	for i := range keys {
+		list[i] = keys[i].Credential.Descriptor()
+	}
+	return list
+}
+
+// LoginWebAuthn 登录第二步：校验安全密钥的签名和签名计数后创建会话
+func LoginWebAuthn(c *gin.Context) {
+	var req models.WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !checkRateLimit(c, loginIPLimiter, c.ClientIP()) {
+		return
+	}
+
+	pending, ok := takePendingLogin(req.MFAToken)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Login expired, please sign in again",
+		})
+		return
+	}
+	if pending.challenge == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "No security keys are registered",
+		})
+		return
+	}
+
+	if !checkSecondFactorLimit(c, pending.user) {
+		return
+	}
+
+	credentialID, err := webauthn.Decode(req.Credential.RawID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	key, err := mfa.FindSecurityKey(pending.user.ID, credentialID)
+	if err == nil {
+		var signCount uint32
+		signCount, err = relyingParty.VerifyAssertion(pending.challenge, &key.Credential, &req.Credential)
+		if err == nil {
+			err = mfa.UpdateSignCount(key, signCount)
+		}
+	}
+	switch err {
+	case nil:
+	case webauthn.ErrSignCount:
+		log.Printf("Security key %d of user %d reported a stale signature counter, it may have been cloned", key.ID, pending.user.ID)
+		recordSecondFactorFailure(c, pending.user)
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Security key was rejected because its signature counter did not increase",
+		})
+		return
+	default:
+		if err != mfa.ErrKeyNotFound && !isWebAuthnError(err) {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Database error",
+			})
+			return
+		}
+		recordSecondFactorFailure(c, pending.user)
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "Security key verification failed",
+		})
+		return
+	}
+
+	completeMFALogin(c, req.MFAToken, pending)
+}
+
+// GetSecurityKeys 列出已注册的安全密钥
+func GetSecurityKeys(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	keys, err := mfa.SecurityKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Security keys retrieved successfully",
+		Data:    keys,
+	})
+}
+
+// BeginSecurityKeyRegistration 验证主密码后返回 navigator.credentials.create 的选项
+func BeginSecurityKeyRegistration(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	handle, err := mfa.UserHandle(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	keys, err := mfa.SecurityKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Database error",
+		})
+		return
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to start security key registration",
+		})
+		return
+	}
+
+	registrationMu.Lock()
+	now := time.Now()
+	for id, pending := range pendingRegistrations {
+		if now.After(pending.expiresAt) {
+			delete(pendingRegistrations, id)
+		}
+	}
+	pendingRegistrations[userID] = &pendingRegistration{challenge: challenge, expiresAt: now.Add(registrationTTL)}
+	registrationMu.Unlock()
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Touch your security key to continue",
+		Data:    relyingParty.CreationOptions(challenge, handle, c.GetString("username"), descriptors(keys)),
+	})
+}
+
+// FinishSecurityKeyRegistration 校验验证器的注册响应并保存安全密钥。
+// 这是用户的第一个第二因素时返回一次性备用码
+func FinishSecurityKeyRegistration(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	var req models.WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	name := utils.SanitizeInput(req.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "安全密钥名称长度必须在1到100个字符之间",
+		})
+		return
+	}
+
+	// 每个挑战只能使用一次
+	registrationMu.Lock()
+	pending, ok := pendingRegistrations[userID]
+	delete(pendingRegistrations, userID)
+	registrationMu.Unlock()
+	if !ok || time.Now().After(pending.expiresAt) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Registration expired, please start again",
+		})
+		return
+	}
+
+	credential, err := relyingParty.VerifyRegistration(pending.challenge, &req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Security key verification failed",
+		})
+		return
+	}
+
+	codes, err := mfa.AddSecurityKey(userID, name, credential)
+	if err == mfa.ErrKeyExists {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Success: false,
+			Message: "Security key is already registered",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to save security key",
+		})
+		return
+	}
+
+	data := map[string]interface{}{}
+	if codes != nil {
+		data["backup_codes"] = codes
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Security key registered successfully",
+		Data:    data,
+	})
+}
+
+// DeleteSecurityKey 验证主密码后删除安全密钥
+func DeleteSecurityKey(c *gin.Context) {
+	userID := getUserID(c)
+	if userID == 0 {
+		return
+	}
+
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid security key ID",
+		})
+		return
+	}
+
+	var req models.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request data",
+		})
+		return
+	}
+
+	if !verifyPassword(c, userID, req.Password) {
+		return
+	}
+
+	err = mfa.RemoveSecurityKey(userID, keyID)
+	if err == mfa.ErrKeyNotFound {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Security key not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to remove security key",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Security key removed successfully",
+	})
+}
+
+// isWebAuthnError 判断是否为验证器响应无效，而不是服务器错误
+func isWebAuthnError(err error) bool {
+	return errors.Is(err, webauthn.ErrInvalidResponse) || errors.Is(err, webauthn.ErrUnsupported)
+}
@@ -0,0 +1,138 @@
+package keystore
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// JWT签名密钥的元数据保存在 jwt_keys 表中，密钥材料以 "jwt:<kid>" 为名保存在 server_keys 中
+
+// LoadJWTKeys 加载JWT签名密钥。当前没有指定算法的激活密钥时生成新密钥（即切换算法会自动轮换）；
+// 退役不足 retention 的旧密钥仍用于验证，更早退役的密钥被删除
+func LoadJWTKeys(algorithm string, retention time.Duration) (*auth.SigningKey, []*auth.SigningKey, error) {
+	var activeAlgorithm string
+	err := database.DB.QueryRow("SELECT algorithm FROM jwt_keys WHERE active = 1").Scan(&activeAlgorithm)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+	if err == sql.ErrNoRows || activeAlgorithm != algorithm {
+		if _, err := RotateJWTKey(algorithm); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rows, err := database.DB.Query("SELECT kid, algorithm, active, retired_at FROM jwt_keys")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type keyRow struct {
+		kid, algorithm string
+		active         bool
+		retiredAt      sql.NullTime
+	}
+	var keyRows []keyRow
+	for rows.Next() {
+		var r keyRow
+		if err := rows.Scan(&r.kid, &r.algorithm, &r.active, &r.retiredAt); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		keyRows = append(keyRows, r)
+	}
+	rows.Close()
+
+	var active *auth.SigningKey
+	var others []*auth.SigningKey
+	cutoff := time.Now().Add(-retention)
+	for _, r := range keyRows {
+		if !r.active && r.retiredAt.Valid && r.retiredAt.Time.Before(cutoff) {
+			// 用它签发的令牌都已过期
+			if err := deleteJWTKey(r.kid); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		material, err := Get("jwt:" + r.kid)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := auth.NewSigningKey(r.kid, r.algorithm, material)
+		crypto.Wipe(material)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if r.active {
+			active = key
+		} else {
+			others = append(others, key)
+		}
+	}
+
+	return active, others, nil
+}
+
+// RotateJWTKey 生成新的签名密钥并设为激活，原激活密钥标记为退役
+func RotateJWTKey(algorithm string) (string, error) {
+	id, err := crypto.RandomBytes(8)
+	if err != nil {
+		return "", err
+	}
+	kid := hex.EncodeToString(id)
+
+	// 生成密钥材料并确认可用于该算法
+	material, err := Get("jwt:" + kid)
+	if err != nil {
+		return "", err
+	}
+	_, err = auth.NewSigningKey(kid, algorithm, material)
+	crypto.Wipe(material)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE jwt_keys SET active = 0, retired_at = ? WHERE active = 1", now); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO jwt_keys (kid, algorithm, active, created_at) VALUES (?, ?, 1, ?)",
+		kid, algorithm, now,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return kid, tx.Commit()
+}
+
+// deleteJWTKey 删除退役的签名密钥及其密钥材料
+func deleteJWTKey(kid string) error {
+	name := "jwt:" + kid
+
+	mu.Lock()
+	if key, ok := cache[name]; ok {
+		crypto.Wipe(key)
+		delete(cache, name)
+	}
+	mu.Unlock()
+
+	if _, err := database.DB.Exec("DELETE FROM server_keys WHERE name = ?", name); err != nil {
+		return err
+	}
+	_, err := database.DB.Exec("DELETE FROM jwt_keys WHERE kid = ?", kid)
+	return err
+}
@@ -0,0 +1,90 @@
+package keystore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// ErrNoKeyProvider 尚未配置密钥后端
+var ErrNoKeyProvider = errors.New("no key provider configured")
+
+var (
+	mu       sync.Mutex
+	provider crypto.KeyProvider
+	cache    = make(map[string][]byte)
+)
+
+// Init 设置服务器根密钥后端
+func Init(p crypto.KeyProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = p
+	for name, key := range cache {
+		crypto.Wipe(key)
+		delete(cache, name)
+	}
+}
+
+// Get 返回指定名称的服务器数据密钥。
+// 数据密钥由根密钥后端包装后存放在 server_keys 表中，首次使用时生成。
+func Get(name string) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if provider == nil {
+		return nil, ErrNoKeyProvider
+	}
+	if key, ok := cache[name]; ok {
+		return append([]byte(nil), key...), nil
+	}
+
+	var wrapped string
+	err := database.DB.QueryRow("SELECT wrapped_key FROM server_keys WHERE name = ?", name).Scan(&wrapped)
+	var key []byte
+	switch {
+	case err == sql.ErrNoRows:
+		key, err = create(name)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		key, err = provider.UnwrapKey(wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap server key %q with %s provider: %v", name, provider.Name(), err)
+		}
+	}
+
+	cache[name] = key
+	return append([]byte(nil), key...), nil
+}
+
+// create 生成新的数据密钥并保存包装后的密文
+func create(name string) ([]byte, error) {
+	key, err := crypto.GenerateRandomKey()
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := provider.WrapKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap server key %q with %s provider: %v", name, provider.Name(), err)
+	}
+
+	_, err = database.DB.Exec(
+		"INSERT INTO server_keys (name, wrapped_key, provider, created_at) VALUES (?, ?, ?, ?)",
+		name, wrapped, provider.Name(), time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
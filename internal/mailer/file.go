@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// File 开发环境使用的发送器，把邮件以可读的纯文本追加到文件，路径为空时写入服务器日志。
+// 正文不做编码，邮件中的链接可以直接复制
+type File struct {
+	path string
+	from string
+
+	mu sync.Mutex
+}
+
+// NewFile 创建写入 path 的发送器
+func NewFile(path, from string) *File {
+	return &File{path: path, from: from}
+}
+
+// Send 记录邮件
+func (f *File) Send(msg Message) error {
+	if err := validate(f.from, msg); err != nil {
+		return err
+	}
+
+	if f.path == "" {
+		log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "From: %s\nTo: %s\nSubject: %s\nDate: %s\n\n%s\n\n", f.from, msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gopass/internal/crypto"
+)
+
+// ErrInvalidMessage 邮件地址无效或头部含有换行
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 发送邮件的后端
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Compose 按 RFC 5322 生成完整的邮件内容，主题使用 MIME 编码，正文使用 quoted-printable
+func Compose(from string, msg Message, date time.Time) ([]byte, error) {
+	if err := validate(from, msg); err != nil {
+		return nil, err
+	}
+
+	id, err := crypto.RandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimSuffix(from[at+1:], ">")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%x@%s>\r\n", id, domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// validate 检查发件人和收件人地址，拒绝头部中的换行以防注入额外的头部或收件人
+func validate(from string, msg Message) error {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: header contains a line break", ErrInvalidMessage)
+		}
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return fmt.Errorf("%w: sender %q", ErrInvalidMessage, from)
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("%w: recipient %q", ErrInvalidMessage, msg.To)
+	}
+	return nil
+}
+
+// address 返回地址中的邮箱部分，用于 SMTP 信封
+func address(value string) (string, error) {
+	parsed, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidMessage, value)
+	}
+	return parsed.Address, nil
+}
@@ -0,0 +1,221 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFrom = "GoPass <noreply@gopass.example.test>"
+
+// startServer 在随机端口启动SMTP替身
+func startServer(t *testing.T, server *MockServer) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go server.Serve(listener)
+	return listener.Addr().String()
+}
+
+// testCertificate 生成 127.0.0.1 的自签名证书，返回服务器TLS配置和信任它的证书池
+func testCertificate(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gopass test mail server"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func newTestSMTP(t *testing.T, config SMTPConfig) *SMTP {
+	t.Helper()
+
+	config.From = testFrom
+	config.Timeout = 2 * time.Second
+	sender, err := NewSMTP(config)
+	if err != nil {
+		t.Fatalf("Failed to create SMTP sender: %v", err)
+	}
+	return sender
+}
+
+// readMessage 解析收到的邮件，返回头部和解码后的正文
+func readMessage(t *testing.T, data []byte) (mail.Header, string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	return msg.Header, string(body)
+}
+
+func TestSMTPSend(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+	server := NewMockServer(serverTLS)
+	server.RequireAuth("gopass", "mail-secret")
+	addr := startServer(t, server)
+
+	sender := newTestSMTP(t, SMTPConfig{
+		Addr:      addr,
+		Username:  "gopass",
+		Password:  "mail-secret",
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+
+	link := "http://localhost:8080/#verify_email=" + strings.Repeat("a", 80)
+	err := sender.Send(Message{To: "alice@example.test", Subject: "验证邮箱", Body: "请打开链接：\n" + link})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	if messages[0].From != "noreply@gopass.example.test" || len(messages[0].To) != 1 || messages[0].To[0] != "alice@example.test" {
+		t.Errorf("Unexpected envelope %s -> %v", messages[0].From, messages[0].To)
+	}
+
+	header, _ := readMessage(t, messages[0].Data)
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "验证邮箱" {
+		t.Errorf("Subject should round-trip, got %q (%v)", subject, err)
+	}
+	if header.Get("Message-ID") == "" || header.Get("Date") == "" {
+		t.Error("Message-ID and Date headers should be set")
+	}
+}
+
+func TestSMTPRejectsWrongCredentials(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+	server := NewMockServer(serverTLS)
+	server.RequireAuth("gopass", "mail-secret")
+	addr := startServer(t, server)
+
+	sender := newTestSMTP(t, SMTPConfig{
+		Addr:      addr,
+		Username:  "gopass",
+		Password:  "wrong",
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	if err := sender.Send(Message{To: "alice@example.test", Subject: "Hi", Body: "Hi"}); err == nil {
+		t.Error("Wrong credentials should be rejected")
+	}
+	if len(server.Messages()) != 0 {
+		t.Error("No message should be delivered")
+	}
+}
+
+func TestSMTPRequiresSTARTTLS(t *testing.T) {
+	addr := startServer(t, NewMockServer(nil))
+
+	// 服务器不支持 STARTTLS 时不能降级为明文
+	sender := newTestSMTP(t, SMTPConfig{Addr: addr})
+	if err := sender.Send(Message{To: "alice@example.test", Subject: "Hi", Body: "Hi"}); err == nil {
+		t.Error("Missing STARTTLS should be rejected")
+	}
+
+	// 不信任的证书
+	serverTLS, _ := testCertificate(t)
+	addr = startServer(t, NewMockServer(serverTLS))
+	sender = newTestSMTP(t, SMTPConfig{Addr: addr})
+	if err := sender.Send(Message{To: "alice@example.test", Subject: "Hi", Body: "Hi"}); err == nil {
+		t.Error("Untrusted certificate should be rejected")
+	}
+}
+
+func TestSMTPPlaintextRelay(t *testing.T) {
+	server := NewMockServer(nil)
+	addr := startServer(t, server)
+
+	sender := newTestSMTP(t, SMTPConfig{Addr: addr, Security: SecurityNone})
+	if err := sender.Send(Message{To: "bob@example.test", Subject: "Hi", Body: "line 1\nline 2"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	_, body := readMessage(t, messages[0].Data)
+	if !strings.Contains(body, "line 1") || !strings.Contains(body, "line 2") {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+func TestComposeRejectsHeaderInjection(t *testing.T) {
+	cases := []Message{
+		{To: "alice@example.test\r\nBcc: eve@example.test", Subject: "Hi"},
+		{To: "alice@example.test", Subject: "Hi\nBcc: eve@example.test"},
+		{To: "not an address", Subject: "Hi"},
+	}
+	for _, msg := range cases {
+		if _, err := Compose(testFrom, msg, time.Now()); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Message %+v should be rejected, got %v", msg, err)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	sender := NewFile(path, testFrom)
+
+	for _, to := range []string{"alice@example.test", "bob@example.test"} {
+		if err := sender.Send(Message{To: to, Subject: "Reset", Body: "http://localhost:8080/#reset_token=abc"}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read mail file: %v", err)
+	}
+	if strings.Count(string(data), "#reset_token=abc") != 2 || !strings.Contains(string(data), "To: bob@example.test") {
+		t.Errorf("Unexpected mail file content:\n%s", data)
+	}
+}
@@ -0,0 +1,241 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Received 替身服务器收到的一封邮件
+type Received struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// MockServer 本地开发和测试使用的SMTP服务器替身。
+// 只实现 EHLO/HELO、STARTTLS、AUTH PLAIN、MAIL、RCPT、DATA、RSET、NOOP 和 QUIT，邮件保存在内存中
+type MockServer struct {
+	tlsConfig *tls.Config
+
+	mu        sync.Mutex
+	username  string
+	password  string
+	messages  []Received
+	onReceive func(Received)
+}
+
+// NewMockServer 创建SMTP替身，tlsConfig 不为nil时支持 STARTTLS
+func NewMockServer(tlsConfig *tls.Config) *MockServer {
+	return &MockServer{tlsConfig: tlsConfig}
+}
+
+// RequireAuth 要求客户端先用 AUTH PLAIN 登录才能发信
+func (s *MockServer) RequireAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username = username
+	s.password = password
+}
+
+// OnReceive 设置收到邮件时的回调
+func (s *MockServer) OnReceive(fn func(Received)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReceive = fn
+}
+
+// Messages 返回已收到的邮件
+func (s *MockServer) Messages() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received(nil), s.messages...)
+}
+
+// Serve 在 listener 上接受连接直到其关闭
+func (s *MockServer) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// mockSession 一个连接上的状态
+type mockSession struct {
+	secure bool
+	authed bool
+	from   string
+	to     []string
+}
+
+// handle 处理一个连接上的命令
+func (s *MockServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 gopass SMTP stand-in ready")
+
+	s.mu.Lock()
+	requireAuth := s.username != ""
+	s.mu.Unlock()
+
+	var session mockSession
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			lines := []string{"gopass"}
+			if s.tlsConfig != nil && !session.secure {
+				lines = append(lines, "STARTTLS")
+			}
+			if requireAuth {
+				lines = append(lines, "AUTH PLAIN")
+			}
+			lines = append(lines, "8BITMIME")
+			for i, l := range lines {
+				separator := "-"
+				if i == len(lines)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, l)
+			}
+		case "HELO":
+			text.PrintfLine("250 gopass")
+		case "STARTTLS":
+			if s.tlsConfig == nil || session.secure {
+				text.PrintfLine("454 TLS not available")
+				continue
+			}
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				log.Printf("SMTP stand-in: TLS handshake failed: %v", err)
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			session = mockSession{secure: true}
+		case "AUTH":
+			s.auth(text, &session, arg)
+		case "MAIL":
+			if requireAuth && !session.authed {
+				text.PrintfLine("530 Authentication required")
+				continue
+			}
+			from, ok := pathArgument(arg, "FROM:")
+			if !ok {
+				text.PrintfLine("501 Syntax error")
+				continue
+			}
+			session.from, session.to = from, nil
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			to, ok := pathArgument(arg, "TO:")
+			if session.from == "" || !ok {
+				text.PrintfLine("503 Bad sequence of commands")
+				continue
+			}
+			session.to = append(session.to, to)
+			text.PrintfLine("250 OK")
+		case "DATA":
+			if len(session.to) == 0 {
+				text.PrintfLine("503 Bad sequence of commands")
+				continue
+			}
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.store(Received{From: session.from, To: session.to, Data: data})
+			session.from, session.to = "", nil
+			text.PrintfLine("250 OK")
+		case "RSET":
+			session.from, session.to = "", nil
+			text.PrintfLine("250 OK")
+		case "NOOP":
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// auth 处理 AUTH PLAIN，初始响应可以在命令中也可以在下一行
+func (s *MockServer) auth(text *textproto.Conn, session *mockSession, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	if !strings.EqualFold(mechanism, "PLAIN") {
+		text.PrintfLine("504 Unrecognized authentication type")
+		return
+	}
+	if s.tlsConfig != nil && !session.secure {
+		text.PrintfLine("538 Encryption required")
+		return
+	}
+	if initial == "" {
+		text.PrintfLine("334 ")
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		initial = line
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(initial)
+	parts := strings.Split(string(decoded), "\x00")
+	s.mu.Lock()
+	ok := err == nil && len(parts) == 3 && parts[1] == s.username && parts[2] == s.password
+	s.mu.Unlock()
+	if !ok {
+		text.PrintfLine("535 Authentication credentials invalid")
+		return
+	}
+	session.authed = true
+	text.PrintfLine("235 Authentication successful")
+}
+
+// store 保存收到的邮件并调用回调
+func (s *MockServer) store(msg Received) {
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	onReceive := s.onReceive
+	s.mu.Unlock()
+
+	if onReceive != nil {
+		onReceive(msg)
+	}
+}
+
+// pathArgument 解析 "FROM:<address>" 形式的参数，忽略其后的扩展参数
+func pathArgument(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(path, "<") {
+		return "", false
+	}
+	end := strings.Index(path, ">")
+	if end < 0 {
+		return "", false
+	}
+	return path[1:end], true
+}
@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SMTP 连接的安全方式
+const (
+	// SecuritySTARTTLS 明文连接后升级为TLS，服务器不支持时拒绝发送
+	SecuritySTARTTLS = "starttls"
+	// SecurityTLS 直接建立TLS连接（通常为465端口）
+	SecurityTLS = "tls"
+	// SecurityNone 不加密，只应用于本机的邮件中继
+	SecurityNone = "none"
+)
+
+// SMTPConfig SMTP 服务器配置
+type SMTPConfig struct {
+	Addr      string // host:port
+	From      string // 发件人，如 "GoPass <noreply@example.com>"
+	Username  string // 为空时不认证
+	Password  string
+	Security  string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// SMTP 通过 SMTP 服务器发送邮件，每封邮件使用一个新连接
+type SMTP struct {
+	config SMTPConfig
+	host   string
+}
+
+// NewSMTP 校验配置并创建 SMTP 发送器
+func NewSMTP(config SMTPConfig) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %v", config.Addr, err)
+	}
+	if _, err := address(config.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q", config.From)
+	}
+
+	switch config.Security {
+	case "":
+		config.Security = SecuritySTARTTLS
+	case SecuritySTARTTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security %q, expected starttls, tls or none", config.Security)
+	}
+
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		config.TLSConfig = config.TLSConfig.Clone()
+	}
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig.ServerName = host
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &SMTP{config: config, host: host}, nil
+}
+
+// Send 发送邮件。设置了用户名时使用 PLAIN 认证，net/smtp 只允许在TLS连接或本机上发送密码
+func (s *SMTP) Send(msg Message) error {
+	data, err := Compose(s.config.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	from, _ := address(s.config.From)
+	to, _ := address(msg.To)
+
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	var conn net.Conn
+	if s.config.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.Addr, s.config.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.config.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(s.config.Timeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer client.Close()
+
+	if s.config.Security == SecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp: server %s does not support STARTTLS", s.config.Addr)
+		}
+		if err := client.StartTLS(s.config.TLSConfig); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.host)); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return client.Quit()
+}
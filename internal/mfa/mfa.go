@@ -0,0 +1,327 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/keystore"
+	"gopass/internal/otp"
+)
+
+// Issuer 显示在身份验证器应用中的名称
+const Issuer = "GoPass"
+
+// BackupCodeCount 每次生成的备用码数量
+const BackupCodeCount = 10
+
+var (
+	// ErrNotEnrolled 用户没有待验证或已启用的TOTP密钥
+	ErrNotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrAlreadyEnabled 已经启用了两步验证
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrInvalidCode 验证码或备用码错误
+	ErrInvalidCode = errors.New("invalid verification code")
+)
+
+// TOTP密钥使用服务器数据密钥 "totp" 加密，备用码以服务器数据密钥 "mfa" 计算HMAC后保存。
+// keystore 首次使用时会写入数据库，因此不能在事务内调用
+
+// 第二因素可以是TOTP和安全密钥中的任意一种或多种，备用码在启用第一个因素时生成，全部关闭后删除
+
+// Enabled 返回用户是否启用了两步验证（TOTP或安全密钥）
+func Enabled(userID int) (bool, error) {
+	var enabled bool
+	err := database.DB.QueryRow(`
+		SELECT totp_enabled = 1 OR EXISTS(SELECT 1 FROM webauthn_credentials WHERE user_id = users.id)
+		FROM users WHERE id = ?`, userID,
+	).Scan(&enabled)
+	return enabled, err
+}
+
+// TOTPEnabled 返回用户是否启用了TOTP
+func TOTPEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := database.DB.QueryRow("SELECT totp_enabled FROM users WHERE id = ?", userID).Scan(&enabled)
+	return enabled, err
+}
+
+// BackupCodesRemaining 返回未使用的备用码数量
+func BackupCodesRemaining(userID int) (int, error) {
+	var remaining int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM mfa_backup_codes WHERE user_id = ? AND used_at IS NULL", userID,
+	).Scan(&remaining)
+	return remaining, err
+}
+
+// Setup 为用户生成新的TOTP密钥，验证通过后才会启用。返回密钥和 otpauth URI
+func Setup(userID int, account string) (string, string, error) {
+	enabled, err := TOTPEnabled(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrAlreadyEnabled
+	}
+
+	secret, err := otp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	encrypted, err := encryptSecret(userID, secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET totp_secret = ?, totp_last_counter = 0 WHERE id = ?", encrypted, userID,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, otp.URI(Issuer, account, secret), nil
+}
+
+// Enable 使用应用生成的验证码确认密钥并启用两步验证，返回新的备用码
+func Enable(userID int, code string) ([]string, error) {
+	secret, enabled, lastCounter, err := loadSecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	counter, ok := validateTOTP(secret, code, lastCounter)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	// 服务器数据密钥可能需要首次创建，必须在事务之外获取
+	hmacKey, err := keystore.Get("mfa")
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(hmacKey)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = 1, totp_last_counter = ? WHERE id = ?", counter, userID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceBackupCodes(tx, userID, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// Verify 校验登录时提交的TOTP验证码或备用码，备用码只能使用一次。
+// 只注册了安全密钥的用户也可以使用备用码
+func Verify(userID int, code string) error {
+	enabled, err := Enabled(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNotEnrolled
+	}
+
+	secret, totpEnabled, lastCounter, err := loadSecret(userID)
+	if err != nil && err != ErrNotEnrolled {
+		return err
+	}
+	if !totpEnabled {
+		return useBackupCode(userID, code)
+	}
+
+	if counter, ok := validateTOTP(secret, code, lastCounter); ok {
+		// 以旧时间步为条件更新，同一验证码并发提交时只有一次成功
+		result, err := database.DB.Exec(
+			"UPDATE users SET totp_last_counter = ? WHERE id = ? AND totp_last_counter = ?",
+			counter, userID, lastCounter,
+		)
+		if err != nil {
+			return err
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	return useBackupCode(userID, code)
+}
+
+// Disable 关闭TOTP并删除密钥，没有注册安全密钥时一并删除备用码
+func Disable(userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_counter = 0 WHERE id = ?", userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := deleteUnusedBackupCodes(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RegenerateBackupCodes 生成新的备用码，旧备用码全部作废
+func RegenerateBackupCodes(userID int) ([]string, error) {
+	enabled, err := Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrNotEnrolled
+	}
+
+	hmacKey, err := keystore.Get("mfa")
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(hmacKey)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceBackupCodes(tx, userID, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// validateTOTP 用保存的base32密钥校验验证码，返回匹配的时间步
+func validateTOTP(secret, code string, lastCounter int64) (int64, bool) {
+	key, err := otp.Parse(secret)
+	if err != nil {
+		return 0, false
+	}
+	return key.Validate(code, time.Now(), lastCounter)
+}
+
+// loadSecret 读取并解密用户的TOTP密钥
+func loadSecret(userID int) (string, bool, int64, error) {
+	var encrypted sql.NullString
+	var enabled bool
+	var lastCounter int64
+	err := database.DB.QueryRow(
+		"SELECT totp_secret, totp_enabled, totp_last_counter FROM users WHERE id = ?", userID,
+	).Scan(&encrypted, &enabled, &lastCounter)
+	if err != nil {
+		return "", false, 0, err
+	}
+	if !encrypted.Valid || encrypted.String == "" {
+		return "", false, 0, ErrNotEnrolled
+	}
+
+	key, err := keystore.Get("totp")
+	if err != nil {
+		return "", false, 0, err
+	}
+	defer crypto.Wipe(key)
+
+	secret, err := crypto.DecryptWithAAD(encrypted.String, key, secretAAD(userID))
+	if err != nil {
+		return "", false, 0, err
+	}
+	return secret, enabled, lastCounter, nil
+}
+
+// encryptSecret 使用服务器数据密钥加密TOTP密钥
+func encryptSecret(userID int, secret string) (string, error) {
+	key, err := keystore.Get("totp")
+	if err != nil {
+		return "", err
+	}
+	defer crypto.Wipe(key)
+
+	return crypto.EncryptWithAAD(secret, key, secretAAD(userID))
+}
+
+func secretAAD(userID int) []byte {
+	return []byte(fmt.Sprintf("gopass:user=%d:totp", userID))
+}
+
+// replaceBackupCodes 生成新的备用码并替换旧备用码
+func replaceBackupCodes(tx *sql.Tx, userID int, hmacKey []byte) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM mfa_backup_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, BackupCodeCount)
+	for i := range codes {
+		raw, err := crypto.RandomBytes(7)
+		if err != nil {
+			return nil, err
+		}
+		// 取10个base32字符（50位），按5个字符分组
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+
+		hash := hashBackupCode(hmacKey, userID, codes[i])
+		if _, err := tx.Exec("INSERT INTO mfa_backup_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// useBackupCode 校验并消耗一个备用码
+func useBackupCode(userID int, code string) error {
+	hmacKey, err := keystore.Get("mfa")
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(hmacKey)
+
+	hash := hashBackupCode(hmacKey, userID, code)
+
+	result, err := database.DB.Exec(
+		"UPDATE mfa_backup_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, hash,
+	)
+	if err != nil {
+		return err
+	}
+	if used, _ := result.RowsAffected(); used == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// hashBackupCode 计算备用码的HMAC，输入忽略大小写、空格和连字符
+func hashBackupCode(key []byte, userID int, code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d:%s", userID, normalized)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,219 @@
+package mfa
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/keystore"
+	"gopass/internal/webauthn"
+)
+
+var (
+	// ErrKeyNotFound 安全密钥不存在或不属于该用户
+	ErrKeyNotFound = errors.New("security key not found")
+	// ErrKeyExists 该安全密钥已经注册过
+	ErrKeyExists = errors.New("security key is already registered")
+)
+
+// SecurityKey 用户注册的FIDO2安全密钥或通行密钥
+type SecurityKey struct {
+	ID         int                 `json:"id"`
+	Name       string              `json:"name"`
+	CreatedAt  time.Time           `json:"created_at"`
+	LastUsedAt *time.Time          `json:"last_used_at"`
+	Credential webauthn.Credential `json:"-"`
+}
+
+// UserHandle 返回用户在验证器中的随机标识，首次调用时生成。标识不含用户名等个人信息
+func UserHandle(userID int) ([]byte, error) {
+	var handle sql.NullString
+	if err := database.DB.QueryRow("SELECT webauthn_handle FROM users WHERE id = ?", userID).Scan(&handle); err != nil {
+		return nil, err
+	}
+	if handle.Valid {
+		return webauthn.Decode(handle.String)
+	}
+
+	raw, err := crypto.RandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	// 并发生成时只保留先写入的标识
+	_, err = database.DB.Exec(
+		"UPDATE users SET webauthn_handle = ? WHERE id = ? AND webauthn_handle IS NULL", webauthn.Encode(raw), userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.QueryRow("SELECT webauthn_handle FROM users WHERE id = ?", userID).Scan(&handle); err != nil {
+		return nil, err
+	}
+	return webauthn.Decode(handle.String)
+}
+
+// SecurityKeys 列出用户注册的安全密钥
+func SecurityKeys(userID int) ([]SecurityKey, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, name, credential_id, public_key, sign_count, aaguid, transports, created_at, last_used_at
+		FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []SecurityKey{}
+	for rows.Next() {
+		key, err := scanSecurityKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// FindSecurityKey 按凭据ID查找用户的安全密钥
+func FindSecurityKey(userID int, credentialID []byte) (*SecurityKey, error) {
+	key, err := scanSecurityKey(database.DB.QueryRow(`
+		SELECT id, name, credential_id, public_key, sign_count, aaguid, transports, created_at, last_used_at
+		FROM webauthn_credentials WHERE user_id = ? AND credential_id = ?`, userID, webauthn.Encode(credentialID)))
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyNotFound
+	}
+	return key, err
+}
+
+// AddSecurityKey 保存注册成功的安全密钥。这是用户的第一个第二因素时同时生成备用码并返回
+func AddSecurityKey(userID int, name string, credential *webauthn.Credential) ([]string, error) {
+	enabled, err := Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = database.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM webauthn_credentials WHERE credential_id = ?)", webauthn.Encode(credential.ID),
+	).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrKeyExists
+	}
+
+	var hmacKey []byte
+	if !enabled {
+		// 服务器数据密钥可能需要首次创建，必须在事务之外获取
+		if hmacKey, err = keystore.Get("mfa"); err != nil {
+			return nil, err
+		}
+		defer crypto.Wipe(hmacKey)
+	}
+
+	transports, _ := json.Marshal(credential.Transports)
+	if credential.Transports == nil {
+		transports = []byte("[]")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO webauthn_credentials (user_id, name, credential_id, public_key, sign_count, aaguid, transports, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, name, webauthn.Encode(credential.ID), credential.PublicKey, credential.SignCount,
+		hex.EncodeToString(credential.AAGUID), string(transports), time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	if !enabled {
+		if codes, err = replaceBackupCodes(tx, userID, hmacKey); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+// UpdateSignCount 登录成功后记录新的签名计数。
+// 以旧计数为条件更新，同一验证器的两个并发登录只有一个成功
+func UpdateSignCount(key *SecurityKey, signCount uint32) error {
+	result, err := database.DB.Exec(
+		"UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ? AND sign_count = ?",
+		signCount, time.Now().UTC(), key.ID, key.Credential.SignCount,
+	)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return webauthn.ErrSignCount
+	}
+	return nil
+}
+
+// RemoveSecurityKey 删除安全密钥，没有其他第二因素时一并删除备用码
+func RemoveSecurityKey(userID, id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrKeyNotFound
+	}
+	if err := deleteUnusedBackupCodes(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteUnusedBackupCodes 用户没有任何第二因素时删除备用码
+func deleteUnusedBackupCodes(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`
+		DELETE FROM mfa_backup_codes WHERE user_id = ?
+		AND NOT EXISTS (SELECT 1 FROM webauthn_credentials WHERE user_id = ?)
+		AND NOT EXISTS (SELECT 1 FROM users WHERE id = ? AND totp_enabled = 1)`,
+		userID, userID, userID,
+	)
+	return err
+}
+
+// scanSecurityKey 读取一行安全密钥记录
+func scanSecurityKey(row interface{ Scan(...interface{}) error }) (*SecurityKey, error) {
+	var key SecurityKey
+	var credentialID, aaguid, transports string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&key.ID, &key.Name, &credentialID, &key.Credential.PublicKey, &key.Credential.SignCount,
+		&aaguid, &transports, &key.CreatedAt, &lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Credential.ID, err = webauthn.Decode(credentialID); err != nil {
+		return nil, err
+	}
+	key.Credential.AAGUID, _ = hex.DecodeString(aaguid)
+	key.Credential.Transports = []string{}
+	json.Unmarshal([]byte(transports), &key.Credential.Transports)
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return &key, nil
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gopass/internal/webauthn"
 )
 
 // User 用户模型
@@ -16,16 +18,90 @@ type User struct {
 
 // Password 密码条目模型
 type Password struct {
-	ID          int       `json:"id" db:"id"`
-	UserID      int       `json:"user_id" db:"user_id"`
-	Title       string    `json:"title" db:"title"`
-	Website     string    `json:"website" db:"website"`
-	Username    string    `json:"username" db:"username"`
-	Password    string    `json:"password" db:"password"`
-	Category    string    `json:"category" db:"category"`
-	Notes       string    `json:"notes" db:"notes"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID         int       `json:"id" db:"id"`
+	UserID     int       `json:"user_id" db:"user_id"`
+	Type       string    `json:"type" db:"item_type"`
+	Title      string    `json:"title" db:"title"`
+	Website    string    `json:"website" db:"website"`
+	Username   string    `json:"username" db:"username"`
+	Password   string    `json:"password" db:"password"`
+	Category   string    `json:"category" db:"category"`
+	Notes      string    `json:"notes" db:"notes"`
+	TOTPSecret string    `json:"totp_secret" db:"totp_secret"` // 网站两步验证的 otpauth:// URI 或 base32 密钥
+	Payload    string    `json:"-" db:"payload"`               // 类型专属字段的JSON，加密保存
+	FieldsData string    `json:"-" db:"custom_fields"`         // 自定义字段的JSON，加密保存
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+
+	// 类型专属字段，只有与 Type 对应的一项不为空
+	Card     *CardFields     `json:"card,omitempty"`
+	Identity *IdentityFields `json:"identity,omitempty"`
+	SSHKey   *SSHKeyFields   `json:"ssh_key,omitempty"`
+
+	// Fields 用户自定义字段，按显示顺序排列
+	Fields []CustomField `json:"fields,omitempty"`
+
+	// Attachments 条目的附件数量，只在条目列表中返回
+	Attachments int `json:"attachments,omitempty"`
+
+	// Undecryptable 条目无法用当前保险库密钥解密，只返回未加密的列
+	Undecryptable bool `json:"undecryptable,omitempty"`
+}
+
+// CustomField 条目的自定义字段，如PIN、密保问题和账号
+type CustomField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Kind  string `json:"kind"`
+}
+
+// 自定义字段类型。隐藏字段在界面上默认遮挡，布尔字段的值为 "true" 或 "false"
+const (
+	FieldKindText    = "text"
+	FieldKindHidden  = "hidden"
+	FieldKindBoolean = "boolean"
+	FieldKindLink    = "link"
+)
+
+// 条目类型。安全笔记的内容保存在 Notes 中，SSH密钥的口令保存在 Password 中
+const (
+	ItemTypeLogin    = "login"
+	ItemTypeNote     = "note"
+	ItemTypeCard     = "card"
+	ItemTypeIdentity = "identity"
+	ItemTypeSSHKey   = "ssh_key"
+)
+
+// CardFields 银行卡条目的字段
+type CardFields struct {
+	Cardholder string `json:"cardholder"`
+	Number     string `json:"number"`
+	Expiry     string `json:"expiry"` // MM/YY 或 MM/YYYY
+	CVV        string `json:"cvv"`
+	Brand      string `json:"brand,omitempty"` // 由卡号识别
+}
+
+// IdentityFields 身份信息条目的字段
+type IdentityFields struct {
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Company    string `json:"company"`
+	Address    string `json:"address"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	BirthDate  string `json:"birth_date"` // YYYY-MM-DD
+	IDNumber   string `json:"id_number"`  // 身份证或护照号码
+}
+
+// SSHKeyFields SSH密钥条目的字段
+type SSHKeyFields struct {
+	PrivateKey  string `json:"private_key"`
+	PublicKey   string `json:"public_key"`  // authorized_keys 格式
+	Fingerprint string `json:"fingerprint"` // 由公钥计算的 SHA256 指纹
 }
 
 // Category 分类模型
@@ -41,6 +117,8 @@ type Category struct {
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// PreviousPassword 目录账户在目录中改过密码后，用旧密码重新包装保险库密钥
+	PreviousPassword string `json:"previous_password"`
 }
 
 // RegisterRequest 注册请求
@@ -50,14 +128,56 @@ type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 }
 
+// RecoverRequest 使用恢复密钥重置密码请求
+type RecoverRequest struct {
+	Username    string `json:"username" binding:"required"`
+	RecoveryKey string `json:"recovery_key" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// VerifyEmailRequest 验证邮箱请求
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PasswordResetRequest 申请通过邮件重置密码
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// PasswordResetConfirmRequest 使用邮件中的令牌和恢复密钥重置密码
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	RecoveryKey string `json:"recovery_key" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// RefreshRequest 刷新访问令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ReauthRequest 需要重新输入主密码的敏感操作请求
+type ReauthRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
 // PasswordRequest 密码条目请求
 type PasswordRequest struct {
-	Title    string `json:"title" binding:"required"`
-	Website  string `json:"website"`
-	Username string `json:"username"`
-	Password string `json:"password" binding:"required"`
-	Category string `json:"category"`
-	Notes    string `json:"notes"`
+	Type       string `json:"type"` // 为空时为登录条目
+	Title      string `json:"title" binding:"required"`
+	Website    string `json:"website"`
+	Username   string `json:"username"`
+	Password   string `json:"password"` // 登录条目必填
+	Category   string `json:"category"`
+	Notes      string `json:"notes"`
+	TOTPSecret string `json:"totp_secret"`
+
+	Card     *CardFields     `json:"card"`
+	Identity *IdentityFields `json:"identity"`
+	SSHKey   *SSHKeyFields   `json:"ssh_key"`
+
+	Fields []CustomField `json:"fields"`
 }
 
 // GeneratePasswordRequest 生成密码请求
@@ -73,5 +193,132 @@ type GeneratePasswordRequest struct {
 type APIResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
+	Code    string      `json:"code,omitempty"` // 需要客户端特殊处理的错误，如 VAULT_LOCKED
 	Data    interface{} `json:"data,omitempty"`
 }
+
+// CodeVaultLocked 保险库已锁定，客户端应提示输入主密码并调用 /api/unlock
+const CodeVaultLocked = "VAULT_LOCKED"
+
+// CodeUndecryptableEntries 有条目无法解密，保险库的迁移或轮换未执行，Data 中列出条目ID
+const CodeUndecryptableEntries = "UNDECRYPTABLE_ENTRIES"
+
+// TOTPCodeResponse 密码条目的当前两步验证码
+type TOTPCodeResponse struct {
+	Code      string `json:"code"`
+	Remaining int    `json:"remaining"` // 验证码失效前的秒数
+	Period    int    `json:"period"`
+	Digits    int    `json:"digits"`
+	Steam     bool   `json:"steam,omitempty"`
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account,omitempty"`
+}
+
+// PasswordHistory 条目被替换的旧密码
+type PasswordHistory struct {
+	ID         int       `json:"id"`
+	PasswordID int       `json:"password_id"`
+	Password   string    `json:"password"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	// Undecryptable 条目的历史密码无法解密，只在导出归档中作为占位记录条目ID
+	Undecryptable bool `json:"undecryptable,omitempty"`
+}
+
+// Attachment 条目附件的元数据，内容通过下载接口获取
+type Attachment struct {
+	ID          string    `json:"id"`
+	PasswordID  int       `json:"password_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EmergencyAccessRequest 设置紧急访问请求
+type EmergencyAccessRequest struct {
+	Password  string   `json:"password" binding:"required"`
+	Trustees  []string `json:"trustees" binding:"required"`
+	Threshold int      `json:"threshold" binding:"required"`
+	WaitHours int      `json:"wait_hours" binding:"min=0,max=8760"`
+}
+
+// EmergencyRequestCreate 申请紧急访问请求
+type EmergencyRequestCreate struct {
+	Owner string `json:"owner" binding:"required"`
+}
+
+// EmergencyRequest 紧急访问申请
+type EmergencyRequest struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"-"`
+	Owner       string    `json:"owner"`
+	RequesterID int       `json:"-"`
+	Requester   string    `json:"requester"`
+	Status      string    `json:"status"`
+	Approvals   int       `json:"approvals"`
+	Threshold   int       `json:"threshold"`
+	CreatedAt   time.Time `json:"created_at"`
+	AvailableAt time.Time `json:"available_at"`
+}
+
+// MFALoginRequest 登录第二步：提交验证码或备用码
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// WebAuthnLoginRequest 登录第二步：提交安全密钥的认证响应
+type WebAuthnLoginRequest struct {
+	MFAToken   string                     `json:"mfa_token" binding:"required"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// WebAuthnRegisterRequest 提交安全密钥的注册响应
+type WebAuthnRegisterRequest struct {
+	Name       string                        `json:"name" binding:"required"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// TOTPCodeRequest 提交TOTP验证码请求
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAReauthRequest 需要主密码和验证码的敏感操作请求
+type MFAReauthRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// ChangePasswordRequest 修改主密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangeEmailRequest 修改邮箱请求
+type ChangeEmailRequest struct {
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+}
+
+// DeleteAccountRequest 删除账户请求，启用两步验证时还需提供验证码或备用码
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// CreateAPITokenRequest 创建个人访问令牌请求，ExpiresInDays 为0表示永不过期
+type CreateAPITokenRequest struct {
+	Password      string   `json:"password" binding:"required"`
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	Categories    []string `json:"categories"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+}
+
+// SSOUnlockRequest 单点登录后输入主密码解锁保险库，首次登录时设置主密码
+type SSOUnlockRequest struct {
+	SSOToken string `json:"sso_token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
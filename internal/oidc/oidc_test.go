@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// startMock 启动身份提供者替身并返回指向它的客户端
+func startMock(t *testing.T, clientID string) *Provider {
+	t.Helper()
+
+	var mock *MockProvider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	var err error
+	mock, err = NewMockProvider(server.URL, "gopass", "secret")
+	if err != nil {
+		t.Fatalf("Failed to create mock provider: %v", err)
+	}
+
+	return New(Config{
+		Issuer:       server.URL,
+		ClientID:     clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/sso/callback",
+	})
+}
+
+// authorize 模拟浏览器完成授权，返回回调中的授权码
+func authorize(t *testing.T, provider *Provider, username, nonce, challenge string) string {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL("state-1", nonce, challenge)
+	if err != nil {
+		t.Fatalf("Failed to build authorization URL: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL + "&login_hint=" + url.QueryEscape(username))
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected redirect from authorization endpoint, got %d", resp.StatusCode)
+	}
+
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if location.Query().Get("state") != "state-1" {
+		t.Errorf("State should be returned unchanged, got %q", location.Query().Get("state"))
+	}
+	return location.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider := startMock(t, "gopass")
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("Failed to create PKCE pair: %v", err)
+	}
+
+	code := authorize(t, provider, "alice", "nonce-1", challenge)
+	claims, err := provider.Exchange(code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	if claims.Subject != "mock-alice" || claims.PreferredUsername != "alice" || claims.Email != "alice@example.test" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	// 授权码只能兑换一次
+	if _, err := provider.Exchange(code, verifier, "nonce-1"); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Reused code should be rejected, got %v", err)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	provider := startMock(t, "gopass")
+	_, challenge, _ := NewPKCE()
+	otherVerifier, _, _ := NewPKCE()
+
+	code := authorize(t, provider, "alice", "nonce-1", challenge)
+	if _, err := provider.Exchange(code, otherVerifier, "nonce-1"); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Wrong PKCE verifier should be rejected, got %v", err)
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	provider := startMock(t, "gopass")
+	verifier, challenge, _ := NewPKCE()
+
+	code := authorize(t, provider, "alice", "nonce-1", challenge)
+	if _, err := provider.Exchange(code, verifier, "nonce-2"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Nonce mismatch should be rejected, got %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejectsForgedToken(t *testing.T) {
+	provider := startMock(t, "gopass")
+	other := startMock(t, "gopass")
+	verifier, challenge, _ := NewPKCE()
+
+	// 另一个提供者签发的令牌，签发者和签名密钥都不匹配
+	code := authorize(t, other, "mallory", "nonce-1", challenge)
+	idToken := exchangeRaw(t, other, code, verifier)
+	if _, err := provider.VerifyIDToken(idToken); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Token from another issuer should be rejected, got %v", err)
+	}
+}
+
+// exchangeRaw 直接调用令牌端点，返回未经校验的ID令牌
+func exchangeRaw(t *testing.T, provider *Provider, code, verifier string) string {
+	t.Helper()
+
+	metadata, err := provider.discover()
+	if err != nil {
+		t.Fatalf("Discovery failed: %v", err)
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.config.RedirectURL},
+		"client_id":     {provider.config.ClientID},
+		"client_secret": {provider.config.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	resp, err := http.PostForm(metadata.TokenEndpoint, form)
+	if err != nil {
+		t.Fatalf("Token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.IDToken == "" {
+		t.Fatalf("Token response has no id_token: %v", err)
+	}
+	return body.IDToken
+}
+
+func TestVerifyIDTokenRejectsWrongAudience(t *testing.T) {
+	provider := startMock(t, "gopass")
+	verifier, challenge, _ := NewPKCE()
+
+	code := authorize(t, provider, "alice", "nonce-1", challenge)
+	idToken := exchangeRaw(t, provider, code, verifier)
+
+	other := New(Config{Issuer: provider.config.Issuer, ClientID: "another-client"})
+	if _, err := other.VerifyIDToken(idToken); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Token for another client should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HOTP (RFC 4226) 和 TOTP (RFC 6238) 验证码。
+// 密码条目中保存的第三方网站两步验证密钥由服务器代替身份验证器应用计算验证码，
+// 支持 otpauth://totp/ URI、Steam 令牌（otpauth://steam/、encoder=steam 或 steam://密钥）以及裸 base32 密钥；
+// 账户自身的两步验证也使用本包生成密钥和校验验证码，见 verify.go
+
+// 哈希算法
+const (
+	SHA1   = "SHA1"
+	SHA256 = "SHA256"
+	SHA512 = "SHA512"
+)
+
+const (
+	// DefaultDigits 默认验证码位数
+	DefaultDigits = 6
+	// DefaultPeriod 默认时间步长（秒）
+	DefaultPeriod = 30
+	// MaxPeriod 允许的最大时间步长
+	MaxPeriod = 300
+
+	// steamAlphabet Steam 令牌验证码使用的字符，去掉了容易混淆的字母和数字
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+	steamDigits   = 5
+)
+
+var (
+	// ErrInvalidKey 无法解析的密钥或URI
+	ErrInvalidKey = errors.New("invalid OTP key")
+	// ErrUnsupported 不支持的类型或参数，如基于计数器的 HOTP
+	ErrUnsupported = errors.New("unsupported OTP parameters")
+)
+
+// Key 解析后的验证码参数
+type Key struct {
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+	Steam     bool
+	Issuer    string
+	Account   string
+}
+
+// Parse 解析 otpauth:// URI、steam:// 密钥或裸 base32 密钥
+func Parse(value string) (*Key, error) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(lower, "otpauth://"):
+		return parseURI(value)
+	case strings.HasPrefix(lower, "steam://"):
+		return newKey(value[len("steam://"):], SHA1, steamDigits, DefaultPeriod, true)
+	default:
+		return newKey(value, SHA1, DefaultDigits, DefaultPeriod, false)
+	}
+}
+
+// parseURI 解析 Key URI 格式 (https://github.com/google/google-authenticator/wiki/Key-Uri-Format)
+func parseURI(value string) (*Key, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	steam := false
+	switch strings.ToLower(u.Host) {
+	case "totp":
+	case "steam":
+		steam = true
+	case "hotp":
+		return nil, fmt.Errorf("%w: counter-based HOTP", ErrUnsupported)
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidKey, u.Host)
+	}
+
+	query := u.Query()
+	if strings.EqualFold(query.Get("encoder"), "steam") {
+		steam = true
+	}
+
+	algorithm := SHA1
+	if a := query.Get("algorithm"); a != "" {
+		algorithm = strings.ToUpper(a)
+	}
+	digits, period := DefaultDigits, DefaultPeriod
+	if d := query.Get("digits"); d != "" {
+		if digits, err = strconv.Atoi(d); err != nil {
+			return nil, fmt.Errorf("%w: digits %q", ErrInvalidKey, d)
+		}
+	}
+	if p := query.Get("period"); p != "" {
+		if period, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("%w: period %q", ErrInvalidKey, p)
+		}
+	}
+	if steam {
+		digits = steamDigits
+	}
+
+	key, err := newKey(query.Get("secret"), algorithm, digits, period, steam)
+	if err != nil {
+		return nil, err
+	}
+
+	// 标签为 "发行方:账户"，issuer 参数优先
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer, key.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+	return key, nil
+}
+
+// newKey 解码密钥并检查参数
+func newKey(secret, algorithm string, digits, period int, steam bool) (*Key, error) {
+	// 网站常把密钥分组显示，去掉空格和连字符
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("%w: secret is not valid base32", ErrInvalidKey)
+	}
+
+	if hashFunc(algorithm) == nil {
+		return nil, fmt.Errorf("%w: algorithm %q", ErrUnsupported, algorithm)
+	}
+	if !steam && (digits < 6 || digits > 8) {
+		return nil, fmt.Errorf("%w: %d digits", ErrUnsupported, digits)
+	}
+	if period < 1 || period > MaxPeriod {
+		return nil, fmt.Errorf("%w: period %d", ErrUnsupported, period)
+	}
+
+	return &Key{Secret: decoded, Algorithm: algorithm, Digits: digits, Period: period, Steam: steam}, nil
+}
+
+// hashFunc 返回算法对应的哈希函数，不支持时返回nil
+func hashFunc(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case SHA1:
+		return sha1.New
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// Code 计算时间 t 的验证码
+func (k *Key) Code(t time.Time) string {
+	return k.CodeAt(k.Counter(t))
+}
+
+// Counter 返回时间 t 对应的时间步
+func (k *Key) Counter(t time.Time) int64 {
+	return t.Unix() / int64(k.Period)
+}
+
+// CodeAt 计算指定时间步的验证码 (RFC 4226)
+func (k *Key) CodeAt(counter int64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(hashFunc(k.Algorithm), k.Secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断 (RFC 4226 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	if k.Steam {
+		code := make([]byte, steamDigits)
+		for i := range code {
+			code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+			value /= uint32(len(steamAlphabet))
+		}
+		return string(code)
+	}
+
+	modulo := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, value%modulo)
+}
+
+// Remaining 返回时间 t 的验证码还有多少秒失效
+func (k *Key) Remaining(t time.Time) int {
+	return k.Period - int(t.Unix()%int64(k.Period))
+}
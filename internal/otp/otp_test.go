@@ -0,0 +1,180 @@
+package otp
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的测试密钥，三种算法的密钥长度分别与摘要长度相同
+var (
+	secretSHA1   = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	secretSHA256 = base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012"))
+	secretSHA512 = base32.StdEncoding.EncodeToString([]byte("1234567890123456789012345678901234567890123456789012345678901234"))
+)
+
+func TestRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix      int64
+		algorithm string
+		secret    string
+		expected  string
+	}{
+		{59, SHA1, secretSHA1, "94287082"},
+		{59, SHA256, secretSHA256, "46119246"},
+		{59, SHA512, secretSHA512, "90693936"},
+		{1111111109, SHA1, secretSHA1, "07081804"},
+		{1111111109, SHA256, secretSHA256, "68084774"},
+		{1111111109, SHA512, secretSHA512, "25091201"},
+		{2000000000, SHA1, secretSHA1, "69279037"},
+		{2000000000, SHA256, secretSHA256, "90698825"},
+		{2000000000, SHA512, secretSHA512, "38618901"},
+	}
+
+	for _, v := range vectors {
+		uri := fmt.Sprintf("otpauth://totp/Example:alice?secret=%s&algorithm=%s&digits=8", v.secret, v.algorithm)
+		key, err := Parse(uri)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", uri, err)
+		}
+		if code := key.Code(time.Unix(v.unix, 0)); code != v.expected {
+			t.Errorf("%s code at %d should be %s, got %s", v.algorithm, v.unix, v.expected, code)
+		}
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	// 网站显示的分组小写密钥
+	key, err := Parse("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Fatalf("Failed to parse bare secret: %v", err)
+	}
+	if key.Algorithm != SHA1 || key.Digits != 6 || key.Period != 30 || key.Steam {
+		t.Errorf("Unexpected defaults %+v", key)
+	}
+	if code := key.Code(time.Unix(59, 0)); code != "287082" {
+		t.Errorf("Code should be 287082, got %s", code)
+	}
+
+	key, err = Parse("otpauth://totp/ACME%20Co:alice@example.test?secret=" + secretSHA1 + "&issuer=ACME")
+	if err != nil {
+		t.Fatalf("Failed to parse URI: %v", err)
+	}
+	if key.Issuer != "ACME" || key.Account != "alice@example.test" {
+		t.Errorf("Unexpected label %q / %q", key.Issuer, key.Account)
+	}
+}
+
+func TestCustomPeriod(t *testing.T) {
+	key, err := Parse("otpauth://totp/x?secret=" + secretSHA1 + "&period=60")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	if code := key.Code(now); code != "895298" {
+		t.Errorf("Code should be 895298, got %s", code)
+	}
+	// 1700000000 % 60 = 20
+	if remaining := key.Remaining(now); remaining != 40 {
+		t.Errorf("Remaining should be 40, got %d", remaining)
+	}
+}
+
+func TestSteam(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, value := range []string{
+		"steam://" + secretSHA1,
+		"otpauth://steam/Steam:alice?secret=" + secretSHA1,
+		"otpauth://totp/Steam:alice?secret=" + secretSHA1 + "&encoder=steam",
+	} {
+		key, err := Parse(value)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", value, err)
+		}
+		if !key.Steam {
+			t.Errorf("%s should be a Steam key", value)
+		}
+		if code := key.Code(now); code != "R87JJ" {
+			t.Errorf("Steam code should be R87JJ, got %s", code)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected error
+	}{
+		{"", ErrInvalidKey},
+		{"not base32!", ErrInvalidKey},
+		{"otpauth://totp/x", ErrInvalidKey},
+		{"otpauth://totp/x?secret=" + secretSHA1 + "&digits=six", ErrInvalidKey},
+		{"otpauth://hotp/x?secret=" + secretSHA1, ErrUnsupported},
+		{"otpauth://totp/x?secret=" + secretSHA1 + "&algorithm=MD5", ErrUnsupported},
+		{"otpauth://totp/x?secret=" + secretSHA1 + "&digits=4", ErrUnsupported},
+		{"otpauth://totp/x?secret=" + secretSHA1 + "&period=0", ErrUnsupported},
+	}
+	for _, c := range cases {
+		if _, err := Parse(c.value); !errors.Is(err, c.expected) {
+			t.Errorf("Parse(%q) should fail with %v, got %v", c.value, c.expected, err)
+		}
+	}
+}
+
+func TestGenerateSecretURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+
+	key, err := Parse(URI("GoPass", "alice@example.com", secret))
+	if err != nil {
+		t.Fatalf("Generated URI should parse: %v", err)
+	}
+	if len(key.Secret) != 20 || key.Algorithm != SHA1 || key.Digits != DefaultDigits || key.Period != DefaultPeriod {
+		t.Errorf("Unexpected key parameters: %+v", key)
+	}
+	if key.Issuer != "GoPass" || key.Account != "alice@example.com" {
+		t.Errorf("Unexpected label: %q / %q", key.Issuer, key.Account)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, _ := GenerateSecret()
+	key, err := Parse(secret)
+	if err != nil {
+		t.Fatalf("Failed to parse secret: %v", err)
+	}
+
+	now := time.Now()
+	code := key.Code(now)
+
+	counter, ok := key.Validate(code, now, 0)
+	if !ok || counter != key.Counter(now) {
+		t.Fatal("Current code should be accepted")
+	}
+
+	// 相邻时间步的验证码在允许的偏差内
+	if _, ok := key.Validate(code, now.Add(DefaultPeriod*time.Second), 0); !ok {
+		t.Error("Code from previous step should be accepted")
+	}
+
+	// 已使用的验证码不能重放
+	if _, ok := key.Validate(code, now, counter); ok {
+		t.Error("Replayed code should be rejected")
+	}
+
+	if _, ok := key.Validate(code, now.Add(5*DefaultPeriod*time.Second), 0); ok {
+		t.Error("Code outside the skew window should be rejected")
+	}
+
+	if _, ok := key.Validate(code[:5], now, 0); ok {
+		t.Error("Code with wrong length should be rejected")
+	}
+
+	if _, ok := key.Validate(code[:3]+" "+code[3:], now, 0); !ok {
+		t.Error("Code with spaces should be accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package otp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 账户两步验证使用默认参数：HMAC-SHA1，6位数字，30秒步长，兼容常见的身份验证器应用
+
+// skew 校验时允许前后各一个步长的时钟偏差
+const skew = 1
+
+// GenerateSecret 生成160位随机密钥，返回不带填充的base32编码
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// URI 返回身份验证器应用可以扫描的 otpauth:// URI，使用默认参数
+func URI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", SHA1)
+	values.Set("digits", fmt.Sprint(DefaultDigits))
+	values.Set("period", fmt.Sprint(DefaultPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// Validate 校验验证码，返回匹配的时间步。
+// 时间步不大于 lastCounter 的验证码视为重放，不予接受
+func (k *Key) Validate(code string, now time.Time, lastCounter int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if k.Steam || len(code) != k.Digits {
+		return 0, false
+	}
+
+	current := k.Counter(now)
+	for counter := current - skew; counter <= current+skew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(k.CodeAt(counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
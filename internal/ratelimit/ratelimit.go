@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter 按键（IP、用户名等）记录尝试次数，超过免费次数后按指数退避阻止后续请求。
+// 记录只保存在内存中，服务器重启后清零；持久的账户锁定由数据库负责
+type Limiter struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+
+	free   int           // 不受限制的尝试次数
+	base   time.Duration // 第一次退避时长
+	max    time.Duration // 退避时长上限
+	window time.Duration // 超过该时长没有新的尝试则清零
+}
+
+type entry struct {
+	attempts     int
+	lastAttempt  time.Time
+	blockedUntil time.Time
+}
+
+// New 创建限速器
+func New(free int, base, max, window time.Duration) *Limiter {
+	return &Limiter{
+		entries: make(map[string]*entry),
+		free:    free,
+		base:    base,
+		max:     max,
+		window:  window,
+	}
+}
+
+// Allow 检查是否允许新的尝试，不允许时返回需要等待的时长
+func (l *Limiter) Allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e, ok := l.entries[key]
+	if !ok {
+		return 0, true
+	}
+	if now.Sub(e.lastAttempt) > l.window {
+		delete(l.entries, key)
+		return 0, true
+	}
+	if now.Before(e.blockedUntil) {
+		return e.blockedUntil.Sub(now), false
+	}
+	return 0, true
+}
+
+// Record 记录一次尝试（例如失败的登录），必要时开始退避
+func (l *Limiter) Record(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweepLocked(now)
+
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.attempts++
+	e.lastAttempt = now
+
+	if e.attempts > l.free {
+		e.blockedUntil = now.Add(l.backoff(e.attempts - l.free))
+	}
+}
+
+// Reset 清除键的记录，例如登录成功后
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// backoff 第n次超限的退避时长：base * 2^(n-1)，不超过max
+func (l *Limiter) backoff(n int) time.Duration {
+	delay := l.base
+	for i := 1; i < n && delay < l.max; i++ {
+		delay *= 2
+	}
+	if delay > l.max {
+		delay = l.max
+	}
+	return delay
+}
+
+// sweepLocked 清理过期记录，调用方需持有锁
+func (l *Limiter) sweepLocked(now time.Time) {
+	for key, e := range l.entries {
+		if now.Sub(e.lastAttempt) > l.window && now.After(e.blockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
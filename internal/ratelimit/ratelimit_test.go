@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBackoff(t *testing.T) {
+	l := New(3, time.Second, 8*time.Second, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := l.Allow("alice"); !ok {
+			t.Fatalf("Attempt %d should be allowed", i+1)
+		}
+		l.Record("alice")
+	}
+
+	if _, ok := l.Allow("alice"); !ok {
+		t.Fatal("Attempts within the free limit should not block")
+	}
+
+	l.Record("alice")
+	wait, ok := l.Allow("alice")
+	if ok {
+		t.Fatal("Attempt over the free limit should be blocked")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("First backoff should be about 1s, got %v", wait)
+	}
+
+	// 其他键不受影响
+	if _, ok := l.Allow("bob"); !ok {
+		t.Error("Other keys should not be blocked")
+	}
+
+	l.Reset("alice")
+	if _, ok := l.Allow("alice"); !ok {
+		t.Error("Reset should clear the block")
+	}
+}
+
+func TestBackoffGrowth(t *testing.T) {
+	l := New(0, time.Second, 8*time.Second, time.Hour)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i, want := range expected {
+		if got := l.backoff(i + 1); got != want {
+			t.Errorf("Backoff %d should be %v, got %v", i+1, want, got)
+		}
+	}
+}
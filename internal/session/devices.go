@@ -0,0 +1,67 @@
+package session
+
+import (
+	"time"
+
+	"gopass/internal/database"
+)
+
+// 会话过期后会被清理，登录过的设备另行记录在 login_devices 表中，用于发现新设备登录。
+// 设备以 User-Agent 区分，不使用 Cookie 等持久标识
+
+// RecordDevice 记录用户登录使用的设备，返回是否为新设备。账户的第一台设备不算新设备
+func RecordDevice(userID int, userAgent string) (bool, error) {
+	userAgent = truncate(userAgent, 255)
+	deviceHash := hashToken(userAgent)
+	now := time.Now().UTC()
+
+	result, err := database.DB.Exec(`
+		INSERT OR IGNORE INTO login_devices (user_id, device_hash, user_agent, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, deviceHash, userAgent, now, now,
+	)
+	if err != nil {
+		return false, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		_, err := database.DB.Exec(
+			"UPDATE login_devices SET last_seen_at = ? WHERE user_id = ? AND device_hash = ?", now, userID, deviceHash,
+		)
+		return false, err
+	}
+
+	var devices int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM login_devices WHERE user_id = ?", userID).Scan(&devices); err != nil {
+		return false, err
+	}
+	return devices > 1, nil
+}
+
+// Device 登录过的设备
+type Device struct {
+	UserAgent   string    `json:"user_agent"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Devices 列出用户登录过的设备，最近使用的在前
+func Devices(userID int) ([]Device, error) {
+	rows, err := database.DB.Query(
+		"SELECT user_agent, first_seen_at, last_seen_at FROM login_devices WHERE user_id = ? ORDER BY last_seen_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		var device Device
+		if err := rows.Scan(&device.UserAgent, &device.FirstSeenAt, &device.LastSeenAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
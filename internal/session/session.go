@@ -0,0 +1,237 @@
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gopass/internal/auth"
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/vault"
+)
+
+// 每次登录对应 sessions 表中的一行，会话ID即访问令牌中的 sid。
+// 刷新令牌格式为 "<会话ID>.<随机串>"，数据库中只保存其SHA-256哈希；
+// 每次刷新都会换发新令牌，旧令牌再次出现说明已泄露，会话随即被撤销。
+
+var (
+	// ErrSessionInvalid 会话不存在、已过期或已被撤销
+	ErrSessionInvalid = errors.New("session is invalid")
+	// ErrTokenReused 已换发的刷新令牌被再次使用
+	ErrTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Session 登录会话
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// Create 创建新会话，返回会话ID和刷新令牌
+func Create(userID int, userAgent, ipAddress string) (string, string, error) {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := newRefreshToken(sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	_, err = database.DB.Exec(`
+		INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionID, userID, hashToken(refreshToken), truncate(userAgent, 255), ipAddress, now, now, now.Add(auth.SessionTTL),
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 顺便清理该用户已过期的会话
+	database.DB.Exec("DELETE FROM sessions WHERE user_id = ? AND expires_at < ?", userID, now)
+
+	return sessionID, refreshToken, nil
+}
+
+// Refresh 校验刷新令牌并换发新令牌，返回会话所属用户ID和会话ID
+func Refresh(refreshToken string) (int, string, string, error) {
+	sessionID, _, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" {
+		return 0, "", "", ErrSessionInvalid
+	}
+
+	var userID int
+	var currentHash string
+	var previousHash sql.NullString
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT user_id, refresh_token_hash, previous_token_hash, expires_at, revoked_at
+		FROM sessions WHERE id = ?`, sessionID,
+	).Scan(&userID, &currentHash, &previousHash, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", "", ErrSessionInvalid
+	}
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return 0, "", "", ErrSessionInvalid
+	}
+
+	presented := hashToken(refreshToken)
+	if previousHash.Valid && subtle.ConstantTimeCompare([]byte(presented), []byte(previousHash.String)) == 1 {
+		log.Printf("Refresh token of session %s was reused, revoking session of user %d", sessionID, userID)
+		Revoke(sessionID)
+		return 0, "", "", ErrTokenReused
+	}
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(currentHash)) != 1 {
+		return 0, "", "", ErrSessionInvalid
+	}
+
+	newToken, err := newRefreshToken(sessionID)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	// 以旧哈希为条件更新，并发刷新时只有一个请求成功
+	result, err := database.DB.Exec(`
+		UPDATE sessions SET refresh_token_hash = ?, previous_token_hash = ?, last_used_at = ?
+		WHERE id = ? AND refresh_token_hash = ?`,
+		hashToken(newToken), currentHash, time.Now().UTC(), sessionID, currentHash,
+	)
+	if err != nil {
+		return 0, "", "", err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return 0, "", "", ErrSessionInvalid
+	}
+
+	return userID, sessionID, newToken, nil
+}
+
+// Validate 检查会话是否属于该用户且仍然有效
+func Validate(sessionID string, userID int) error {
+	var owner int
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT user_id, expires_at, revoked_at FROM sessions WHERE id = ?", sessionID,
+	).Scan(&owner, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return ErrSessionInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner != userID || revokedAt.Valid || time.Now().After(expiresAt) {
+		return ErrSessionInvalid
+	}
+	return nil
+}
+
+// List 列出用户所有有效会话，currentID 对应的会话标记为当前会话
+func List(userID int, currentID string) ([]Session, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM sessions WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if now.After(s.ExpiresAt) {
+			continue
+		}
+		s.UserID = userID
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke 撤销会话并清除其保险库密钥
+func Revoke(sessionID string) error {
+	vault.Forget(sessionID)
+
+	_, err := database.DB.Exec(
+		"UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), sessionID,
+	)
+	return err
+}
+
+// RevokeUser 撤销用户除 exceptID 以外的所有会话，返回撤销的数量
+func RevokeUser(userID int, exceptID string) (int, error) {
+	rows, err := database.DB.Query(
+		"SELECT id FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND id != ?", userID, exceptID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := Revoke(id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// newRefreshToken 生成绑定到会话的刷新令牌
+func newRefreshToken(sessionID string) (string, error) {
+	secret, err := crypto.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashToken 计算刷新令牌的哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate 截断过长的字符串
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
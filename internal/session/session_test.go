@@ -0,0 +1,163 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopass/internal/database"
+	"gopass/internal/vault"
+)
+
+// testDB 初始化临时的 SQLite 数据库
+func testDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.CloseDB() })
+}
+
+// createUser 创建测试用户，返回用户ID
+func createUser(t *testing.T, username string) int {
+	t.Helper()
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password_hash, email) VALUES (?, '', ?)", username, username+"@example.test",
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	testDB(t)
+	userID := createUser(t, "alice")
+	sessionID, refreshToken, err := Create(userID, "test-agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	gotUser, gotSession, newToken, err := Refresh(refreshToken)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if gotUser != userID || gotSession != sessionID {
+		t.Errorf("Refresh returned user %d session %s, want %d %s", gotUser, gotSession, userID, sessionID)
+	}
+	if newToken == refreshToken {
+		t.Error("Refresh should issue a new token")
+	}
+
+	// 新令牌可以继续刷新
+	if _, _, _, err := Refresh(newToken); err != nil {
+		t.Errorf("New token should refresh: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	testDB(t)
+	userID := createUser(t, "alice")
+	sessionID, oldToken, _ := Create(userID, "test-agent", "127.0.0.1")
+	_, _, newToken, err := Refresh(oldToken)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	vault.Store(sessionID, userID, []byte("0123456789abcdef0123456789abcdef"), time.Hour, 0)
+
+	if _, _, _, err := Refresh(oldToken); err != ErrTokenReused {
+		t.Fatalf("Replayed token should be detected, got %v", err)
+	}
+	if err := Validate(sessionID, userID); err != ErrSessionInvalid {
+		t.Errorf("Session should be revoked after token reuse, got %v", err)
+	}
+	if _, _, _, err := Refresh(newToken); err != ErrSessionInvalid {
+		t.Errorf("Current token of a revoked session should be rejected, got %v", err)
+	}
+	if vault.Unlocked(sessionID, userID) {
+		t.Error("Revoked session should forget its vault key")
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	testDB(t)
+	userID := createUser(t, "alice")
+	sessionID, _, _ := Create(userID, "test-agent", "127.0.0.1")
+
+	for _, token := range []string{"", "no-separator", "missing.secret", sessionID + ".forged"} {
+		if _, _, _, err := Refresh(token); err != ErrSessionInvalid {
+			t.Errorf("Refresh(%q) should fail with ErrSessionInvalid, got %v", token, err)
+		}
+	}
+	if err := Validate(sessionID, userID); err != nil {
+		t.Errorf("Forged token should not affect the session: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testDB(t)
+	userID := createUser(t, "alice")
+	otherID := createUser(t, "bob")
+	sessionID, _, _ := Create(userID, "test-agent", "127.0.0.1")
+
+	if err := Validate(sessionID, userID); err != nil {
+		t.Errorf("New session should be valid: %v", err)
+	}
+	if err := Validate(sessionID, otherID); err != ErrSessionInvalid {
+		t.Errorf("Session should not validate for another user, got %v", err)
+	}
+	if err := Validate("unknown", userID); err != ErrSessionInvalid {
+		t.Errorf("Unknown session should be invalid, got %v", err)
+	}
+
+	if err := Revoke(sessionID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if err := Validate(sessionID, userID); err != ErrSessionInvalid {
+		t.Errorf("Revoked session should be invalid, got %v", err)
+	}
+
+	expiredID, _, _ := Create(userID, "test-agent", "127.0.0.1")
+	database.DB.Exec("UPDATE sessions SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute).UTC(), expiredID)
+	if err := Validate(expiredID, userID); err != ErrSessionInvalid {
+		t.Errorf("Expired session should be invalid, got %v", err)
+	}
+}
+
+func TestRevokeUserSparesCurrentSession(t *testing.T) {
+	testDB(t)
+	userID := createUser(t, "alice")
+	otherID := createUser(t, "bob")
+	currentID, _, _ := Create(userID, "laptop", "127.0.0.1")
+	firstID, _, _ := Create(userID, "phone", "127.0.0.1")
+	secondID, _, _ := Create(userID, "tablet", "127.0.0.1")
+	otherSession, _, _ := Create(otherID, "laptop", "127.0.0.1")
+
+	revoked, err := RevokeUser(userID, currentID)
+	if err != nil {
+		t.Fatalf("RevokeUser failed: %v", err)
+	}
+	if revoked != 2 {
+		t.Errorf("RevokeUser should revoke 2 sessions, got %d", revoked)
+	}
+	if err := Validate(currentID, userID); err != nil {
+		t.Errorf("Excepted session should stay valid: %v", err)
+	}
+	for _, id := range []string{firstID, secondID} {
+		if err := Validate(id, userID); err != ErrSessionInvalid {
+			t.Errorf("Session %s should be revoked, got %v", id, err)
+		}
+	}
+	if err := Validate(otherSession, otherID); err != nil {
+		t.Errorf("Sessions of other users should not be revoked: %v", err)
+	}
+
+	// exceptID 为空时撤销全部会话
+	if revoked, _ := RevokeUser(userID, ""); revoked != 1 {
+		t.Errorf("RevokeUser without exception should revoke the remaining session, got %d", revoked)
+	}
+	if err := Validate(currentID, userID); err != ErrSessionInvalid {
+		t.Errorf("All sessions should be revoked, got %v", err)
+	}
+}
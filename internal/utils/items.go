@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopass/internal/models"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 各类条目的类型专属字段验证。字段格式只在保存时检查，已过期的银行卡等仍可保存
+
+// ValidateItem 按条目类型验证请求中的类型专属字段
+func ValidateItem(req models.PasswordRequest) (bool, string) {
+	switch req.Type {
+	case models.ItemTypeLogin:
+		if req.Password == "" {
+			return false, "密码不能为空"
+		}
+	case models.ItemTypeNote:
+		if strings.TrimSpace(req.Notes) == "" {
+			return false, "安全笔记内容不能为空"
+		}
+	case models.ItemTypeCard:
+		if req.Card == nil {
+			return false, "请填写银行卡信息"
+		}
+		return ValidateCard(*req.Card)
+	case models.ItemTypeIdentity:
+		if req.Identity == nil {
+			return false, "请填写身份信息"
+		}
+		return ValidateIdentity(*req.Identity)
+	case models.ItemTypeSSHKey:
+		if req.SSHKey == nil {
+			return false, "SSH私钥不能为空"
+		}
+		return ValidateSSHKey(req.SSHKey.PrivateKey, req.SSHKey.PublicKey, req.Password)
+	default:
+		return false, "不支持的条目类型"
+	}
+	return true, ""
+}
+
+// ValidateItemType 验证条目类型，用于按类型筛选
+func ValidateItemType(itemType string) bool {
+	switch itemType {
+	case models.ItemTypeLogin, models.ItemTypeNote, models.ItemTypeCard, models.ItemTypeIdentity, models.ItemTypeSSHKey:
+		return true
+	}
+	return false
+}
+
+var (
+	cardExpiryRegex = regexp.MustCompile(`^(0[1-9]|1[0-2])/(\d{2}|\d{4})$`)
+	cardCVVRegex    = regexp.MustCompile(`^\d{3,4}$`)
+	phoneRegex      = regexp.MustCompile(`^\+?[0-9 ()-]{3,32}$`)
+)
+
+// NormalizeCardNumber 去掉卡号中的空格和连字符
+func NormalizeCardNumber(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number))
+}
+
+// ValidateCard 验证银行卡号（Luhn校验）、有效期和安全码，卡号需已规范化
+func ValidateCard(card models.CardFields) (bool, string) {
+	if card.Number == "" {
+		return false, "卡号不能为空"
+	}
+	if len(card.Number) < 12 || len(card.Number) > 19 || strings.Trim(card.Number, "0123456789") != "" {
+		return false, "卡号应为12到19位数字"
+	}
+	if !luhnValid(card.Number) {
+		return false, "卡号校验失败，请检查是否输入正确"
+	}
+	if len(card.Cardholder) > 100 {
+		return false, "持卡人姓名长度不能超过100个字符"
+	}
+	if card.Expiry != "" && !cardExpiryRegex.MatchString(card.Expiry) {
+		return false, "有效期格式应为MM/YY或MM/YYYY"
+	}
+	if card.CVV != "" && !cardCVVRegex.MatchString(card.CVV) {
+		return false, "安全码应为3或4位数字"
+	}
+	return true, ""
+}
+
+// luhnValid 使用Luhn算法校验卡号
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// CardBrand 根据卡号前缀识别卡组织，无法识别时返回空字符串
+func CardBrand(number string) string {
+	prefix := func(n int) int {
+		if len(number) < n {
+			return -1
+		}
+		value := 0
+		for _, c := range number[:n] {
+			value = value*10 + int(c-'0')
+		}
+		return value
+	}
+
+	switch {
+	case strings.HasPrefix(number, "4"):
+		return "visa"
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return "mastercard"
+	case prefix(2) == 34 || prefix(2) == 37:
+		return "amex"
+	case prefix(4) == 6011, prefix(2) == 65, prefix(3) >= 644 && prefix(3) <= 649:
+		return "discover"
+	case prefix(2) == 62:
+		return "unionpay"
+	case prefix(4) >= 3528 && prefix(4) <= 3589:
+		return "jcb"
+	case prefix(2) == 36, prefix(3) >= 300 && prefix(3) <= 305:
+		return "diners"
+	}
+	return ""
+}
+
+// ValidateIdentity 验证身份信息条目，至少需要填写一项
+func ValidateIdentity(identity models.IdentityFields) (bool, string) {
+	fields := []string{
+		identity.FirstName, identity.LastName, identity.Email, identity.Phone, identity.Company, identity.Address,
+		identity.City, identity.State, identity.PostalCode, identity.Country, identity.BirthDate, identity.IDNumber,
+	}
+	empty := true
+	for _, field := range fields {
+		if len(field) > 255 {
+			return false, "身份信息字段长度不能超过255个字符"
+		}
+		if strings.TrimSpace(field) != "" {
+			empty = false
+		}
+	}
+	if empty {
+		return false, "身份信息至少需要填写一项"
+	}
+
+	if identity.Email != "" && !ValidateEmail(identity.Email) {
+		return false, "邮箱格式不正确"
+	}
+	if identity.Phone != "" && !phoneRegex.MatchString(identity.Phone) {
+		return false, "电话号码格式不正确"
+	}
+	if identity.BirthDate != "" {
+		if _, err := time.Parse("2006-01-02", identity.BirthDate); err != nil {
+			return false, "出生日期格式应为YYYY-MM-DD"
+		}
+	}
+	return true, ""
+}
+
+// maxSSHKeyLength SSH密钥的最大长度，足够容纳 8192 位的 RSA 私钥
+const maxSSHKeyLength = 16384
+
+var (
+	errSSHPrivateKey  = errors.New("invalid SSH private key")
+	errSSHPublicKey   = errors.New("invalid SSH public key")
+	errSSHPassphrase  = errors.New("incorrect SSH key passphrase")
+	errSSHKeyMismatch = errors.New("SSH public key does not match private key")
+)
+
+// ValidateSSHKey 验证SSH密钥对。私钥已加密时，提供的口令必须正确
+func ValidateSSHKey(privateKey, publicKey, passphrase string) (bool, string) {
+	if strings.TrimSpace(privateKey) == "" {
+		return false, "SSH私钥不能为空"
+	}
+	if len(privateKey) > maxSSHKeyLength || len(publicKey) > maxSSHKeyLength {
+		return false, "SSH密钥长度不能超过16384个字符"
+	}
+
+	_, _, err := SSHKeyInfo(privateKey, publicKey, passphrase)
+	switch err {
+	case nil:
+		return true, ""
+	case errSSHPublicKey:
+		return false, "SSH公钥格式不正确"
+	case errSSHPassphrase:
+		return false, "SSH私钥口令不正确"
+	case errSSHKeyMismatch:
+		return false, "SSH公钥与私钥不匹配"
+	default:
+		return false, "SSH私钥格式不正确"
+	}
+}
+
+// SSHKeyInfo 返回密钥对的公钥（authorized_keys 格式）和 SHA256 指纹。
+// 未提供公钥时从私钥推导；私钥已加密且没有口令时，只有 OpenSSH 格式能取得公钥，否则返回空字符串
+func SSHKeyInfo(privateKey, publicKey, passphrase string) (string, string, error) {
+	var derived ssh.PublicKey
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+		derived = signer.PublicKey()
+	case errors.As(err, &missing):
+		derived = missing.PublicKey
+		if passphrase != "" {
+			signer, err := ssh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+			if err == x509.IncorrectPasswordError {
+				return "", "", errSSHPassphrase
+			}
+			if err != nil {
+				return "", "", errSSHPrivateKey
+			}
+			derived = signer.PublicKey()
+		}
+	default:
+		return "", "", errSSHPrivateKey
+	}
+
+	publicKey = strings.TrimSpace(publicKey)
+	if publicKey != "" {
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+		if err != nil {
+			return "", "", errSSHPublicKey
+		}
+		if derived != nil && !bytes.Equal(derived.Marshal(), parsed.Marshal()) {
+			return "", "", errSSHKeyMismatch
+		}
+		// 保留用户填写的公钥注释
+		return publicKey, ssh.FingerprintSHA256(parsed), nil
+	}
+
+	if derived == nil {
+		return "", "", nil
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(derived))), ssh.FingerprintSHA256(derived), nil
+}
+
+const (
+	// MaxCustomFields 每个条目最多的自定义字段数
+	MaxCustomFields = 50
+	// maxCustomFieldValue 自定义字段值的最大长度
+	maxCustomFieldValue = 5000
+)
+
+// ValidateCustomFields 验证条目的自定义字段，字段类型需已规范化
+func ValidateCustomFields(fields []models.CustomField) (bool, string) {
+	if len(fields) > MaxCustomFields {
+		return false, fmt.Sprintf("自定义字段不能超过%d个", MaxCustomFields)
+	}
+
+	for _, field := range fields {
+		if strings.TrimSpace(field.Name) == "" {
+			return false, "自定义字段名称不能为空"
+		}
+		if len(field.Name) > 100 {
+			return false, "自定义字段名称长度不能超过100个字符"
+		}
+		if len(field.Value) > maxCustomFieldValue {
+			return false, fmt.Sprintf("自定义字段的值长度不能超过%d个字符", maxCustomFieldValue)
+		}
+
+		switch field.Kind {
+		case models.FieldKindText, models.FieldKindHidden:
+		case models.FieldKindBoolean:
+			if field.Value != "true" && field.Value != "false" {
+				return false, "布尔字段的值只能是true或false"
+			}
+		case models.FieldKindLink:
+			if field.Value != "" && !ValidateURL(field.Value) {
+				return false, "链接字段的URL格式不正确"
+			}
+		default:
+			return false, "不支持的自定义字段类型"
+		}
+	}
+	return true, ""
+}
@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 	"unicode"
+
+	"gopass/internal/otp"
 )
 
 // ValidateEmail 验证邮箱格式
@@ -127,3 +130,22 @@ func ValidateCategory(category string) (bool, string) {
 	
 	return true, ""
 }
+
+// ValidateTOTPSecret 验证条目中保存的两步验证密钥，可以是 otpauth:// URI 或 base32 密钥
+func ValidateTOTPSecret(secret string) (bool, string) {
+	if secret == "" {
+		return true, "" // 允许不设置
+	}
+	if len(secret) > 2048 {
+		return false, "两步验证密钥长度不能超过2048个字符"
+	}
+
+	_, err := otp.Parse(secret)
+	if errors.Is(err, otp.ErrUnsupported) {
+		return false, "不支持的两步验证参数，仅支持TOTP、SHA1/SHA256/SHA512、6到8位验证码和Steam令牌"
+	}
+	if err != nil {
+		return false, "两步验证密钥格式不正确"
+	}
+	return true, ""
+}
@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+
+	"gopass/internal/crypto"
+)
+
+// 附件内容使用每个文件独立的随机密钥流式加密，文件密钥、文件名和类型由保险库密钥加密，
+// 并绑定用户ID和附件ID。轮换保险库密钥时只需重新包装文件密钥，无需重新加密文件内容
+
+// attachmentAAD 返回附件元数据密文的附加数据
+func attachmentAAD(userID int, attachmentID, field string) []byte {
+	return []byte(fmt.Sprintf("gopass:user=%d:attachment=%s:field=%s", userID, attachmentID, field))
+}
+
+// AttachmentContentAAD 返回附件内容密文的附加数据
+func AttachmentContentAAD(userID int, attachmentID string) []byte {
+	return attachmentAAD(userID, attachmentID, "content")
+}
+
+// NewAttachmentKey 生成附件的文件密钥，返回密钥和以保险库密钥包装后的密钥
+func NewAttachmentKey(vaultKey []byte, userID int, attachmentID string) ([]byte, string, error) {
+	fileKey, err := crypto.GenerateRandomKey()
+	if err != nil {
+		return nil, "", err
+	}
+	wrapped, err := wrapAttachmentKey(vaultKey, userID, attachmentID, fileKey)
+	if err != nil {
+		crypto.Wipe(fileKey)
+		return nil, "", err
+	}
+	return fileKey, wrapped, nil
+}
+
+// OpenAttachmentKey 解开附件的文件密钥
+func OpenAttachmentKey(vaultKey []byte, userID int, attachmentID, wrapped string) ([]byte, error) {
+	encoded, err := crypto.DecryptWithAAD(wrapped, vaultKey, attachmentAAD(userID, attachmentID, "file_key"))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func wrapAttachmentKey(vaultKey []byte, userID int, attachmentID string, fileKey []byte) (string, error) {
+	return crypto.EncryptWithAAD(base64.StdEncoding.EncodeToString(fileKey), vaultKey, attachmentAAD(userID, attachmentID, "file_key"))
+}
+
+// EncryptAttachmentField 加密附件的文件名或类型
+func EncryptAttachmentField(vaultKey []byte, userID int, attachmentID, field, plaintext string) (string, error) {
+	return crypto.EncryptWithAAD(plaintext, vaultKey, attachmentAAD(userID, attachmentID, field))
+}
+
+// DecryptAttachmentField 解密附件的文件名或类型
+func DecryptAttachmentField(vaultKey []byte, userID int, attachmentID, field, ciphertext string) (string, error) {
+	return crypto.DecryptWithAAD(ciphertext, vaultKey, attachmentAAD(userID, attachmentID, field))
+}
+
+// rewrapAttachments 使用新的保险库密钥重新包装用户所有附件的文件密钥和元数据
+func rewrapAttachments(tx *sql.Tx, userID int, oldKey, newKey []byte) error {
+	type row struct{ id, fileKey, name, contentType string }
+
+	rows, err := tx.Query("SELECT id, file_key, name, content_type FROM attachments WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	var attachments []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.fileKey, &r.name, &r.contentType); err != nil {
+			rows.Close()
+			return err
+		}
+		attachments = append(attachments, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range attachments {
+		fileKey, err := OpenAttachmentKey(oldKey, userID, a.id, a.fileKey)
+		if err != nil {
+			return err
+		}
+		wrapped, err := wrapAttachmentKey(newKey, userID, a.id, fileKey)
+		crypto.Wipe(fileKey)
+		if err != nil {
+			return err
+		}
+
+		fields := map[string]*string{"name": &a.name, "content_type": &a.contentType}
+		for field, value := range fields {
+			plaintext, err := DecryptAttachmentField(oldKey, userID, a.id, field, *value)
+			if err != nil {
+				return err
+			}
+			if *value, err = EncryptAttachmentField(newKey, userID, a.id, field, plaintext); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(
+			"UPDATE attachments SET file_key = ?, name = ?, content_type = ? WHERE id = ?",
+			wrapped, a.name, a.contentType, a.id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package vault
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"gopass/internal/crypto"
+)
+
+// ErrShareMismatch 还原出的密钥与授权时的保险库密钥不一致
+var ErrShareMismatch = errors.New("reconstructed key does not match the vault key")
+
+// shareAAD 受托人持有的共享的附加数据
+func shareAAD(ownerID, trusteeID int) []byte {
+	return []byte(fmt.Sprintf("gopass:emergency:owner=%d:trustee=%d", ownerID, trusteeID))
+}
+
+// approvalAAD 受托人批准后转交给申请人的共享的附加数据
+func approvalAAD(requestID, trusteeID int) []byte {
+	return []byte(fmt.Sprintf("gopass:emergency:request=%d:trustee=%d", requestID, trusteeID))
+}
+
+// DistributeShares 将保险库密钥拆分为 len(trusteeIDs) 份（门限 threshold），
+// 每份分别密封给对应受托人的公钥，替换该用户之前的所有共享
+func DistributeShares(tx *sql.Tx, ownerID int, vaultKey []byte, trusteeIDs []int, threshold int) error {
+	shares, err := crypto.SplitSecret(vaultKey, len(trusteeIDs), threshold)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, share := range shares {
+			crypto.Wipe(share)
+		}
+	}()
+
+	if _, err := tx.Exec("DELETE FROM emergency_shares WHERE owner_id = ?", ownerID); err != nil {
+		return err
+	}
+
+	for i, trusteeID := range trusteeIDs {
+		publicKey, err := PublicKey(tx, trusteeID)
+		if err != nil {
+			return err
+		}
+
+		sealed, err := crypto.SealTo(publicKey, shares[i], shareAAD(ownerID, trusteeID))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO emergency_shares (owner_id, trustee_id, share) VALUES (?, ?, ?)",
+			ownerID, trusteeID, sealed,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reshareEmergencyAccess 保险库密钥轮换后重新分发共享，旧共享和进行中的申请随之作废
+func reshareEmergencyAccess(tx *sql.Tx, ownerID int, newKey []byte) error {
+	var threshold int
+	err := tx.QueryRow("SELECT threshold FROM emergency_grants WHERE owner_id = ?", ownerID).Scan(&threshold)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT trustee_id FROM emergency_shares WHERE owner_id = ? ORDER BY trustee_id", ownerID)
+	if err != nil {
+		return err
+	}
+	var trusteeIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		trusteeIDs = append(trusteeIDs, id)
+	}
+	rows.Close()
+
+	if err := DistributeShares(tx, ownerID, newKey, trusteeIDs, threshold); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE emergency_grants SET key_id = ? WHERE owner_id = ?", crypto.KeyID(newKey), ownerID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE emergency_requests SET status = 'cancelled', decided_at = CURRENT_TIMESTAMP WHERE owner_id = ? AND status IN ('pending', 'granted')", ownerID)
+	if err != nil {
+		return err
+	}
+	if cancelled, _ := result.RowsAffected(); cancelled > 0 {
+		log.Printf("Cancelled %d open emergency requests of user %d after key rotation", cancelled, ownerID)
+	}
+	return nil
+}
+
+// RemoveTrustee 删除账户前销毁该用户作为受托人持有的共享。
+// 剩余受托人不足门限的紧急访问无法再恢复，随之删除并取消进行中的申请
+func RemoveTrustee(tx *sql.Tx, trusteeID int) error {
+	rows, err := tx.Query("SELECT owner_id FROM emergency_shares WHERE trustee_id = ?", trusteeID)
+	if err != nil {
+		return err
+	}
+	var ownerIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ownerIDs = append(ownerIDs, id)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("DELETE FROM emergency_shares WHERE trustee_id = ?", trusteeID); err != nil {
+		return err
+	}
+
+	for _, ownerID := range ownerIDs {
+		var remaining, threshold int
+		err := tx.QueryRow(
+			"SELECT (SELECT COUNT(*) FROM emergency_shares WHERE owner_id = ?), threshold FROM emergency_grants WHERE owner_id = ?",
+			ownerID, ownerID,
+		).Scan(&remaining, &threshold)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if remaining >= threshold {
+			continue
+		}
+
+		statements := []string{
+			"DELETE FROM emergency_shares WHERE owner_id = ?",
+			"DELETE FROM emergency_grants WHERE owner_id = ?",
+			"UPDATE emergency_requests SET status = 'cancelled', decided_at = CURRENT_TIMESTAMP WHERE owner_id = ? AND status IN ('pending', 'granted')",
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement, ownerID); err != nil {
+				return err
+			}
+		}
+		log.Printf("Removed emergency access of user %d: fewer than %d trustees remain", ownerID, threshold)
+	}
+	return nil
+}
+
+// OpenShare 受托人用自己的私钥打开所持有的共享
+func OpenShare(ownerID, trusteeID int, trusteeVaultKey []byte, sealed string) ([]byte, error) {
+	private, err := PrivateKey(trusteeID, trusteeVaultKey)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(private)
+
+	return crypto.OpenSealed(private, sealed, shareAAD(ownerID, trusteeID))
+}
+
+// SealApproval 受托人批准申请时，将共享转密封给申请人
+func SealApproval(requestID, trusteeID int, requesterPublicKey, share []byte) (string, error) {
+	return crypto.SealTo(requesterPublicKey, share, approvalAAD(requestID, trusteeID))
+}
+
+// ReconstructVaultKey 申请人打开各受托人转交的共享并还原保险库密钥，
+// approvals 的键为受托人ID，值为密封的共享；keyID 用于校验还原结果
+func ReconstructVaultKey(requestID, requesterID int, requesterVaultKey []byte, approvals map[int]string, keyID string) ([]byte, error) {
+	private, err := PrivateKey(requesterID, requesterVaultKey)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(private)
+
+	var shares [][]byte
+	defer func() {
+		for _, share := range shares {
+			crypto.Wipe(share)
+		}
+	}()
+	for trusteeID, sealed := range approvals {
+		share, err := crypto.OpenSealed(private, sealed, approvalAAD(requestID, trusteeID))
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	key, err := crypto.CombineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.KeyID(key) != keyID {
+		crypto.Wipe(key)
+		return nil, ErrShareMismatch
+	}
+	return key, nil
+}
@@ -0,0 +1,259 @@
+package vault
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"gopass/internal/crypto"
+	"gopass/internal/models"
+)
+
+// 用户条目数据的加密格式版本，记录在 users.vault_format
+const (
+	// FormatLegacy 由用户ID推导的固定密钥加密
+	FormatLegacy = 0
+	// FormatVaultKey 保险库密钥加密，未绑定附加数据
+	FormatVaultKey = 1
+	// FormatBound 保险库密钥加密，并绑定用户ID、条目ID和字段名
+	FormatBound = 2
+	// FormatAllFields 标题、网站、用户名、备注也被加密
+	FormatAllFields = 3
+
+	// CurrentFormat 新写入数据使用的格式
+	CurrentFormat = FormatAllFields
+)
+
+// entryFields 返回条目中需要加密的字段，键为列名
+func entryFields(p *models.Password) map[string]*string {
+	return map[string]*string{
+		"title":    &p.Title,
+		"website":  &p.Website,
+		"username": &p.Username,
+		"password": &p.Password,
+		"notes":    &p.Notes,
+	}
+}
+
+// optionalEntryFields 返回后来增加的可选字段，为空时不加密，已有条目因此无需迁移
+func optionalEntryFields(p *models.Password) map[string]*string {
+	return map[string]*string{
+		"totp_secret":   &p.TOTPSecret,
+		"payload":       &p.Payload,
+		"custom_fields": &p.FieldsData,
+	}
+}
+
+// UndecryptableError 迁移或轮换时有条目无法解密。跳过这些条目会使其永久无法读取，因此整个事务被回滚
+type UndecryptableError struct {
+	EntryIDs []int
+}
+
+func (e *UndecryptableError) Error() string {
+	return fmt.Sprintf("%d password entries cannot be decrypted: %v", len(e.EntryIDs), e.EntryIDs)
+}
+
+// FieldAAD 返回条目字段密文的附加数据，使密文无法在条目或用户之间移植
+func FieldAAD(userID, entryID int, field string) []byte {
+	return []byte(fmt.Sprintf("gopass:user=%d:entry=%d:field=%s", userID, entryID, field))
+}
+
+// EncryptField 加密条目字段并绑定到所属的行
+func EncryptField(key []byte, userID, entryID int, field, plaintext string) (string, error) {
+	return crypto.EncryptWithAAD(plaintext, key, FieldAAD(userID, entryID, field))
+}
+
+// DecryptField 解密条目字段，拒绝未绑定或属于其他行的密文
+func DecryptField(key []byte, userID, entryID int, field, ciphertext string) (string, error) {
+	return crypto.DecryptWithAAD(ciphertext, key, FieldAAD(userID, entryID, field))
+}
+
+// encodeItem 将类型专属字段和自定义字段分别序列化到 Payload 和 FieldsData。
+// 字段为空时保留原有的JSON，因此重新加密时不必还原这些字段
+func encodeItem(p *models.Password) error {
+	if len(p.Fields) > 0 {
+		data, err := json.Marshal(p.Fields)
+		if err != nil {
+			return err
+		}
+		p.FieldsData = string(data)
+	}
+
+	var fields interface{}
+	switch {
+	case p.Card != nil:
+		fields = p.Card
+	case p.Identity != nil:
+		fields = p.Identity
+	case p.SSHKey != nil:
+		fields = p.SSHKey
+	default:
+		return nil
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	p.Payload = string(data)
+	return nil
+}
+
+// decodeItem 从解密后的JSON还原自定义字段，并按条目类型还原类型专属字段
+func decodeItem(p *models.Password) error {
+	if p.FieldsData != "" {
+		if err := json.Unmarshal([]byte(p.FieldsData), &p.Fields); err != nil {
+			return err
+		}
+	}
+
+	if p.Payload == "" {
+		return nil
+	}
+
+	switch p.Type {
+	case models.ItemTypeCard:
+		p.Card = &models.CardFields{}
+		return json.Unmarshal([]byte(p.Payload), p.Card)
+	case models.ItemTypeIdentity:
+		p.Identity = &models.IdentityFields{}
+		return json.Unmarshal([]byte(p.Payload), p.Identity)
+	case models.ItemTypeSSHKey:
+		p.SSHKey = &models.SSHKeyFields{}
+		return json.Unmarshal([]byte(p.Payload), p.SSHKey)
+	}
+	return nil
+}
+
+// EncryptEntry 返回条目的副本，其中敏感字段被替换为绑定到该条目的密文
+func EncryptEntry(key []byte, userID, entryID int, p models.Password) (models.Password, error) {
+	if err := encodeItem(&p); err != nil {
+		return p, err
+	}
+	for field, value := range entryFields(&p) {
+		encrypted, err := EncryptField(key, userID, entryID, field, *value)
+		if err != nil {
+			return p, err
+		}
+		*value = encrypted
+	}
+	for field, value := range optionalEntryFields(&p) {
+		if *value == "" {
+			continue
+		}
+		encrypted, err := EncryptField(key, userID, entryID, field, *value)
+		if err != nil {
+			return p, err
+		}
+		*value = encrypted
+	}
+	return p, nil
+}
+
+// DecryptEntry 就地解密条目的敏感字段，p.ID 必须已设置
+func DecryptEntry(key []byte, userID int, p *models.Password) error {
+	for field, value := range entryFields(p) {
+		plaintext, err := DecryptField(key, userID, p.ID, field, *value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %v", field, err)
+		}
+		*value = plaintext
+	}
+	for field, value := range optionalEntryFields(p) {
+		if *value == "" {
+			continue
+		}
+		plaintext, err := DecryptField(key, userID, p.ID, field, *value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %v", field, err)
+		}
+		*value = plaintext
+	}
+	if err := decodeItem(p); err != nil {
+		return fmt.Errorf("failed to decode fields: %v", err)
+	}
+	return nil
+}
+
+// decryptAnyFormat 解密任意旧格式的字段，仅在迁移时使用
+func decryptAnyFormat(key []byte, userID, entryID int, field, ciphertext string) (string, error) {
+	plaintext, err := DecryptField(key, userID, entryID, field, ciphertext)
+	if err == crypto.ErrUnboundCiphertext {
+		return crypto.Decrypt(ciphertext, key)
+	}
+	return plaintext, err
+}
+
+// upgradeEntries 将用户的所有条目从 oldKey 下的 fromFormat 格式重新加密为 newKey 下的当前格式。
+// 任何条目无法解密时返回列出全部这类条目的 UndecryptableError，调用方必须回滚事务
+func upgradeEntries(tx *sql.Tx, userID, fromFormat int, oldKey, newKey []byte) (int, error) {
+	rows, err := tx.Query("SELECT id, title, website, username, password, notes, totp_secret, payload, custom_fields FROM passwords WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []models.Password
+	for rows.Next() {
+		var p models.Password
+		var website, username, notes sql.NullString
+		if err := rows.Scan(&p.ID, &p.Title, &website, &username, &p.Password, &notes, &p.TOTPSecret, &p.Payload, &p.FieldsData); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		p.Website, p.Username, p.Notes = website.String, username.String, notes.String
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	upgraded := 0
+	var undecryptable []int
+	for _, p := range pending {
+		// 继续检查其余条目，以便一次报告所有无法解密的条目
+		if err := decryptForUpgrade(oldKey, userID, fromFormat, &p); err != nil {
+			log.Printf("Password entry %d of user %d cannot be decrypted: %v", p.ID, userID, err)
+			undecryptable = append(undecryptable, p.ID)
+			continue
+		}
+		if len(undecryptable) > 0 {
+			continue
+		}
+
+		encrypted, err := EncryptEntry(newKey, userID, p.ID, p)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(
+			"UPDATE passwords SET title = ?, website = ?, username = ?, password = ?, notes = ?, totp_secret = ?, payload = ?, custom_fields = ? WHERE id = ?",
+			encrypted.Title, encrypted.Website, encrypted.Username, encrypted.Password, encrypted.Notes, encrypted.TOTPSecret, encrypted.Payload,
+			encrypted.FieldsData, p.ID,
+		)
+		if err != nil {
+			return 0, err
+		}
+		upgraded++
+	}
+
+	if len(undecryptable) > 0 {
+		return 0, &UndecryptableError{EntryIDs: undecryptable}
+	}
+	return upgraded, nil
+}
+
+// decryptForUpgrade 按旧格式解密条目，格式3之前只有密码列是密文
+func decryptForUpgrade(key []byte, userID, fromFormat int, p *models.Password) error {
+	if fromFormat >= FormatAllFields {
+		return DecryptEntry(key, userID, p)
+	}
+
+	plaintext, err := decryptAnyFormat(key, userID, p.ID, "password", p.Password)
+	if err != nil {
+		return err
+	}
+	p.Password = plaintext
+	return nil
+}
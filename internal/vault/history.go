@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gopass/internal/database"
+	"gopass/internal/models"
+)
+
+// 条目被替换的旧密码保存在 password_history 表中，与条目字段一样由保险库密钥加密并绑定用户ID和条目ID
+
+// historyField 历史密码密文绑定的字段名
+const historyField = "password_history"
+
+// AddPasswordHistory 在事务中记录条目被替换的旧密码，并只保留最近 keep 条，keep 为0时清空条目的历史
+func AddPasswordHistory(tx *sql.Tx, key []byte, userID, entryID int, password string, replacedAt time.Time, keep int) error {
+	if keep > 0 && password != "" {
+		encrypted, err := EncryptField(key, userID, entryID, historyField, password)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"INSERT INTO password_history (password_id, user_id, password, replaced_at) VALUES (?, ?, ?, ?)",
+			entryID, userID, encrypted, replacedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`
+		DELETE FROM password_history WHERE password_id = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE password_id = ? ORDER BY id DESC LIMIT ?
+		)`,
+		entryID, entryID, keep,
+	)
+	return err
+}
+
+// PasswordHistory 返回条目最近 keep 条历史密码，按替换时间从新到旧排列
+func PasswordHistory(key []byte, userID, entryID, keep int) ([]models.PasswordHistory, error) {
+	rows, err := database.DB.Query(
+		"SELECT id, password, replaced_at FROM password_history WHERE password_id = ? AND user_id = ? ORDER BY id DESC LIMIT ?",
+		entryID, userID, keep,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.PasswordHistory{}
+	for rows.Next() {
+		h := models.PasswordHistory{PasswordID: entryID}
+		var encrypted string
+		if err := rows.Scan(&h.ID, &encrypted, &h.ReplacedAt); err != nil {
+			return nil, err
+		}
+		if h.Password, err = DecryptField(key, userID, entryID, historyField, encrypted); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+// HistoryPassword 在事务中读取并解密一条历史密码
+func HistoryPassword(tx *sql.Tx, key []byte, userID, entryID, historyID int) (string, error) {
+	var encrypted string
+	err := tx.QueryRow(
+		"SELECT password FROM password_history WHERE id = ? AND password_id = ? AND user_id = ?", historyID, entryID, userID,
+	).Scan(&encrypted)
+	if err != nil {
+		return "", err
+	}
+	return DecryptField(key, userID, entryID, historyField, encrypted)
+}
+
+// RestorePasswordHistory 在事务中把一条历史密码恢复为条目的当前密码，当前密码写入历史。历史记录不存在时返回 sql.ErrNoRows
+func RestorePasswordHistory(tx *sql.Tx, key []byte, userID, entryID, historyID int, restoredAt time.Time, keep int) error {
+	restored, err := HistoryPassword(tx, key, userID, entryID, historyID)
+	if err != nil {
+		return err
+	}
+
+	var current string
+	err = tx.QueryRow("SELECT password FROM passwords WHERE id = ? AND user_id = ?", entryID, userID).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current, err = DecryptField(key, userID, entryID, "password", current); err != nil {
+		return err
+	}
+	encrypted, err := EncryptField(key, userID, entryID, "password", restored)
+	if err != nil {
+		return err
+	}
+
+	// 恢复的密码重新成为当前密码，不再保留在历史中
+	if _, err := tx.Exec("DELETE FROM password_history WHERE id = ?", historyID); err != nil {
+		return err
+	}
+	if current != restored {
+		if err := AddPasswordHistory(tx, key, userID, entryID, current, restoredAt, keep); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("UPDATE passwords SET password = ?, updated_at = ? WHERE id = ? AND user_id = ?", encrypted, restoredAt, entryID, userID)
+	return err
+}
+
+// reencryptPasswordHistory 使用新的保险库密钥重新加密用户的所有历史密码，任何一条无法解密时轮换失败
+func reencryptPasswordHistory(tx *sql.Tx, userID int, oldKey, newKey []byte) error {
+	type row struct {
+		id, entryID int
+		password    string
+	}
+
+	rows, err := tx.Query("SELECT id, password_id, password FROM password_history WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	var history []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.entryID, &r.password); err != nil {
+			rows.Close()
+			return err
+		}
+		history = append(history, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, h := range history {
+		plaintext, err := DecryptField(oldKey, userID, h.entryID, historyField, h.password)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt password history %d: %v", h.id, err)
+		}
+		encrypted, err := EncryptField(newKey, userID, h.entryID, historyField, plaintext)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE password_history SET password = ? WHERE id = ?", encrypted, h.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"gopass/internal/database"
+	"gopass/internal/models"
+)
+
+// withTx 在事务中执行 fn 并提交
+func withTx(t *testing.T, fn func(tx *sql.Tx) error) error {
+	t.Helper()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// historyCount 返回条目在 password_history 表中的行数
+func historyCount(t *testing.T, entryID int) int {
+	t.Helper()
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM password_history WHERE password_id = ?", entryID).Scan(&count); err != nil {
+		t.Fatalf("Failed to count history: %v", err)
+	}
+	return count
+}
+
+func TestPasswordHistoryRetention(t *testing.T) {
+	testDB(t)
+	userID, key := createUser(t, "alice")
+	entryID := addEntry(t, userID, key, models.Password{Title: "Mail", Password: "current"})
+
+	for i := 0; i < 5; i++ {
+		err := withTx(t, func(tx *sql.Tx) error {
+			return AddPasswordHistory(tx, key, userID, entryID, fmt.Sprintf("secret-%d", i), time.Now(), 3)
+		})
+		if err != nil {
+			t.Fatalf("Failed to add history: %v", err)
+		}
+	}
+
+	if count := historyCount(t, entryID); count != 3 {
+		t.Errorf("History should be trimmed to 3 rows, got %d", count)
+	}
+	history, err := PasswordHistory(key, userID, entryID, 10)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	var passwords []string
+	for _, h := range history {
+		passwords = append(passwords, h.Password)
+	}
+	if fmt.Sprint(passwords) != "[secret-4 secret-3 secret-2]" {
+		t.Errorf("History should keep the newest passwords, newest first, got %v", passwords)
+	}
+}
+
+func TestPasswordHistoryKeepZero(t *testing.T) {
+	testDB(t)
+	userID, key := createUser(t, "alice")
+	entryID := addEntry(t, userID, key, models.Password{Title: "Mail", Password: "current"})
+	addHistory(t, userID, entryID, key, "secret-1")
+	addHistory(t, userID, entryID, key, "secret-2")
+
+	err := withTx(t, func(tx *sql.Tx) error {
+		return AddPasswordHistory(tx, key, userID, entryID, "secret-3", time.Now(), 0)
+	})
+	if err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+	if count := historyCount(t, entryID); count != 0 {
+		t.Errorf("keep 0 should clear the history, got %d rows", count)
+	}
+}
+
+func TestPasswordHistoryBoundToEntry(t *testing.T) {
+	testDB(t)
+	userID, key := createUser(t, "alice")
+	entryID := addEntry(t, userID, key, models.Password{Title: "Mail", Password: "current"})
+	otherID := addEntry(t, userID, key, models.Password{Title: "Bank", Password: "other"})
+	addHistory(t, userID, entryID, key, "secret-1")
+
+	// 把历史密码挪到另一个条目下，密文绑定的条目ID不同，无法解密
+	if _, err := database.DB.Exec("UPDATE password_history SET password_id = ? WHERE password_id = ?", otherID, entryID); err != nil {
+		t.Fatalf("Failed to move history: %v", err)
+	}
+	if _, err := PasswordHistory(key, userID, otherID, 10); err == nil {
+		t.Error("History moved to another entry should not decrypt")
+	}
+}
+
+func TestRestorePasswordHistory(t *testing.T) {
+	testDB(t)
+	userID, key := createUser(t, "alice")
+	entryID := addEntry(t, userID, key, models.Password{Title: "Mail", Password: "current"})
+	addHistory(t, userID, entryID, key, "previous")
+
+	history, err := PasswordHistory(key, userID, entryID, 10)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected one history entry, got %+v: %v", history, err)
+	}
+	err = withTx(t, func(tx *sql.Tx) error {
+		return RestorePasswordHistory(tx, key, userID, entryID, history[0].ID, time.Now(), 10)
+	})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	p, err := readEntry(userID, entryID, key)
+	if err != nil || p.Password != "previous" {
+		t.Errorf("Restored password should become current, got %q: %v", p.Password, err)
+	}
+	history, err = PasswordHistory(key, userID, entryID, 10)
+	if err != nil || len(history) != 1 || history[0].Password != "current" {
+		t.Errorf("Replaced password should move to history, got %+v: %v", history, err)
+	}
+
+	err = withTx(t, func(tx *sql.Tx) error {
+		return RestorePasswordHistory(tx, key, userID, entryID, history[0].ID+100, time.Now(), 10)
+	})
+	if err != sql.ErrNoRows {
+		t.Errorf("Restoring a missing history entry should return sql.ErrNoRows, got %v", err)
+	}
+}
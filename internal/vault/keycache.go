@@ -0,0 +1,123 @@
+package vault
+
+import (
+	"sync"
+	"time"
+
+	"gopass/internal/crypto"
+)
+
+// cachedKey 会话中已解锁的保险库密钥
+type cachedKey struct {
+	userID    int
+	key       []byte
+	expiresAt time.Time
+	idle      time.Duration // 超过该时长未使用即清除，0表示不限
+	lastUsed  time.Time
+}
+
+// expired 缓存项是否已过期或闲置超时
+func (e *cachedKey) expired(now time.Time) bool {
+	return now.After(e.expiresAt) || (e.idle > 0 && now.Sub(e.lastUsed) > e.idle)
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*cachedKey)
+)
+
+// Store 将解锁后的保险库密钥保存到会话缓存中，密钥仅存在于内存。
+// 密钥最多保存 ttl，idle 不为0时连续 idle 未使用也会被清除
+func Store(sessionID string, userID int, key []byte, ttl, idle time.Duration) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	now := time.Now()
+	sweepLocked(now)
+	if old, ok := cache[sessionID]; ok {
+		crypto.Wipe(old.key)
+	}
+
+	cache[sessionID] = &cachedKey{
+		userID:    userID,
+		key:       append([]byte(nil), key...),
+		expiresAt: now.Add(ttl),
+		idle:      idle,
+		lastUsed:  now,
+	}
+}
+
+// Key 获取会话的保险库密钥副本，并重新开始闲置计时
+func Key(sessionID string, userID int) ([]byte, bool) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	entry, ok := cache[sessionID]
+	if !ok || entry.userID != userID {
+		return nil, false
+	}
+	now := time.Now()
+	if entry.expired(now) {
+		crypto.Wipe(entry.key)
+		delete(cache, sessionID)
+		return nil, false
+	}
+
+	entry.lastUsed = now
+	return append([]byte(nil), entry.key...), true
+}
+
+// Unlocked 会话的保险库密钥是否仍在缓存中，不影响闲置计时
+func Unlocked(sessionID string, userID int) bool {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	entry, ok := cache[sessionID]
+	return ok && entry.userID == userID && !entry.expired(time.Now())
+}
+
+// Forget 清除会话的保险库密钥
+func Forget(sessionID string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if entry, ok := cache[sessionID]; ok {
+		crypto.Wipe(entry.key)
+		delete(cache, sessionID)
+	}
+}
+
+// ForgetUser 清除用户所有会话的保险库密钥
+func ForgetUser(userID int) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	for sessionID, entry := range cache {
+		if entry.userID == userID {
+			crypto.Wipe(entry.key)
+			delete(cache, sessionID)
+		}
+	}
+}
+
+// SweepEvery 定期清除过期和闲置超时的密钥，使其不必等到下次访问才从内存中清零
+func SweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		cacheMu.Lock()
+		sweepLocked(now)
+		cacheMu.Unlock()
+	}
+}
+
+// sweepLocked 清理过期的缓存项，调用方需持有锁
+func sweepLocked(now time.Time) {
+	for sessionID, entry := range cache {
+		if entry.expired(now) {
+			crypto.Wipe(entry.key)
+			delete(cache, sessionID)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// cacheKey 生成测试用的保险库密钥
+func cacheKey() []byte {
+	return bytes.Repeat([]byte{0x42}, 32)
+}
+
+// cachedBytes 返回缓存中密钥的底层切片，用于检查清除后是否被清零
+func cachedBytes(t *testing.T, sessionID string) []byte {
+	t.Helper()
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	entry, ok := cache[sessionID]
+	if !ok {
+		t.Fatalf("Session %s should be cached", sessionID)
+	}
+	return entry.key
+}
+
+// wiped 切片是否已被清零
+func wiped(b []byte) bool {
+	return bytes.Equal(b, make([]byte, len(b)))
+}
+
+func TestKeyCacheStore(t *testing.T) {
+	t.Cleanup(func() { Forget("store") })
+	key := cacheKey()
+	Store("store", 1, key, time.Hour, 0)
+
+	got, ok := Key("store", 1)
+	if !ok || !bytes.Equal(got, key) {
+		t.Fatal("Stored key should be returned")
+	}
+	// 返回的是副本，修改不影响缓存
+	got[0] = 0
+	if again, _ := Key("store", 1); !bytes.Equal(again, key) {
+		t.Error("Key should return a copy of the cached key")
+	}
+	if _, ok := Key("store", 2); ok {
+		t.Error("Key should not be returned for another user")
+	}
+}
+
+func TestKeyCacheIdleExpiry(t *testing.T) {
+	t.Cleanup(func() { Forget("idle") })
+	Store("idle", 1, cacheKey(), time.Hour, 100*time.Millisecond)
+	stored := cachedBytes(t, "idle")
+
+	time.Sleep(150 * time.Millisecond)
+	if Unlocked("idle", 1) {
+		t.Error("Key should be locked after the idle period")
+	}
+	if _, ok := Key("idle", 1); ok {
+		t.Error("Key should expire after the idle period")
+	}
+	if !wiped(stored) {
+		t.Error("Expired key should be wiped")
+	}
+}
+
+func TestKeyCacheAccessExtendsIdle(t *testing.T) {
+	t.Cleanup(func() { Forget("active") })
+	Store("active", 1, cacheKey(), time.Hour, 200*time.Millisecond)
+
+	// 累计时间超过闲置时长，但每次访问都重新开始计时
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, ok := Key("active", 1); !ok {
+			t.Fatalf("Key should stay cached while in use, expired after access %d", i)
+		}
+	}
+
+	// Unlocked 只检查状态，不重新开始计时
+	time.Sleep(120 * time.Millisecond)
+	Unlocked("active", 1)
+	time.Sleep(120 * time.Millisecond)
+	if _, ok := Key("active", 1); ok {
+		t.Error("Unlocked should not extend the idle period")
+	}
+}
+
+func TestKeyCacheAbsoluteExpiry(t *testing.T) {
+	t.Cleanup(func() { Forget("absolute") })
+	Store("absolute", 1, cacheKey(), 250*time.Millisecond, 200*time.Millisecond)
+
+	// 持续使用也不能超过最长保存时间
+	for i := 0; i < 5; i++ {
+		time.Sleep(100 * time.Millisecond)
+		Key("absolute", 1)
+	}
+	if _, ok := Key("absolute", 1); ok {
+		t.Error("Key should expire after its time to live even if used")
+	}
+}
+
+func TestKeyCacheForget(t *testing.T) {
+	t.Cleanup(func() { Forget("forget") })
+	Store("forget", 1, cacheKey(), time.Hour, 0)
+	stored := cachedBytes(t, "forget")
+
+	Forget("forget")
+	if _, ok := Key("forget", 1); ok {
+		t.Error("Forgotten key should not be returned")
+	}
+	if !wiped(stored) {
+		t.Error("Forget should wipe the cached key")
+	}
+}
+
+func TestKeyCacheForgetUser(t *testing.T) {
+	sessions := []string{"user1-a", "user1-b", "user2"}
+	t.Cleanup(func() {
+		for _, id := range sessions {
+			Forget(id)
+		}
+	})
+	Store("user1-a", 1, cacheKey(), time.Hour, 0)
+	Store("user1-b", 1, cacheKey(), time.Hour, 0)
+	Store("user2", 2, cacheKey(), time.Hour, 0)
+	storedA, storedB := cachedBytes(t, "user1-a"), cachedBytes(t, "user1-b")
+
+	ForgetUser(1)
+	if Unlocked("user1-a", 1) || Unlocked("user1-b", 1) {
+		t.Error("ForgetUser should remove every session of the user")
+	}
+	if !wiped(storedA) || !wiped(storedB) {
+		t.Error("ForgetUser should wipe the cached keys")
+	}
+	if !Unlocked("user2", 2) {
+		t.Error("ForgetUser should not affect other users")
+	}
+}
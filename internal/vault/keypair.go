@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// ErrNoKeyPair 用户尚未生成密钥对（从未在新版本中登录过）
+var ErrNoKeyPair = errors.New("user has no key pair yet")
+
+// privateKeyAAD 私钥密文的附加数据
+func privateKeyAAD(userID int) []byte {
+	return []byte(fmt.Sprintf("gopass:user=%d:private-key", userID))
+}
+
+// EnsureKeyPair 确保用户拥有X25519密钥对。公钥明文保存，私钥由保险库密钥包装
+func EnsureKeyPair(userID int, vaultKey []byte) error {
+	var publicKey sql.NullString
+	if err := database.DB.QueryRow("SELECT public_key FROM users WHERE id = ?", userID).Scan(&publicKey); err != nil {
+		return err
+	}
+	if publicKey.Valid && publicKey.String != "" {
+		return nil
+	}
+
+	public, private, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(private)
+
+	wrapped, err := wrapPrivateKey(userID, vaultKey, private)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET public_key = ?, private_key = ? WHERE id = ? AND public_key IS NULL",
+		base64.StdEncoding.EncodeToString(public), wrapped, userID,
+	)
+	return err
+}
+
+// PublicKey 返回用户的公钥
+func PublicKey(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, userID int) ([]byte, error) {
+	var publicKey sql.NullString
+	if err := q.QueryRow("SELECT public_key FROM users WHERE id = ?", userID).Scan(&publicKey); err != nil {
+		return nil, err
+	}
+	if !publicKey.Valid || publicKey.String == "" {
+		return nil, ErrNoKeyPair
+	}
+	return base64.StdEncoding.DecodeString(publicKey.String)
+}
+
+// PrivateKey 使用保险库密钥解开用户的私钥
+func PrivateKey(userID int, vaultKey []byte) ([]byte, error) {
+	var wrapped sql.NullString
+	if err := database.DB.QueryRow("SELECT private_key FROM users WHERE id = ?", userID).Scan(&wrapped); err != nil {
+		return nil, err
+	}
+	if !wrapped.Valid || wrapped.String == "" {
+		return nil, ErrNoKeyPair
+	}
+	return unwrapPrivateKey(userID, vaultKey, wrapped.String)
+}
+
+// rewrapPrivateKey 轮换保险库密钥时重新包装私钥
+func rewrapPrivateKey(tx *sql.Tx, userID int, oldKey, newKey []byte) error {
+	var wrapped sql.NullString
+	if err := tx.QueryRow("SELECT private_key FROM users WHERE id = ?", userID).Scan(&wrapped); err != nil {
+		return err
+	}
+	if !wrapped.Valid || wrapped.String == "" {
+		return nil
+	}
+
+	private, err := unwrapPrivateKey(userID, oldKey, wrapped.String)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(private)
+
+	rewrapped, err := wrapPrivateKey(userID, newKey, private)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE users SET private_key = ? WHERE id = ?", rewrapped, userID)
+	return err
+}
+
+func wrapPrivateKey(userID int, vaultKey, private []byte) (string, error) {
+	return crypto.EncryptWithAAD(base64.StdEncoding.EncodeToString(private), vaultKey, privateKeyAAD(userID))
+}
+
+func unwrapPrivateKey(userID int, vaultKey []byte, wrapped string) ([]byte, error) {
+	encoded, err := crypto.DecryptWithAAD(wrapped, vaultKey, privateKeyAAD(userID))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
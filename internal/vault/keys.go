@@ -0,0 +1,293 @@
+package vault
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// ErrWrongPassword 主密码无法解开保险库密钥
+var ErrWrongPassword = errors.New("vault key could not be unwrapped")
+
+// ErrStaleKey 缓存的保险库密钥已被轮换，不能再用于加密
+var ErrStaleKey = errors.New("vault key has been rotated")
+
+// WrappedKey 存储在users表中的被包装的保险库密钥
+type WrappedKey struct {
+	Salt     string
+	Params   string
+	VaultKey string
+	KeyID    string // 保险库密钥的ID，用于识别已被轮换的旧密钥
+}
+
+// NewVaultKey 生成随机保险库密钥，并用主密码派生的KEK包装
+func NewVaultKey(password string) ([]byte, *WrappedKey, error) {
+	key, err := crypto.GenerateRandomKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, err := WrapWithPassword(key, password)
+	if err != nil {
+		crypto.Wipe(key)
+		return nil, nil, err
+	}
+
+	return key, wrapped, nil
+}
+
+// WrapWithPassword 使用新的盐和默认参数将保险库密钥包装到主密码下
+func WrapWithPassword(key []byte, password string) (*WrappedKey, error) {
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	params := crypto.DefaultKDFParams
+	kek := crypto.DeriveKey(password, salt, params)
+	defer crypto.Wipe(kek)
+
+	wrappedKey, err := crypto.WrapKey(kek, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WrappedKey{
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+		Params:   params.String(),
+		VaultKey: wrappedKey,
+		KeyID:    crypto.KeyID(key),
+	}, nil
+}
+
+// Unwrap 使用主密码解开保险库密钥
+func (w *WrappedKey) Unwrap(password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(w.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kdf salt: %v", err)
+	}
+
+	params, err := crypto.ParseKDFParams(w.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	kek := crypto.DeriveKey(password, salt, params)
+	defer crypto.Wipe(kek)
+
+	key, err := crypto.UnwrapKey(kek, w.VaultKey)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return key, nil
+}
+
+// LegacyKey 旧版本由用户ID推导出的固定密钥，仅用于迁移
+func LegacyKey(userID int) []byte {
+	return crypto.GenerateKey("user-master-key-" + strconv.Itoa(userID))
+}
+
+// Unlock 在登录成功后解开用户的保险库密钥。
+// 尚未建立密钥层级的旧账户会在此时生成保险库密钥；旧格式的条目会被重新加密为当前格式。
+func Unlock(userID int, password string) ([]byte, error) {
+	var salt, params, vaultKey, keyID sql.NullString
+	var format int
+	err := database.DB.QueryRow(
+		"SELECT kdf_salt, kdf_params, vault_key, vault_key_id, vault_format FROM users WHERE id = ?",
+		userID,
+	).Scan(&salt, &params, &vaultKey, &keyID, &format)
+	if err != nil {
+		return nil, err
+	}
+
+	if !vaultKey.Valid || vaultKey.String == "" {
+		return migrateLegacy(userID, password)
+	}
+
+	wrapped := &WrappedKey{Salt: salt.String, Params: params.String, VaultKey: vaultKey.String}
+	key, err := wrapped.Unwrap(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// 记录密钥ID之前创建的账户在解锁时补写
+	if keyID.String == "" {
+		if _, err := database.DB.Exec("UPDATE users SET vault_key_id = ? WHERE id = ?", crypto.KeyID(key), userID); err != nil {
+			crypto.Wipe(key)
+			return nil, err
+		}
+	}
+
+	if format < CurrentFormat {
+		if err := upgradeFormat(userID, format, key); err != nil {
+			crypto.Wipe(key)
+			return nil, err
+		}
+	}
+
+	if err := EnsureKeyPair(userID, key); err != nil {
+		crypto.Wipe(key)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// migrateLegacy 为旧账户生成保险库密钥，并在同一事务中重新加密所有条目。
+// 旧账户没有恢复密钥，登录完成后由 EnsureRecoveryKey 补发
+func migrateLegacy(userID int, password string) ([]byte, error) {
+	key, wrapped, err := NewVaultKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		crypto.Wipe(key)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	migrated, err := upgradeEntries(tx, userID, FormatLegacy, LegacyKey(userID), key)
+	if err != nil {
+		crypto.Wipe(key)
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET kdf_salt = ?, kdf_params = ?, vault_key = ?, vault_key_id = ?, vault_format = ? WHERE id = ?",
+		wrapped.Salt, wrapped.Params, wrapped.VaultKey, wrapped.KeyID, CurrentFormat, userID,
+	)
+	if err != nil {
+		crypto.Wipe(key)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		crypto.Wipe(key)
+		return nil, err
+	}
+
+	log.Printf("Migrated %d password entries of user %d to vault key", migrated, userID)
+
+	if err := EnsureKeyPair(userID, key); err != nil {
+		crypto.Wipe(key)
+		return nil, err
+	}
+	return key, nil
+}
+
+// upgradeFormat 在同一事务中将用户条目重新加密为当前格式
+func upgradeFormat(userID, fromFormat int, key []byte) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upgraded, err := upgradeEntries(tx, userID, fromFormat, key, key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET vault_format = ? WHERE id = ?", CurrentFormat, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Upgraded %d password entries of user %d to format %d", upgraded, userID, CurrentFormat)
+	return nil
+}
+
+// ChangePassword 用新主密码重新包装保险库密钥并更新登录哈希。
+// 保险库密钥本身不变，条目无需重新加密
+func ChangePassword(userID int, currentPassword, newPassword string) error {
+	key, err := Unlock(userID, currentPassword)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(key)
+
+	wrapped, err := WrapWithPassword(key, newPassword)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET password_hash = ?, kdf_salt = ?, kdf_params = ?, vault_key = ?, updated_at = ? WHERE id = ?",
+		passwordHash, wrapped.Salt, wrapped.Params, wrapped.VaultKey, time.Now(), userID,
+	)
+	return err
+}
+
+// ErrAlreadySetUp 账户已经设置过主密码
+var ErrAlreadySetUp = errors.New("master password is already set")
+
+// Setup 为尚未设置主密码的账户（例如SSO自动创建的账户）生成保险库密钥和恢复密钥。
+// 返回已解锁的保险库密钥和只显示一次的恢复密钥
+func Setup(userID int, password string) ([]byte, string, error) {
+	passwordHash, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, wrapped, err := NewVaultKey(password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	recoveryKey, recoveryWrapped, err := NewRecoveryKey(key)
+	if err != nil {
+		crypto.Wipe(key)
+		return nil, "", err
+	}
+
+	// 以空密码哈希为条件更新，并发设置时只有一次成功
+	result, err := database.DB.Exec(`
+		UPDATE users SET password_hash = ?, kdf_salt = ?, kdf_params = ?, vault_key = ?, vault_key_id = ?, recovery_key = ?, vault_format = ?, updated_at = ?
+		WHERE id = ? AND password_hash = ''`,
+		passwordHash, wrapped.Salt, wrapped.Params, wrapped.VaultKey, wrapped.KeyID, recoveryWrapped, CurrentFormat, time.Now(), userID,
+	)
+	if err != nil {
+		crypto.Wipe(key)
+		return nil, "", err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		crypto.Wipe(key)
+		return nil, "", ErrAlreadySetUp
+	}
+
+	if err := EnsureKeyPair(userID, key); err != nil {
+		crypto.Wipe(key)
+		return nil, "", err
+	}
+	return key, recoveryKey, nil
+}
+
+// CheckKey 确认缓存的保险库密钥仍是用户当前的密钥。
+// 其他进程（例如管理命令）轮换密钥后，本进程缓存的旧密钥不会被清除，继续用它写入的数据将无法再解密
+func CheckKey(userID int, key []byte) error {
+	var keyID sql.NullString
+	if err := database.DB.QueryRow("SELECT vault_key_id FROM users WHERE id = ?", userID).Scan(&keyID); err != nil {
+		return err
+	}
+	if keyID.String != "" && keyID.String != crypto.KeyID(key) {
+		return ErrStaleKey
+	}
+	return nil
+}
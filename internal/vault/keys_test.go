@@ -0,0 +1,181 @@
+package vault
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// createLegacyUser 创建旧版本的用户：没有保险库密钥，只有密码列由用户ID推导的密钥加密
+func createLegacyUser(t *testing.T, username string, passwords ...string) (int, []int) {
+	t.Helper()
+	passwordHash, _ := crypto.HashPassword(testPassword)
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password_hash, email) VALUES (?, ?, ?)",
+		username, passwordHash, username+"@example.test",
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	userID := int(id)
+
+	var entryIDs []int
+	for _, password := range passwords {
+		encrypted, err := crypto.Encrypt(password, LegacyKey(userID))
+		if err != nil {
+			t.Fatalf("Failed to encrypt legacy entry: %v", err)
+		}
+		result, err := database.DB.Exec(
+			"INSERT INTO passwords (user_id, title, username, password) VALUES (?, ?, ?, ?)",
+			userID, "title-"+password, "alice", encrypted,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert entry: %v", err)
+		}
+		entryID, _ := result.LastInsertId()
+		entryIDs = append(entryIDs, int(entryID))
+	}
+	return userID, entryIDs
+}
+
+// vaultState 返回用户的加密格式和是否已有保险库密钥
+func vaultState(t *testing.T, userID int) (int, bool) {
+	t.Helper()
+	var format int
+	var vaultKey sql.NullString
+	err := database.DB.QueryRow("SELECT vault_format, vault_key FROM users WHERE id = ?", userID).Scan(&format, &vaultKey)
+	if err != nil {
+		t.Fatalf("Failed to read user: %v", err)
+	}
+	return format, vaultKey.Valid && vaultKey.String != ""
+}
+
+func TestUnlockMigratesLegacyUser(t *testing.T) {
+	testDB(t)
+	userID, entryIDs := createLegacyUser(t, "alice", "secret-1", "secret-2")
+
+	key, err := Unlock(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	format, hasKey := vaultState(t, userID)
+	if format != CurrentFormat || !hasKey {
+		t.Errorf("User should be migrated to format %d with a vault key, got format %d", CurrentFormat, format)
+	}
+	for i, id := range entryIDs {
+		p, err := readEntry(userID, id, key)
+		if err != nil {
+			t.Fatalf("Migrated entry %d should decrypt: %v", id, err)
+		}
+		if want := []string{"secret-1", "secret-2"}[i]; p.Password != want || p.Title != "title-"+want {
+			t.Errorf("Migrated entry %d has wrong content: %+v", id, p)
+		}
+	}
+
+	again, err := Unlock(userID, testPassword)
+	if err != nil || !bytes.Equal(again, key) {
+		t.Errorf("Second unlock should return the same key: %v", err)
+	}
+
+	// 旧账户没有恢复密钥，登录完成后补发一次
+	recoveryKey, err := EnsureRecoveryKey(userID, key)
+	if err != nil || recoveryKey == "" {
+		t.Fatalf("Migrated user should be issued a recovery key: %v", err)
+	}
+	recovered, err := UnlockWithRecoveryKey(userID, recoveryKey)
+	if err != nil || !bytes.Equal(recovered, key) {
+		t.Errorf("Recovery key should unlock the vault key: %v", err)
+	}
+	if again, err := EnsureRecoveryKey(userID, key); err != nil || again != "" {
+		t.Errorf("Recovery key should only be issued once, got %q: %v", again, err)
+	}
+}
+
+func TestUnlockLegacyUserWithCorruptEntry(t *testing.T) {
+	testDB(t)
+	userID, entryIDs := createLegacyUser(t, "alice", "secret-1", "secret-2", "secret-3")
+
+	otherKey, _ := crypto.GenerateRandomKey()
+	corrupt, _ := crypto.Encrypt("secret-2", otherKey)
+	database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", corrupt, entryIDs[1])
+	goodBefore := rawPassword(t, entryIDs[0])
+
+	_, err := Unlock(userID, testPassword)
+	var undecryptable *UndecryptableError
+	if !errors.As(err, &undecryptable) {
+		t.Fatalf("Expected UndecryptableError, got %v", err)
+	}
+	if !reflect.DeepEqual(undecryptable.EntryIDs, []int{entryIDs[1]}) {
+		t.Errorf("Error should list entry %d, got %v", entryIDs[1], undecryptable.EntryIDs)
+	}
+
+	// 迁移整体回滚，修复后可以重新迁移
+	if format, hasKey := vaultState(t, userID); format != FormatLegacy || hasKey {
+		t.Errorf("Failed migration should leave the user in legacy format, got format %d", format)
+	}
+	if rawPassword(t, entryIDs[0]) != goodBefore {
+		t.Error("Failed migration should not modify any entry")
+	}
+
+	fixed, _ := crypto.Encrypt("secret-2", LegacyKey(userID))
+	database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", fixed, entryIDs[1])
+
+	key, err := Unlock(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Unlock after repair failed: %v", err)
+	}
+	for _, id := range entryIDs {
+		if _, err := readEntry(userID, id, key); err != nil {
+			t.Errorf("Entry %d should decrypt after migration: %v", id, err)
+		}
+	}
+}
+
+func TestUnlockUpgradeFormatWithCorruptEntry(t *testing.T) {
+	testDB(t)
+	userID, key := createUser(t, "alice")
+	database.DB.Exec("UPDATE users SET vault_format = ? WHERE id = ?", FormatBound, userID)
+
+	// 格式2只有密码列是密文
+	var entryIDs []int
+	for _, password := range []string{"secret-1", "secret-2"} {
+		result, _ := database.DB.Exec("INSERT INTO passwords (user_id, title, password) VALUES (?, ?, '')", userID, "title-"+password)
+		id, _ := result.LastInsertId()
+		encrypted, _ := EncryptField(key, userID, int(id), "password", password)
+		database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", encrypted, id)
+		entryIDs = append(entryIDs, int(id))
+	}
+	corrupt, _ := EncryptField(key, userID, entryIDs[0], "password", "secret-2")
+	database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", corrupt, entryIDs[1])
+
+	_, err := Unlock(userID, testPassword)
+	var undecryptable *UndecryptableError
+	if !errors.As(err, &undecryptable) || !reflect.DeepEqual(undecryptable.EntryIDs, []int{entryIDs[1]}) {
+		t.Fatalf("Expected UndecryptableError for entry %d, got %v", entryIDs[1], err)
+	}
+	if format, _ := vaultState(t, userID); format != FormatBound {
+		t.Errorf("Failed upgrade should keep format %d, got %d", FormatBound, format)
+	}
+
+	fixed, _ := EncryptField(key, userID, entryIDs[1], "password", "secret-2")
+	database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", fixed, entryIDs[1])
+
+	if _, err := Unlock(userID, testPassword); err != nil {
+		t.Fatalf("Unlock after repair failed: %v", err)
+	}
+	if format, _ := vaultState(t, userID); format != CurrentFormat {
+		t.Errorf("User should be upgraded to format %d, got %d", CurrentFormat, format)
+	}
+	for _, id := range entryIDs {
+		if p, err := readEntry(userID, id, key); err != nil || p.Title == "" {
+			t.Errorf("Entry %d should decrypt in the current format: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package vault
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// ErrWrongRecoveryKey 恢复密钥无法解开保险库密钥
+var ErrWrongRecoveryKey = errors.New("invalid recovery key")
+
+// NewRecoveryKey 生成新的恢复密钥，并用它独立包装保险库密钥。恢复密钥只返回给用户一次
+func NewRecoveryKey(vaultKey []byte) (recoveryKey, wrapped string, err error) {
+	recoveryKey, err = crypto.GenerateRecoveryKey()
+	if err != nil {
+		return "", "", err
+	}
+
+	kek, err := crypto.DeriveRecoveryKEK(recoveryKey)
+	if err != nil {
+		return "", "", err
+	}
+	defer crypto.Wipe(kek)
+
+	wrapped, err = crypto.WrapKey(kek, vaultKey)
+	if err != nil {
+		return "", "", err
+	}
+	return recoveryKey, wrapped, nil
+}
+
+// RegenerateRecoveryKey 为已解锁的保险库生成新的恢复密钥，旧恢复密钥随即失效
+func RegenerateRecoveryKey(userID int, vaultKey []byte) (string, error) {
+	recoveryKey, wrapped, err := NewRecoveryKey(vaultKey)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := database.DB.Exec("UPDATE users SET recovery_key = ? WHERE id = ?", wrapped, userID); err != nil {
+		return "", err
+	}
+	return recoveryKey, nil
+}
+
+// EnsureRecoveryKey 为还没有恢复密钥的账户生成恢复密钥，已有时返回空字符串。
+// 从旧版本迁移的账户在迁移时没有机会展示恢复密钥，由登录流程在认证完成后补发
+func EnsureRecoveryKey(userID int, vaultKey []byte) (string, error) {
+	var existing sql.NullString
+	if err := database.DB.QueryRow("SELECT recovery_key FROM users WHERE id = ?", userID).Scan(&existing); err != nil {
+		return "", err
+	}
+	if existing.String != "" {
+		return "", nil
+	}
+
+	recoveryKey, wrapped, err := NewRecoveryKey(vaultKey)
+	if err != nil {
+		return "", err
+	}
+
+	// 并发登录时只有一次生效
+	result, err := database.DB.Exec(
+		"UPDATE users SET recovery_key = ? WHERE id = ? AND (recovery_key IS NULL OR recovery_key = '')", wrapped, userID,
+	)
+	if err != nil {
+		return "", err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return "", nil
+	}
+	return recoveryKey, nil
+}
+
+// UnlockWithRecoveryKey 使用恢复密钥解开保险库密钥
+func UnlockWithRecoveryKey(userID int, recoveryKey string) ([]byte, error) {
+	var wrapped sql.NullString
+	err := database.DB.QueryRow("SELECT recovery_key FROM users WHERE id = ?", userID).Scan(&wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if !wrapped.Valid || wrapped.String == "" {
+		return nil, ErrWrongRecoveryKey
+	}
+
+	kek, err := crypto.DeriveRecoveryKEK(recoveryKey)
+	if err != nil {
+		return nil, ErrWrongRecoveryKey
+	}
+	defer crypto.Wipe(kek)
+
+	key, err := crypto.UnwrapKey(kek, wrapped.String)
+	if err != nil {
+		return nil, ErrWrongRecoveryKey
+	}
+	return key, nil
+}
+
+// ResetPassword 使用恢复密钥重置登录密码。
+// 保险库密钥被重新包装到新密码下，条目密文保持不变。
+func ResetPassword(userID int, recoveryKey, newPassword string) error {
+	key, err := UnlockWithRecoveryKey(userID, recoveryKey)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(key)
+
+	wrapped, err := WrapWithPassword(key, newPassword)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET password_hash = ?, kdf_salt = ?, kdf_params = ?, vault_key = ?, updated_at = ? WHERE id = ?",
+		passwordHash, wrapped.Salt, wrapped.Params, wrapped.VaultKey, time.Now(), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	// 使用旧密码建立的会话全部失效
+	ForgetUser(userID)
+	return nil
+}
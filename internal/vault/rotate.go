@@ -0,0 +1,142 @@
+package vault
+
+import (
+	"database/sql"
+	"log"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+)
+
+// RotationResult 密钥轮换结果
+type RotationResult struct {
+	Generation  int    `json:"key_generation"`
+	Reencrypted int    `json:"reencrypted"`
+	Resumed     bool   `json:"resumed"`
+	RecoveryKey string `json:"recovery_key"`
+}
+
+// Rotate 为用户生成新的保险库密钥，并在一个事务中重新加密 passwords 表中的所有条目、历史密码和附件密钥。
+// 新密钥在重新加密前先以旧密钥包装后写入 users.pending_vault_key，
+// 因此进程在事务提交前崩溃时，下一次轮换会继续使用同一个新密钥，而不是再生成一个。
+// 旧的恢复密钥包装的是旧密钥，轮换时会签发新的恢复密钥。
+func Rotate(userID int, password string) ([]byte, *RotationResult, error) {
+	var salt, params, vaultKey, pending sql.NullString
+	var generation, format int
+	err := database.DB.QueryRow(
+		"SELECT kdf_salt, kdf_params, vault_key, pending_vault_key, key_generation, vault_format FROM users WHERE id = ?",
+		userID,
+	).Scan(&salt, &params, &vaultKey, &pending, &generation, &format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !vaultKey.Valid || vaultKey.String == "" {
+		// 旧账户先完成迁移，再进行轮换
+		key, err := migrateLegacy(userID, password)
+		if err != nil {
+			return nil, nil, err
+		}
+		crypto.Wipe(key)
+		return Rotate(userID, password)
+	}
+
+	wrapped := &WrappedKey{Salt: salt.String, Params: params.String, VaultKey: vaultKey.String}
+	oldKey, err := wrapped.Unwrap(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer crypto.Wipe(oldKey)
+
+	result := &RotationResult{Generation: generation + 1}
+
+	var newKey []byte
+	if pending.Valid && pending.String != "" {
+		newKey, err = crypto.UnwrapKey(oldKey, pending.String)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Resumed = true
+		log.Printf("Resuming interrupted key rotation of user %d", userID)
+	} else {
+		newKey, err = crypto.GenerateRandomKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		pendingKey, err := crypto.WrapKey(oldKey, newKey)
+		if err != nil {
+			crypto.Wipe(newKey)
+			return nil, nil, err
+		}
+		if _, err := database.DB.Exec("UPDATE users SET pending_vault_key = ? WHERE id = ?", pendingKey, userID); err != nil {
+			crypto.Wipe(newKey)
+			return nil, nil, err
+		}
+	}
+
+	newWrapped, err := WrapWithPassword(newKey, password)
+	if err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+
+	var recoveryWrapped string
+	result.RecoveryKey, recoveryWrapped, err = NewRecoveryKey(newKey)
+	if err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	result.Reencrypted, err = upgradeEntries(tx, userID, format, oldKey, newKey)
+	if err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+
+	// 私钥、附件密钥和紧急访问共享都依赖保险库密钥，随同轮换
+	if err := rewrapPrivateKey(tx, userID, oldKey, newKey); err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+	if err := rewrapAttachments(tx, userID, oldKey, newKey); err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+	if err := reencryptPasswordHistory(tx, userID, oldKey, newKey); err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+	if err := reshareEmergencyAccess(tx, userID, newKey); err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET kdf_salt = ?, kdf_params = ?, vault_key = ?, vault_key_id = ?, recovery_key = ?, pending_vault_key = NULL,
+			key_generation = ?, vault_format = ?
+		WHERE id = ?`,
+		newWrapped.Salt, newWrapped.Params, newWrapped.VaultKey, newWrapped.KeyID, recoveryWrapped, result.Generation, CurrentFormat, userID,
+	)
+	if err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		crypto.Wipe(newKey)
+		return nil, nil, err
+	}
+
+	// 其他会话缓存的旧密钥已失效
+	ForgetUser(userID)
+
+	log.Printf("Rotated vault key of user %d to generation %d, %d entries re-encrypted", userID, result.Generation, result.Reencrypted)
+	return newKey, result, nil
+}
@@ -0,0 +1,278 @@
+package vault
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopass/internal/crypto"
+	"gopass/internal/database"
+	"gopass/internal/models"
+)
+
+const testPassword = "Passw0rd!Strong"
+
+// testDB 初始化临时的 SQLite 数据库，并降低 Argon2id 参数以加快测试
+func testDB(t *testing.T) {
+	t.Helper()
+	if err := database.InitDB(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	params := crypto.DefaultKDFParams
+	crypto.DefaultKDFParams = crypto.KDFParams{Time: 1, Memory: 1024, Threads: 1}
+	t.Cleanup(func() {
+		crypto.DefaultKDFParams = params
+		database.CloseDB()
+	})
+}
+
+// createUser 创建使用当前格式保险库密钥的用户，返回用户ID和保险库密钥
+func createUser(t *testing.T, username string) (int, []byte) {
+	t.Helper()
+	key, wrapped, err := NewVaultKey(testPassword)
+	if err != nil {
+		t.Fatalf("Failed to create vault key: %v", err)
+	}
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password_hash, email, kdf_salt, kdf_params, vault_key, vault_key_id, vault_format) VALUES (?, '', ?, ?, ?, ?, ?, ?)",
+		username, username+"@example.test", wrapped.Salt, wrapped.Params, wrapped.VaultKey, wrapped.KeyID, CurrentFormat,
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	if err := EnsureKeyPair(int(id), key); err != nil {
+		t.Fatalf("Failed to create key pair: %v", err)
+	}
+	return int(id), key
+}
+
+// addEntry 添加一个由 key 加密的条目
+func addEntry(t *testing.T, userID int, key []byte, p models.Password) int {
+	t.Helper()
+	result, err := database.DB.Exec("INSERT INTO passwords (user_id, title, password) VALUES (?, '', '')", userID)
+	if err != nil {
+		t.Fatalf("Failed to insert entry: %v", err)
+	}
+	id, _ := result.LastInsertId()
+
+	encrypted, err := EncryptEntry(key, userID, int(id), p)
+	if err != nil {
+		t.Fatalf("Failed to encrypt entry: %v", err)
+	}
+	_, err = database.DB.Exec(
+		"UPDATE passwords SET title = ?, website = ?, username = ?, password = ?, notes = ? WHERE id = ?",
+		encrypted.Title, encrypted.Website, encrypted.Username, encrypted.Password, encrypted.Notes, id,
+	)
+	if err != nil {
+		t.Fatalf("Failed to store entry: %v", err)
+	}
+	return int(id)
+}
+
+// addHistory 为条目添加一条由 key 加密的历史密码
+func addHistory(t *testing.T, userID, entryID int, key []byte, password string) {
+	t.Helper()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := AddPasswordHistory(tx, key, userID, entryID, password, time.Now(), 10); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit history: %v", err)
+	}
+}
+
+// readEntry 读取并用 key 解密条目
+func readEntry(userID, entryID int, key []byte) (models.Password, error) {
+	p := models.Password{ID: entryID}
+	var website, username, notes sql.NullString
+	err := database.DB.QueryRow(
+		"SELECT title, website, username, password, notes, totp_secret, payload, custom_fields FROM passwords WHERE id = ?", entryID,
+	).Scan(&p.Title, &website, &username, &p.Password, &notes, &p.TOTPSecret, &p.Payload, &p.FieldsData)
+	if err != nil {
+		return p, err
+	}
+	p.Website, p.Username, p.Notes = website.String, username.String, notes.String
+	return p, DecryptEntry(key, userID, &p)
+}
+
+// rawPassword 返回条目密码列的原始密文
+func rawPassword(t *testing.T, entryID int) string {
+	t.Helper()
+	var ciphertext string
+	if err := database.DB.QueryRow("SELECT password FROM passwords WHERE id = ?", entryID).Scan(&ciphertext); err != nil {
+		t.Fatalf("Failed to read entry: %v", err)
+	}
+	return ciphertext
+}
+
+// storedKey 用主密码解开 users 表中当前的保险库密钥
+func storedKey(t *testing.T, userID int) []byte {
+	t.Helper()
+	key, err := Unlock(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Failed to unlock vault: %v", err)
+	}
+	return key
+}
+
+func TestRotate(t *testing.T) {
+	testDB(t)
+	userID, oldKey := createUser(t, "alice")
+	entryID := addEntry(t, userID, oldKey, models.Password{Title: "Mail", Username: "alice", Password: "secret-1"})
+	addHistory(t, userID, entryID, oldKey, "secret-0")
+
+	newKey, result, err := Rotate(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if result.Generation != 2 || result.Reencrypted != 1 || result.Resumed {
+		t.Errorf("Unexpected rotation result: %+v", result)
+	}
+	if bytes.Equal(newKey, oldKey) {
+		t.Fatal("Rotation should generate a new key")
+	}
+	if !bytes.Equal(storedKey(t, userID), newKey) {
+		t.Error("Master password should unwrap the new key")
+	}
+
+	p, err := readEntry(userID, entryID, newKey)
+	if err != nil || p.Title != "Mail" || p.Password != "secret-1" {
+		t.Errorf("Entry should decrypt with the new key, got %+v: %v", p, err)
+	}
+	if _, err := readEntry(userID, entryID, oldKey); err == nil {
+		t.Error("Entry should no longer decrypt with the old key")
+	}
+	if err := CheckKey(userID, oldKey); err != ErrStaleKey {
+		t.Errorf("Old key should be rejected as stale, got %v", err)
+	}
+	if err := CheckKey(userID, newKey); err != nil {
+		t.Errorf("New key should be accepted: %v", err)
+	}
+
+	history, err := PasswordHistory(newKey, userID, entryID, 10)
+	if err != nil || len(history) != 1 || history[0].Password != "secret-0" {
+		t.Errorf("Password history should decrypt with the new key, got %+v: %v", history, err)
+	}
+	if _, err := PrivateKey(userID, newKey); err != nil {
+		t.Errorf("Private key should be rewrapped: %v", err)
+	}
+	if _, err := UnlockWithRecoveryKey(userID, result.RecoveryKey); err != nil {
+		t.Errorf("New recovery key should unlock the vault: %v", err)
+	}
+
+	// 再次轮换不受上一次轮换影响
+	newerKey, result, err := Rotate(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Second rotation failed: %v", err)
+	}
+	if result.Generation != 3 {
+		t.Errorf("Generation should be 3, got %d", result.Generation)
+	}
+	if p, err := readEntry(userID, entryID, newerKey); err != nil || p.Password != "secret-1" {
+		t.Errorf("Entry should decrypt after the second rotation: %v", err)
+	}
+}
+
+func TestRotateResume(t *testing.T) {
+	testDB(t)
+	userID, oldKey := createUser(t, "alice")
+	entryID := addEntry(t, userID, oldKey, models.Password{Title: "Mail", Password: "secret-1"})
+
+	// 模拟上一次轮换写入待用密钥后、事务提交前进程崩溃
+	pendingKey, _ := crypto.GenerateRandomKey()
+	wrapped, err := crypto.WrapKey(oldKey, pendingKey)
+	if err != nil {
+		t.Fatalf("Failed to wrap pending key: %v", err)
+	}
+	if _, err := database.DB.Exec("UPDATE users SET pending_vault_key = ? WHERE id = ?", wrapped, userID); err != nil {
+		t.Fatalf("Failed to store pending key: %v", err)
+	}
+
+	newKey, result, err := Rotate(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if !result.Resumed || !bytes.Equal(newKey, pendingKey) {
+		t.Errorf("Rotation should resume with the pending key, got %+v", result)
+	}
+	if p, err := readEntry(userID, entryID, pendingKey); err != nil || p.Password != "secret-1" {
+		t.Errorf("Entry should decrypt with the pending key: %v", err)
+	}
+
+	var pending sql.NullString
+	database.DB.QueryRow("SELECT pending_vault_key FROM users WHERE id = ?", userID).Scan(&pending)
+	if pending.Valid {
+		t.Error("Pending key should be cleared after rotation")
+	}
+}
+
+func TestRotateAbortsOnCorruptEntry(t *testing.T) {
+	testDB(t)
+	userID, oldKey := createUser(t, "alice")
+	goodID := addEntry(t, userID, oldKey, models.Password{Title: "Mail", Password: "secret-1"})
+	badID := addEntry(t, userID, oldKey, models.Password{Title: "Bank", Password: "secret-2"})
+
+	otherKey, _ := crypto.GenerateRandomKey()
+	corrupt, _ := EncryptField(otherKey, userID, badID, "password", "secret-2")
+	if _, err := database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", corrupt, badID); err != nil {
+		t.Fatalf("Failed to corrupt entry: %v", err)
+	}
+	goodBefore := rawPassword(t, goodID)
+
+	if _, _, err := Rotate(userID, testPassword); err == nil {
+		t.Fatal("Rotation should fail when an entry cannot be decrypted")
+	}
+
+	if !bytes.Equal(storedKey(t, userID), oldKey) {
+		t.Error("Failed rotation should keep the old vault key")
+	}
+	if rawPassword(t, goodID) != goodBefore {
+		t.Error("Failed rotation should not modify any entry")
+	}
+	if rawPassword(t, badID) != corrupt {
+		t.Error("Failed rotation should leave the corrupt entry untouched")
+	}
+
+	// 修复数据后重新执行，继续使用同一个待用密钥
+	fixed, _ := EncryptField(oldKey, userID, badID, "password", "secret-2")
+	database.DB.Exec("UPDATE passwords SET password = ? WHERE id = ?", fixed, badID)
+
+	newKey, result, err := Rotate(userID, testPassword)
+	if err != nil {
+		t.Fatalf("Rotation after repair failed: %v", err)
+	}
+	if !result.Resumed || result.Reencrypted != 2 {
+		t.Errorf("Unexpected rotation result: %+v", result)
+	}
+	for _, id := range []int{goodID, badID} {
+		if _, err := readEntry(userID, id, newKey); err != nil {
+			t.Errorf("Entry %d should decrypt with the new key: %v", id, err)
+		}
+	}
+}
+
+func TestRotateAbortsOnCorruptHistory(t *testing.T) {
+	testDB(t)
+	userID, oldKey := createUser(t, "alice")
+	entryID := addEntry(t, userID, oldKey, models.Password{Title: "Mail", Password: "secret-1"})
+
+	otherKey, _ := crypto.GenerateRandomKey()
+	addHistory(t, userID, entryID, otherKey, "secret-0")
+
+	if _, _, err := Rotate(userID, testPassword); err == nil {
+		t.Fatal("Rotation should fail when password history cannot be decrypted")
+	}
+	if !bytes.Equal(storedKey(t, userID), oldKey) {
+		t.Error("Failed rotation should keep the old vault key")
+	}
+	if _, err := readEntry(userID, entryID, oldKey); err != nil {
+		t.Errorf("Entry should still decrypt with the old key: %v", err)
+	}
+}
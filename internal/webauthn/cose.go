@@ -0,0 +1,129 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE 算法标识（RFC 9053），注册时按此顺序向验证器声明
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE 密钥参数（RFC 9052 7.1）
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // EC2/OKP 的曲线；RSA 中同一标签为模数 n
+	coseX   = -2 // EC2/OKP 的 x；RSA 中为指数 e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey 从COSE编码中解析出的凭据公钥
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey 解析COSE_Key，支持 ES256（P-256）、EdDSA（Ed25519）和 RS256
+func parsePublicKey(data []byte) (*publicKey, error) {
+	var params map[int64]interface{}
+	if err := cbor.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("%w: malformed COSE key: %v", ErrInvalidResponse, err)
+	}
+
+	kty, _ := coseInt(params[coseKty])
+	alg, _ := coseInt(params[coseAlg])
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := coseInt(params[coseCrv])
+		x, _ := params[coseX].([]byte)
+		y, _ := params[coseY].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid P-256 key", ErrUnsupported)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: point is not on curve", ErrInvalidResponse)
+		}
+		return &publicKey{alg: alg, key: key}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := coseInt(params[coseCrv])
+		x, _ := params[coseX].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 key", ErrUnsupported)
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := params[coseCrv].([]byte)
+		e, _ := params[coseX].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: invalid RSA key", ErrUnsupported)
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	default:
+		return nil, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupported, kty, alg)
+	}
+}
+
+// verify 校验签名
+func (k *publicKey) verify(data, signature []byte) error {
+	return verifySignature(k.alg, k.key, data, signature)
+}
+
+// verifySignature 按COSE算法校验签名，也用于校验证书中的公钥
+func verifySignature(alg int64, key crypto.PublicKey, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch alg {
+	case AlgES256:
+		if pub, ok := key.(*ecdsa.PublicKey); ok && ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return nil
+		}
+	case AlgEdDSA:
+		if pub, ok := key.(ed25519.PublicKey); ok && ed25519.Verify(pub, data, signature) {
+			return nil
+		}
+	case AlgRS256:
+		if pub, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: algorithm %d", ErrUnsupported, alg)
+	}
+	return errors.New("signature verification failed")
+}
+
+// coseInt 读取CBOR整数，正数解码为 uint64，负数为 int64
+func coseInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		if n > 1<<62 {
+			return 0, false
+		}
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
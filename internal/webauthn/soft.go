@@ -0,0 +1,218 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SoftAuthenticator 测试和本地调试使用的软件验证器，按浏览器和验证器的行为生成注册与认证响应。
+// 私钥只保存在内存中，不提供任何真实硬件的保护
+type SoftAuthenticator struct {
+	// Origin 写入客户端数据的页面来源
+	Origin string
+	// Algorithm 新凭据使用的算法，支持 AlgES256（默认）和 AlgEdDSA
+	Algorithm int
+	// Format 注册响应的证明格式，"none"（默认）或 "packed"（自证明）
+	Format string
+
+	mu          sync.Mutex
+	credentials map[string]*softCredential
+}
+
+// softCredential 软件验证器中保存的凭据
+type softCredential struct {
+	id        []byte
+	rpID      string
+	alg       int
+	key       interface{}
+	signCount uint32
+}
+
+// softAAGUID 软件验证器的型号标识
+var softAAGUID = []byte("gopass-soft-auth")
+
+// NewSoftAuthenticator 创建在 origin 页面中使用的软件验证器
+func NewSoftAuthenticator(origin string) *SoftAuthenticator {
+	return &SoftAuthenticator{Origin: origin, credentials: make(map[string]*softCredential)}
+}
+
+// Clone 复制验证器及其私钥和计数，用于模拟被克隆的验证器
+func (s *SoftAuthenticator) Clone() *SoftAuthenticator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clone := &SoftAuthenticator{Origin: s.Origin, Algorithm: s.Algorithm, Format: s.Format, credentials: make(map[string]*softCredential)}
+	for id, credential := range s.credentials {
+		copied := *credential
+		clone.credentials[id] = &copied
+	}
+	return clone
+}
+
+// Register 按注册选项创建新凭据。选项中排除的凭据已在本验证器中时返回错误
+func (s *SoftAuthenticator) Register(options CreationOptions) (*RegistrationResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, excluded := range options.ExcludeCredentials {
+		if _, ok := s.credentials[excluded.ID]; ok {
+			return nil, errors.New("authenticator is already registered")
+		}
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	credential := &softCredential{id: id, rpID: options.RP.ID, alg: s.Algorithm}
+	if credential.alg == 0 {
+		credential.alg = AlgES256
+	}
+
+	var coseKey []byte
+	switch credential.alg {
+	case AlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		credential.key = key
+		coseKey, err = cbor.Marshal(map[int]interface{}{
+			coseKty: ktyEC2, coseAlg: AlgES256, coseCrv: crvP256,
+			coseX: key.X.FillBytes(make([]byte, 32)), coseY: key.Y.FillBytes(make([]byte, 32)),
+		})
+		if err != nil {
+			return nil, err
+		}
+	case AlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		credential.key = private
+		coseKey, err = cbor.Marshal(map[int]interface{}{
+			coseKty: ktyOKP, coseAlg: AlgEdDSA, coseCrv: crvEd25519, coseX: []byte(public),
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+
+	clientDataJSON, err := s.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := authenticatorDataFor(credential.rpID, flagUserPresent|flagUserVerified|flagAttested, credential.signCount)
+	authData = append(authData, softAAGUID...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, coseKey...)
+
+	format := s.Format
+	if format == "" {
+		format = "none"
+	}
+	statement := map[string]interface{}{}
+	if format == "packed" {
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		signature, err := credential.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+		if err != nil {
+			return nil, err
+		}
+		statement = map[string]interface{}{"alg": credential.alg, "sig": signature}
+	}
+	attestation, err := cbor.Marshal(map[string]interface{}{"fmt": format, "attStmt": statement, "authData": authData})
+	if err != nil {
+		return nil, err
+	}
+
+	s.credentials[Encode(id)] = credential
+
+	response := &RegistrationResponse{ID: Encode(id), RawID: Encode(id), Type: "public-key"}
+	response.Response.ClientDataJSON = Encode(clientDataJSON)
+	response.Response.AttestationObject = Encode(attestation)
+	response.Response.Transports = []string{"internal"}
+	return response, nil
+}
+
+// Assert 用认证选项允许的第一个已知凭据签名，签名计数加一
+func (s *SoftAuthenticator) Assert(options RequestOptions) (*AssertionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var credential *softCredential
+	for _, allowed := range options.AllowCredentials {
+		if c, ok := s.credentials[allowed.ID]; ok && c.rpID == options.RPID {
+			credential = c
+			break
+		}
+	}
+	if credential == nil {
+		return nil, errors.New("no matching credential on this authenticator")
+	}
+
+	clientDataJSON, err := s.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.signCount++
+	authData := authenticatorDataFor(credential.rpID, flagUserPresent|flagUserVerified, credential.signCount)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature, err := credential.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AssertionResponse{ID: Encode(credential.id), RawID: Encode(credential.id), Type: "public-key"}
+	response.Response.ClientDataJSON = Encode(clientDataJSON)
+	response.Response.AuthenticatorData = Encode(authData)
+	response.Response.Signature = Encode(signature)
+	return response, nil
+}
+
+// clientData 生成浏览器的客户端数据
+func (s *SoftAuthenticator) clientData(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: s.Origin})
+}
+
+// sign 按凭据算法签名
+func (c *softCredential) sign(data []byte) ([]byte, error) {
+	switch key := c.key.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.SignASN1(rand.Reader, key, digest[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, data), nil
+	default:
+		return nil, errors.New("unsupported key")
+	}
+}
+
+// authenticatorDataFor 生成不含凭据数据的验证器数据头
+func authenticatorDataFor(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func randomID() ([]byte, error) {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
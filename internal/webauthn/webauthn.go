@@ -0,0 +1,432 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopass/internal/crypto"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// WebAuthn 依赖方（W3C Web Authentication Level 2）。
+// 只使用 "none" 证明偏好，不校验验证器厂商的证书链；安全性来自注册时绑定的公钥和每次登录的挑战签名。
+// 请求和响应中的二进制字段都使用无填充的 base64url，由前端与 ArrayBuffer 互相转换。
+
+var (
+	// ErrInvalidResponse 验证器响应格式错误或与挑战、来源、依赖方不匹配
+	ErrInvalidResponse = errors.New("invalid webauthn response")
+	// ErrUnsupported 不支持的密钥算法或证明格式
+	ErrUnsupported = errors.New("unsupported webauthn credential")
+	// ErrSignCount 签名计数没有增加，验证器可能被克隆
+	ErrSignCount = errors.New("authenticator signature counter did not increase")
+)
+
+// authenticatorData 中的标志位
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+// Timeout 浏览器等待用户操作验证器的时限（毫秒）
+const Timeout = 120000
+
+// RelyingParty 依赖方配置。ID 为站点域名，Origins 为允许发起仪式的页面来源
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Credential 注册成功后保存的凭据
+type Credential struct {
+	ID         []byte
+	PublicKey  []byte // COSE_Key
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+}
+
+// CredentialDescriptor 选项中引用已注册凭据
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CredentialParameter 可接受的凭据类型和算法
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CreationOptions navigator.credentials.create 的 publicKey 选项
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions navigator.credentials.get 的 publicKey 选项
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse 注册仪式中浏览器返回的 PublicKeyCredential
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse 认证仪式中浏览器返回的 PublicKeyCredential
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// NewChallenge 生成一次性挑战
+func NewChallenge() (string, error) {
+	raw, err := crypto.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return Encode(raw), nil
+}
+
+// Encode 无填充 base64url 编码
+func Encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode 解码 base64url，兼容带填充的输入
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Descriptor 返回引用该凭据的描述
+func (c *Credential) Descriptor() CredentialDescriptor {
+	return CredentialDescriptor{Type: "public-key", ID: Encode(c.ID), Transports: c.Transports}
+}
+
+// CreationOptions 生成注册选项。userHandle 是不含个人信息的随机标识，exclude 为已注册的凭据，避免重复注册同一验证器
+func (rp *RelyingParty) CreationOptions(challenge string, userHandle []byte, username string, exclude []CredentialDescriptor) CreationOptions {
+	var options CreationOptions
+	options.Challenge = challenge
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	options.User.ID = Encode(userHandle)
+	options.User.Name = username
+	options.User.DisplayName = username
+	options.PubKeyCredParams = []CredentialParameter{
+		{Type: "public-key", Alg: AlgES256},
+		{Type: "public-key", Alg: AlgEdDSA},
+		{Type: "public-key", Alg: AlgRS256},
+	}
+	options.Timeout = Timeout
+	options.ExcludeCredentials = exclude
+	if options.ExcludeCredentials == nil {
+		options.ExcludeCredentials = []CredentialDescriptor{}
+	}
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = "preferred"
+	options.Attestation = "none"
+	return options
+}
+
+// RequestOptions 生成认证选项，allow 为用户已注册的凭据
+func (rp *RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: "preferred",
+	}
+}
+
+// clientData 浏览器生成并由验证器签名的客户端数据
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData 校验仪式类型、挑战和来源，返回客户端数据的哈希
+func (rp *RelyingParty) verifyClientData(encoded, ceremony, challenge string) ([]byte, error) {
+	raw, err := Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed clientDataJSON", ErrInvalidResponse)
+	}
+
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("%w: malformed clientDataJSON", ErrInvalidResponse)
+	}
+	if data.Type != ceremony {
+		return nil, fmt.Errorf("%w: unexpected type %q", ErrInvalidResponse, data.Type)
+	}
+	if challenge == "" || strings.TrimRight(data.Challenge, "=") != strings.TrimRight(challenge, "=") {
+		return nil, fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if data.CrossOrigin || !rp.allowedOrigin(data.Origin) {
+		return nil, fmt.Errorf("%w: origin %q is not allowed", ErrInvalidResponse, data.Origin)
+	}
+
+	hash := sha256.Sum256(raw)
+	return hash[:], nil
+}
+
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticatorData 解析后的验证器数据
+type authenticatorData struct {
+	raw          []byte
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData 解析验证器数据，并校验依赖方ID哈希和用户在场标志
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	data := &authenticatorData{
+		raw:       raw,
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	expected := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, expected[:]) {
+		return nil, fmt.Errorf("%w: relying party ID mismatch", ErrInvalidResponse)
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user was not present", ErrInvalidResponse)
+	}
+
+	if data.flags&flagAttested != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		data.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("%w: invalid credential ID length", ErrInvalidResponse)
+		}
+		data.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		var key cbor.RawMessage
+		remaining, err := cbor.UnmarshalFirst(rest, &key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed credential public key", ErrInvalidResponse)
+		}
+		data.publicKey = []byte(key)
+		rest = remaining
+
+		if data.flags&flagExtensions == 0 && len(rest) != 0 {
+			return nil, fmt.Errorf("%w: trailing bytes in authenticator data", ErrInvalidResponse)
+		}
+	}
+
+	return data, nil
+}
+
+// attestationObject 注册时验证器返回的证明对象
+type attestationObject struct {
+	Format    string          `cbor:"fmt"`
+	Statement cbor.RawMessage `cbor:"attStmt"`
+	AuthData  []byte          `cbor:"authData"`
+}
+
+// packedStatement packed 格式的证明声明（WebAuthn 8.2）
+type packedStatement struct {
+	Alg int64    `cbor:"alg"`
+	Sig []byte   `cbor:"sig"`
+	X5C [][]byte `cbor:"x5c"`
+}
+
+// VerifyRegistration 校验注册响应，返回要保存的凭据
+func (rp *RelyingParty) VerifyRegistration(challenge string, response *RegistrationResponse) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+
+	clientDataHash, err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := Decode(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestationObject", ErrInvalidResponse)
+	}
+	var attestation attestationObject
+	if err := cbor.Unmarshal(raw, &attestation); err != nil {
+		return nil, fmt.Errorf("%w: malformed attestationObject", ErrInvalidResponse)
+	}
+
+	data, err := rp.parseAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if data.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+	if rawID, err := Decode(response.RawID); err != nil || !bytes.Equal(rawID, data.credentialID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	key, err := parsePublicKey(data.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyAttestation(attestation, key, append(append([]byte{}, data.raw...), clientDataHash...)); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:         data.credentialID,
+		PublicKey:  data.publicKey,
+		SignCount:  data.signCount,
+		AAGUID:     data.aaguid,
+		Transports: response.Response.Transports,
+	}, nil
+}
+
+// verifyAttestation 校验证明声明。packed 格式只校验签名，不验证证书链是否可信
+func verifyAttestation(attestation attestationObject, key *publicKey, signed []byte) error {
+	switch attestation.Format {
+	case "none":
+		var statement map[string]interface{}
+		if err := cbor.Unmarshal(attestation.Statement, &statement); err != nil || len(statement) != 0 {
+			return fmt.Errorf("%w: none attestation must have an empty statement", ErrInvalidResponse)
+		}
+		return nil
+	case "packed":
+		var statement packedStatement
+		if err := cbor.Unmarshal(attestation.Statement, &statement); err != nil {
+			return fmt.Errorf("%w: malformed packed attestation", ErrInvalidResponse)
+		}
+		if len(statement.X5C) == 0 {
+			// 自证明：用凭据私钥本身签名
+			if statement.Alg != key.alg {
+				return fmt.Errorf("%w: attestation algorithm mismatch", ErrInvalidResponse)
+			}
+			if err := key.verify(signed, statement.Sig); err != nil {
+				return fmt.Errorf("%w: invalid attestation signature", ErrInvalidResponse)
+			}
+			return nil
+		}
+		cert, err := x509.ParseCertificate(statement.X5C[0])
+		if err != nil {
+			return fmt.Errorf("%w: malformed attestation certificate", ErrInvalidResponse)
+		}
+		if err := verifySignature(statement.Alg, cert.PublicKey, signed, statement.Sig); err != nil {
+			return fmt.Errorf("%w: invalid attestation signature", ErrInvalidResponse)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: attestation format %q", ErrUnsupported, attestation.Format)
+	}
+}
+
+// VerifyAssertion 用已保存的凭据校验认证响应，返回新的签名计数。
+// 计数没有增加时返回 ErrSignCount（两者都为0表示验证器不支持计数）
+func (rp *RelyingParty) VerifyAssertion(challenge string, credential *Credential, response *AssertionResponse) (uint32, error) {
+	if response.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+	if rawID, err := Decode(response.RawID); err != nil || !bytes.Equal(rawID, credential.ID) {
+		return 0, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	clientDataHash, err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := Decode(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed authenticatorData", ErrInvalidResponse)
+	}
+	data, err := rp.parseAuthenticatorData(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := Decode(response.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed signature", ErrInvalidResponse)
+	}
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := key.verify(append(append([]byte{}, raw...), clientDataHash...), signature); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	if (data.signCount != 0 || credential.SignCount != 0) && data.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+	return data.signCount, nil
+}
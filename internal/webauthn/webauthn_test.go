@@ -0,0 +1,192 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const testOrigin = "https://gopass.example.test"
+
+func testRelyingParty() *RelyingParty {
+	return &RelyingParty{ID: "gopass.example.test", Name: "GoPass", Origins: []string{testOrigin}}
+}
+
+// register 用软件验证器完成一次注册仪式
+func register(t *testing.T, rp *RelyingParty, authenticator *SoftAuthenticator) *Credential {
+	t.Helper()
+
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatalf("NewChallenge failed: %v", err)
+	}
+	response, err := authenticator.Register(rp.CreationOptions(challenge, []byte("user-handle"), "alice", nil))
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	credential, err := rp.VerifyRegistration(challenge, response)
+	if err != nil {
+		t.Fatalf("VerifyRegistration failed: %v", err)
+	}
+	return credential
+}
+
+// assert 用软件验证器完成一次认证仪式，返回新的签名计数
+func assert(rp *RelyingParty, authenticator *SoftAuthenticator, credential *Credential) (uint32, error) {
+	challenge, err := NewChallenge()
+	if err != nil {
+		return 0, err
+	}
+	response, err := authenticator.Assert(rp.RequestOptions(challenge, []CredentialDescriptor{credential.Descriptor()}))
+	if err != nil {
+		return 0, err
+	}
+	return rp.VerifyAssertion(challenge, credential, response)
+}
+
+func TestRegisterAndAssert(t *testing.T) {
+	rp := testRelyingParty()
+
+	cases := []struct {
+		name      string
+		algorithm int
+		format    string
+	}{
+		{"ES256 none", AlgES256, "none"},
+		{"ES256 packed", AlgES256, "packed"},
+		{"EdDSA none", AlgEdDSA, "none"},
+		{"EdDSA packed", AlgEdDSA, "packed"},
+	}
+	for _, tc := range cases {
+		authenticator := NewSoftAuthenticator(testOrigin)
+		authenticator.Algorithm = tc.algorithm
+		authenticator.Format = tc.format
+
+		credential := register(t, rp, authenticator)
+		if credential.SignCount != 0 || len(credential.AAGUID) != 16 {
+			t.Errorf("%s: unexpected credential %+v", tc.name, credential)
+		}
+
+		for want := uint32(1); want <= 2; want++ {
+			count, err := assert(rp, authenticator, credential)
+			if err != nil {
+				t.Fatalf("%s: VerifyAssertion failed: %v", tc.name, err)
+			}
+			if count != want {
+				t.Errorf("%s: expected sign count %d, got %d", tc.name, want, count)
+			}
+			credential.SignCount = count
+		}
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := NewSoftAuthenticator(testOrigin)
+
+	challenge, _ := NewChallenge()
+	response, err := authenticator.Register(rp.CreationOptions(challenge, []byte("user-handle"), "alice", nil))
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	other, _ := NewChallenge()
+	if _, err := rp.VerifyRegistration(other, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Wrong challenge should be rejected, got %v", err)
+	}
+
+	otherRP := &RelyingParty{ID: "evil.example.test", Origins: []string{testOrigin}}
+	if _, err := otherRP.VerifyRegistration(challenge, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Wrong relying party ID should be rejected, got %v", err)
+	}
+
+	phishing := NewSoftAuthenticator("https://gopass.example.test.evil")
+	response, _ = phishing.Register(rp.CreationOptions(challenge, []byte("user-handle"), "alice", nil))
+	if _, err := rp.VerifyRegistration(challenge, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Wrong origin should be rejected, got %v", err)
+	}
+}
+
+func TestRegistrationExcludesKnownCredential(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := NewSoftAuthenticator(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	challenge, _ := NewChallenge()
+	options := rp.CreationOptions(challenge, []byte("user-handle"), "alice", []CredentialDescriptor{credential.Descriptor()})
+	if _, err := authenticator.Register(options); err == nil {
+		t.Error("Authenticator should refuse to register twice")
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := NewSoftAuthenticator(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	// 另一个验证器的凭据不能冒充
+	other := NewSoftAuthenticator(testOrigin)
+	otherCredential := register(t, rp, other)
+	challenge, _ := NewChallenge()
+	response, _ := other.Assert(rp.RequestOptions(challenge, []CredentialDescriptor{otherCredential.Descriptor()}))
+	if _, err := rp.VerifyAssertion(challenge, credential, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Assertion from another credential should be rejected, got %v", err)
+	}
+
+	// 重放旧响应时挑战不匹配
+	challenge, _ = NewChallenge()
+	response, _ = authenticator.Assert(rp.RequestOptions(challenge, []CredentialDescriptor{credential.Descriptor()}))
+	if _, err := rp.VerifyAssertion(challenge, credential, response); err != nil {
+		t.Fatalf("VerifyAssertion failed: %v", err)
+	}
+	next, _ := NewChallenge()
+	if _, err := rp.VerifyAssertion(next, credential, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Replayed assertion should be rejected, got %v", err)
+	}
+
+	// 篡改签名
+	challenge, _ = NewChallenge()
+	response, _ = authenticator.Assert(rp.RequestOptions(challenge, []CredentialDescriptor{credential.Descriptor()}))
+	signature, _ := Decode(response.Response.Signature)
+	signature[len(signature)-1] ^= 0xff
+	response.Response.Signature = Encode(signature)
+	if _, err := rp.VerifyAssertion(challenge, credential, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Tampered signature should be rejected, got %v", err)
+	}
+
+	// 注册仪式的客户端数据不能用于登录
+	challenge, _ = NewChallenge()
+	response, _ = authenticator.Assert(rp.RequestOptions(challenge, []CredentialDescriptor{credential.Descriptor()}))
+	clientDataJSON, _ := json.Marshal(clientData{Type: "webauthn.create", Challenge: challenge, Origin: testOrigin})
+	response.Response.ClientDataJSON = Encode(clientDataJSON)
+	if _, err := rp.VerifyAssertion(challenge, credential, response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Wrong ceremony type should be rejected, got %v", err)
+	}
+}
+
+func TestSignCountDetectsClone(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := NewSoftAuthenticator(testOrigin)
+	credential := register(t, rp, authenticator)
+	clone := authenticator.Clone()
+
+	count, err := assert(rp, authenticator, credential)
+	if err != nil {
+		t.Fatalf("VerifyAssertion failed: %v", err)
+	}
+	credential.SignCount = count
+
+	// 克隆的计数落后于服务器记录
+	if _, err := assert(rp, clone, credential); !errors.Is(err, ErrSignCount) {
+		t.Errorf("Cloned authenticator should be detected, got %v", err)
+	}
+}
+
+func TestParsePublicKeyRejectsUnsupported(t *testing.T) {
+	if _, err := parsePublicKey([]byte{0xa1, 0x01, 0x02}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Incomplete EC2 key should be unsupported, got %v", err)
+	}
+	if _, err := parsePublicKey([]byte("not cbor")); err == nil {
+		t.Error("Malformed key should be rejected")
+	}
+}
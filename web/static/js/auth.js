@@ -1,9 +1,20 @@
+// 两步验证票据，密码验证通过后由服务器返回
+let mfaToken = null;
+// 安全密钥认证选项，用户注册了安全密钥时随票据返回
+let webauthnOptions = null;
+// 单点登录票据，身份提供者回调后放在URL片段中
+let ssoToken = null;
+// 单点登录首次设置主密码后，关闭恢复密钥面板时要继续的登录结果
+let pendingLogin = null;
+// 密码重置令牌，来自邮件中链接的URL片段
+let resetToken = null;
+
 // 检查是否已登录
 function checkAuth() {
     const token = localStorage.getItem('token');
     if (token) {
-        // 如果在登录页面且已有token，跳转到仪表板
-        if (window.location.pathname === '/') {
+        // 如果在登录页面且已有token，跳转到仪表板；打开邮件中的链接时先处理链接
+        if (window.location.pathname === '/' && !/verify_email=|reset_token=/.test(window.location.hash)) {
             window.location.href = '/dashboard';
         }
     }
@@ -52,6 +63,43 @@ function showMessage(message, type = 'info') {
 function showLoginForm() {
     document.getElementById('loginForm').classList.remove('hidden');
     document.getElementById('registerForm').classList.add('hidden');
+    document.getElementById('recoveryKeyPanel').classList.add('hidden');
+    document.getElementById('recoveryKey').textContent = '';
+    document.getElementById('mfaForm').classList.add('hidden');
+    document.getElementById('webauthnSection').classList.add('hidden');
+    document.getElementById('ssoForm').classList.add('hidden');
+    document.getElementById('sso-password').value = '';
+    document.getElementById('previous-password').value = '';
+    document.getElementById('previousPasswordField').classList.add('hidden');
+    document.getElementById('forgotForm').classList.add('hidden');
+    document.getElementById('resetForm').classList.add('hidden');
+    document.getElementById('reset-recovery-key').value = '';
+    document.getElementById('reset-password').value = '';
+    mfaToken = null;
+    webauthnOptions = null;
+    ssoToken = null;
+    pendingLogin = null;
+    resetToken = null;
+}
+
+// 显示注册后生成的恢复密钥
+function showRecoveryKey(recoveryKey) {
+    document.getElementById('loginForm').classList.add('hidden');
+    document.getElementById('registerForm').classList.add('hidden');
+    document.getElementById('ssoForm').classList.add('hidden');
+    document.getElementById('mfaForm').classList.add('hidden');
+    document.getElementById('recoveryKey').textContent = recoveryKey;
+    document.getElementById('recoveryKeyContinue').textContent = pendingLogin ? '我已保存，继续' : '我已保存，去登录';
+    document.getElementById('recoveryKeyPanel').classList.remove('hidden');
+}
+
+// 关闭恢复密钥面板，单点登录首次设置时继续完成登录
+function closeRecoveryKey() {
+    const data = pendingLogin;
+    showLoginForm();
+    if (data) {
+        handleLoginResult(data);
+    }
 }
 
 // 显示注册表单
@@ -60,12 +108,124 @@ function showRegisterForm() {
     document.getElementById('registerForm').classList.remove('hidden');
 }
 
+// 显示忘记密码表单
+function showForgotForm() {
+    document.getElementById('loginForm').classList.add('hidden');
+    document.getElementById('forgotForm').classList.remove('hidden');
+    document.getElementById('forgot-email').focus();
+}
+
+// 申请发送密码重置邮件
+async function handleForgotPassword(event) {
+    event.preventDefault();
+    
+    const email = document.getElementById('forgot-email').value;
+    
+    try {
+        const response = await fetch('/api/password-reset', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ email }),
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            document.getElementById('forgot-email').value = '';
+            showLoginForm();
+            showMessage('如果该邮箱属于已验证的账户，重置链接已发送，请查收邮件', 'success');
+        } else {
+            showMessage(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Password reset error:', error);
+        showMessage('发送失败，请检查网络连接', 'error');
+    }
+}
+
+// 使用邮件中的令牌和恢复密钥重置密码
+async function handleResetPassword(event) {
+    event.preventDefault();
+    
+    const recovery_key = document.getElementById('reset-recovery-key').value.trim();
+    const new_password = document.getElementById('reset-password').value;
+    
+    try {
+        const response = await fetch('/api/password-reset/confirm', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ token: resetToken, recovery_key, new_password }),
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            showLoginForm();
+            showMessage('密码已重置，请使用新密码登录', 'success');
+        } else {
+            showMessage(data.message, 'error');
+            if (response.status === 400 && data.message === 'Reset link is invalid or has expired') {
+                showLoginForm();
+            }
+        }
+    } catch (error) {
+        console.error('Password reset error:', error);
+        showMessage('重置失败，请检查网络连接', 'error');
+    }
+}
+
+// 处理邮件中的验证链接和重置链接，读取后立即从地址栏清除
+async function handleEmailLink() {
+    if (!window.location.hash) {
+        return;
+    }
+    const params = new URLSearchParams(window.location.hash.substring(1));
+    if (!params.has('verify_email') && !params.has('reset_token')) {
+        return;
+    }
+    history.replaceState(null, '', window.location.pathname);
+    
+    if (params.has('reset_token')) {
+        resetToken = params.get('reset_token');
+        document.getElementById('loginForm').classList.add('hidden');
+        document.getElementById('resetForm').classList.remove('hidden');
+        document.getElementById('reset-recovery-key').focus();
+        return;
+    }
+    
+    try {
+        const response = await fetch('/api/email/verify', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ token: params.get('verify_email') }),
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            showMessage(`邮箱 ${data.data.email} 已验证`, 'success');
+        } else {
+            showMessage(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Email verification error:', error);
+        showMessage('验证失败，请检查网络连接', 'error');
+    }
+}
+
 // 处理登录
 async function handleLogin(event) {
     event.preventDefault();
     
     const username = document.getElementById('username').value;
     const password = document.getElementById('password').value;
+    const previous_password = document.getElementById('previous-password').value;
     
     try {
         const response = await fetch('/api/login', {
@@ -73,18 +233,21 @@ async function handleLogin(event) {
             headers: {
                 'Content-Type': 'application/json',
             },
-            body: JSON.stringify({ username, password }),
+            body: JSON.stringify({ username, password, previous_password }),
         });
         
         const data = await response.json();
         
-        if (data.success) {
-            localStorage.setItem('token', data.data.token);
-            localStorage.setItem('user', JSON.stringify(data.data.user));
-            showMessage('登录成功！正在跳转...', 'success');
-            setTimeout(() => {
-                window.location.href = '/dashboard';
-            }, 1000);
+        if (data.success && data.data.recovery_key) {
+            // 目录账户首次登录或旧账户补发恢复密钥，先展示恢复密钥再继续登录
+            pendingLogin = data.data;
+            showRecoveryKey(data.data.recovery_key);
+        } else if (data.success) {
+            handleLoginResult(data.data);
+        } else if (data.data && data.data.previous_password_required) {
+            document.getElementById('previousPasswordField').classList.remove('hidden');
+            document.getElementById('previous-password').focus();
+            showMessage(data.message, 'warning');
         } else {
             showMessage(data.message, 'error');
         }
@@ -94,6 +257,224 @@ async function handleLogin(event) {
     }
 }
 
+// 处理登录成功的响应：需要两步验证时显示验证码输入，否则保存令牌
+function handleLoginResult(data) {
+    if (data.mfa_required) {
+        // 密码正确，继续输入第二因素
+        mfaToken = data.mfa_token;
+        webauthnOptions = data.webauthn || null;
+        document.getElementById('loginForm').classList.add('hidden');
+        document.getElementById('ssoForm').classList.add('hidden');
+        document.getElementById('mfaForm').classList.remove('hidden');
+        if (webauthnOptions && window.PublicKeyCredential) {
+            document.getElementById('webauthnSection').classList.remove('hidden');
+        } else {
+            document.getElementById('mfa-code').focus();
+        }
+    } else {
+        completeLogin(data);
+    }
+}
+
+// 服务器配置了身份提供者时显示单点登录入口
+async function loadSSOStatus() {
+    try {
+        const response = await fetch('/api/sso');
+        const data = await response.json();
+        if (data.success && data.data.enabled) {
+            document.getElementById('ssoLoginSection').classList.remove('hidden');
+        }
+    } catch (error) {
+        console.error('SSO status error:', error);
+    }
+}
+
+// 跳转到身份提供者
+function startSSOLogin() {
+    window.location.href = '/api/sso/login';
+}
+
+// 处理身份提供者回调后带回的票据或错误，读取后立即从地址栏清除
+function handleSSORedirect() {
+    if (!window.location.hash) {
+        return;
+    }
+    const params = new URLSearchParams(window.location.hash.substring(1));
+    if (!params.has('sso_token') && !params.has('sso_error')) {
+        return;
+    }
+    history.replaceState(null, '', window.location.pathname);
+    
+    if (params.has('sso_error')) {
+        showMessage(params.get('sso_error'), 'error');
+        return;
+    }
+    
+    ssoToken = params.get('sso_token');
+    const setup = params.get('setup') === '1';
+    document.getElementById('ssoTitle').textContent = setup ? '设置主密码' : '解锁保险库';
+    document.getElementById('ssoHint').textContent = setup
+        ? `已通过单点登录验证为 ${params.get('username')}。单点登录无法加密您的数据，请设置一个主密码用于解锁保险库。`
+        : `已通过单点登录验证为 ${params.get('username')}，请输入主密码解锁保险库。`;
+    document.getElementById('sso-password').autocomplete = setup ? 'new-password' : 'current-password';
+    document.getElementById('loginForm').classList.add('hidden');
+    document.getElementById('ssoForm').classList.remove('hidden');
+    document.getElementById('sso-password').focus();
+}
+
+// 处理单点登录后的保险库解锁
+async function handleSSOUnlock(event) {
+    event.preventDefault();
+    
+    const password = document.getElementById('sso-password').value;
+    
+    try {
+        const response = await fetch('/api/sso/unlock', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ sso_token: ssoToken, password }),
+        });
+        
+        const data = await response.json();
+        
+        if (data.success && data.data.recovery_key) {
+            // 首次设置主密码，先展示恢复密钥再继续登录
+            pendingLogin = data.data;
+            showRecoveryKey(data.data.recovery_key);
+        } else if (data.success) {
+            handleLoginResult(data.data);
+        } else {
+            document.getElementById('sso-password').value = '';
+            showMessage(data.message, 'error');
+            if (response.status === 401 && data.message !== 'Invalid master password') {
+                // 票据已失效，需要重新经过身份提供者
+                showLoginForm();
+            }
+        }
+    } catch (error) {
+        console.error('SSO unlock error:', error);
+        showMessage('解锁失败，请检查网络连接', 'error');
+    }
+}
+
+// 第二因素验证通过后完成登录，补发的恢复密钥先展示给用户
+function completeMFALogin(data) {
+    if (data.recovery_key) {
+        pendingLogin = data;
+        showRecoveryKey(data.recovery_key);
+    } else {
+        completeLogin(data);
+    }
+}
+
+// 处理两步验证
+async function handleMFALogin(event) {
+    event.preventDefault();
+    
+    const code = document.getElementById('mfa-code').value;
+    
+    try {
+        const response = await fetch('/api/login/mfa', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ mfa_token: mfaToken, code }),
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            completeMFALogin(data.data);
+        } else {
+            document.getElementById('mfa-code').value = '';
+            showMessage(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('MFA login error:', error);
+        showMessage('验证失败，请检查网络连接', 'error');
+    }
+}
+
+// 使用安全密钥完成两步验证
+async function handleWebAuthnLogin() {
+    const options = webauthnOptions;
+    let credential;
+    try {
+        credential = await navigator.credentials.get({
+            publicKey: {
+                ...options,
+                challenge: base64urlToBuffer(options.challenge),
+                allowCredentials: options.allowCredentials.map(c => ({ ...c, id: base64urlToBuffer(c.id) })),
+            },
+        });
+    } catch (error) {
+        console.error('WebAuthn error:', error);
+        showMessage('未能读取安全密钥，请重试或输入验证码', 'error');
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/login/webauthn', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                mfa_token: mfaToken,
+                credential: {
+                    id: credential.id,
+                    rawId: bufferToBase64url(credential.rawId),
+                    type: credential.type,
+                    response: {
+                        clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+                        authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+                        signature: bufferToBase64url(credential.response.signature),
+                        userHandle: credential.response.userHandle ? bufferToBase64url(credential.response.userHandle) : '',
+                    },
+                },
+            }),
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            completeMFALogin(data.data);
+        } else {
+            showMessage(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('WebAuthn login error:', error);
+        showMessage('验证失败，请检查网络连接', 'error');
+    }
+}
+
+// base64url 与 ArrayBuffer 互相转换，WebAuthn 选项和响应中的二进制字段都使用 base64url
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+// 保存令牌并跳转到仪表板
+function completeLogin(data) {
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refresh_token', data.refresh_token);
+    localStorage.setItem('token_expires_at', Date.now() + data.expires_in * 1000);
+    localStorage.setItem('user', JSON.stringify(data.user));
+    showMessage('登录成功！正在跳转...', 'success');
+    setTimeout(() => {
+        window.location.href = '/dashboard';
+    }, 1000);
+}
+
 // 处理注册
 async function handleRegister(event) {
     event.preventDefault();
@@ -120,8 +501,8 @@ async function handleRegister(event) {
         const data = await response.json();
         
         if (data.success) {
-            showMessage('注册成功！请登录', 'success');
-            showLoginForm();
+            showMessage('注册成功！请保存恢复密钥，并查收邮箱验证邮件', 'success');
+            showRecoveryKey(data.data.recovery_key);
             // 清空注册表单
             document.getElementById('reg-username').value = '';
             document.getElementById('reg-email').value = '';
@@ -138,4 +519,7 @@ async function handleRegister(event) {
 // 页面加载时检查认证状态
 document.addEventListener('DOMContentLoaded', function() {
     checkAuth();
+    loadSSOStatus();
+    handleSSORedirect();
+    handleEmailLink();
 });
@@ -2,6 +2,45 @@ let passwords = [];
 let allPasswords = []; // 保存所有密码用于搜索
 let categories = [];
 let currentEditingId = null;
+// 保险库闲置锁定时间（秒），0表示不自动锁定；与服务器同步清除页面上的解密数据
+let vaultIdleTimeout = 0;
+let vaultIdleTimer = null;
+// 解锁后要重试的操作
+let unlockRetry = null;
+// 条目类型的名称和图标
+const itemTypes = {
+    login: { name: '登录', icon: 'fa-key' },
+    note: { name: '安全笔记', icon: 'fa-sticky-note' },
+    card: { name: '银行卡', icon: 'fa-credit-card' },
+    identity: { name: '身份信息', icon: 'fa-id-card' },
+    ssh_key: { name: 'SSH密钥', icon: 'fa-terminal' }
+};
+// 身份信息字段与表单输入框的对应关系
+const identityInputs = {
+    first_name: 'identityFirstName',
+    last_name: 'identityLastName',
+    email: 'identityEmail',
+    phone: 'identityPhone',
+    company: 'identityCompany',
+    address: 'identityAddress',
+    city: 'identityCity',
+    state: 'identityState',
+    postal_code: 'identityPostalCode',
+    country: 'identityCountry',
+    birth_date: 'identityBirthDate',
+    id_number: 'identityIDNumber'
+};
+// 自定义字段类型的名称
+const fieldKinds = {
+    text: '文本',
+    hidden: '隐藏',
+    boolean: '是/否',
+    link: '链接'
+};
+// 条目当前的两步验证码及剩余秒数
+let passwordHistory = []; // 当前编辑条目的历史密码
+let totpCodes = {};
+let totpTimer = null;
 
 // 检查认证状态
 function checkAuth() {
@@ -15,6 +54,9 @@ function checkAuth() {
     
     // 显示用户名
     document.getElementById('username').textContent = user.username || '用户';
+    if (user.email_verified === false) {
+        document.getElementById('emailVerifyBanner').classList.remove('hidden');
+    }
     return true;
 }
 
@@ -58,11 +100,65 @@ function showToast(message, type = 'info') {
 
 // 退出登录
 function logout() {
+    const token = localStorage.getItem('token');
+    if (token) {
+        // 撤销服务器端会话，失败也不影响本地退出
+        fetch('/api/logout', {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            keepalive: true
+        }).catch(() => {});
+    }
+    clearSession();
+}
+
+// 清除本地会话并返回登录页
+function clearSession() {
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+    localStorage.removeItem('token_expires_at');
     localStorage.removeItem('user');
     window.location.href = '/';
 }
 
+// 在访问令牌过期前用刷新令牌换取新令牌
+async function refreshToken() {
+    const refresh = localStorage.getItem('refresh_token');
+    if (!refresh) {
+        clearSession();
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/refresh', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refresh })
+        });
+        const data = await response.json();
+
+        if (!data.success) {
+            clearSession();
+            return;
+        }
+
+        localStorage.setItem('token', data.data.token);
+        localStorage.setItem('refresh_token', data.data.refresh_token);
+        localStorage.setItem('token_expires_at', Date.now() + data.data.expires_in * 1000);
+        scheduleTokenRefresh();
+    } catch (error) {
+        console.error('Refresh token error:', error);
+        setTimeout(refreshToken, 30000);
+    }
+}
+
+// 安排下一次令牌刷新（提前一分钟）
+function scheduleTokenRefresh() {
+    const expiresAt = parseInt(localStorage.getItem('token_expires_at') || '0', 10);
+    const delay = Math.max(expiresAt - Date.now() - 60000, 0);
+    setTimeout(refreshToken, delay);
+}
+
 // 加载密码列表
 async function loadPasswords() {
     try {
@@ -70,9 +166,19 @@ async function loadPasswords() {
             headers: getAuthHeaders()
         });
         
+        // 会话失效时需要重新登录
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
         const data = await response.json();
+        if (vaultLocked(data, loadPasswords)) {
+            return;
+        }
         
         if (data.success) {
+            touchVault();
             allPasswords = data.data || [];
             passwords = [...allPasswords];
             renderPasswordList();
@@ -86,6 +192,29 @@ async function loadPasswords() {
     }
 }
 
+// 渲染无法解密的条目，只能删除
+function renderUndecryptableCard(password) {
+    return `
+        <div class="bg-white rounded-lg shadow-md p-6 border border-red-200">
+            <div class="flex items-start justify-between">
+                <div class="flex items-center space-x-3">
+                    <div class="w-8 h-8 bg-red-50 rounded flex items-center justify-center">
+                        <i class="fas fa-exclamation-triangle text-red-500 text-sm"></i>
+                    </div>
+                    <div class="flex-1 min-w-0">
+                        <h3 class="text-lg font-medium text-gray-900">无法解密的条目 #${password.id}</h3>
+                        <p class="text-sm text-gray-500">数据已损坏或使用了其他密钥加密，请联系管理员</p>
+                    </div>
+                </div>
+                <button onclick="deletePassword(${password.id})"
+                        class="p-2 text-red-600 hover:text-red-800 hover:bg-red-50 rounded-full transition-colors"
+                        title="删除">
+                    <i class="fas fa-trash"></i>
+                </button>
+            </div>
+        </div>`;
+}
+
 // 渲染密码列表
 function renderPasswordList() {
     const passwordList = document.getElementById('passwordList');
@@ -100,6 +229,10 @@ function renderPasswordList() {
     emptyState.classList.add('hidden');
     
     passwordList.innerHTML = passwords.map(password => {
+        if (password.undecryptable) {
+            return renderUndecryptableCard(password);
+        }
+
         const websiteUrl = password.website && !password.website.startsWith('http') ?
             `https://${password.website}` : password.website;
         const domain = password.website ? new URL(websiteUrl || 'https://example.com').hostname : '';
@@ -110,7 +243,11 @@ function renderPasswordList() {
             <div class="flex items-start justify-between mb-4">
                 <div class="flex items-center space-x-3">
                     <div class="flex-shrink-0">
-                        ${faviconUrl ?
+                        ${password.type && password.type !== 'login' ?
+                            `<div class="w-8 h-8 bg-indigo-50 rounded flex items-center justify-center" title="${itemTypes[password.type].name}">
+                                <i class="fas ${itemTypes[password.type].icon} text-indigo-500 text-sm"></i>
+                             </div>` :
+                         faviconUrl ?
                             `<img src="${faviconUrl}" alt="网站图标" class="w-8 h-8 rounded" onerror="this.style.display='none'; this.nextElementSibling.style.display='block';">
                              <div class="w-8 h-8 bg-gray-200 rounded flex items-center justify-center" style="display:none;">
                                 <i class="fas fa-globe text-gray-400 text-sm"></i>
@@ -122,15 +259,16 @@ function renderPasswordList() {
                     </div>
                     <div class="flex-1 min-w-0">
                         <h3 class="text-lg font-medium text-gray-900 truncate">${password.title}</h3>
-                        <p class="text-sm text-gray-500 truncate">${password.username || '无用户名'}</p>
+                        <p class="text-sm text-gray-500 truncate">${itemSubtitle(password)}</p>
                     </div>
                 </div>
                 <div class="flex items-center space-x-2">
-                    <button onclick="copyPassword('${password.password}')"
+                    ${copyTitle(password) ? `
+                    <button onclick="copyItemSecret(${password.id})"
                             class="p-2 text-gray-400 hover:text-gray-600 hover:bg-gray-100 rounded-full transition-colors"
-                            title="复制密码">
+                            title="${copyTitle(password)}">
                         <i class="fas fa-copy"></i>
-                    </button>
+                    </button>` : ''}
                     <button onclick="editPassword(${password.id})"
                             class="p-2 text-indigo-600 hover:text-indigo-800 hover:bg-indigo-50 rounded-full transition-colors"
                             title="编辑">
@@ -161,6 +299,27 @@ function renderPasswordList() {
                     </span>
                 </div>` : ''}
 
+                ${password.totp_secret ? `
+                <div class="flex items-center text-sm text-gray-600">
+                    <i class="fas fa-clock w-4 mr-2"></i>
+                    <button onclick="copyTOTPCode(${password.id})" class="font-mono text-indigo-600 hover:text-indigo-800 tracking-widest" title="复制验证码">
+                        <span id="totp-${password.id}">······</span>
+                    </button>
+                    <span id="totp-remaining-${password.id}" class="ml-2 text-xs text-gray-400"></span>
+                </div>` : ''}
+
+                ${(password.fields || []).map((field, index) => `
+                <div class="flex items-center text-sm text-gray-600">
+                    <span class="w-24 flex-shrink-0 truncate text-gray-500" title="${escapeHtml(field.name)}">${escapeHtml(field.name)}</span>
+                    ${renderCustomFieldValue(password.id, field, index)}
+                </div>`).join('')}
+
+                ${password.attachments ? `
+                <div class="flex items-center text-sm text-gray-600">
+                    <i class="fas fa-paperclip w-4 mr-2"></i>
+                    <button onclick="editPassword(${password.id})" class="text-indigo-600 hover:text-indigo-800">${password.attachments} 个附件</button>
+                </div>` : ''}
+
                 ${password.notes ? `
                 <div class="flex items-start text-sm text-gray-600">
                     <i class="fas fa-sticky-note w-4 mr-2 mt-0.5"></i>
@@ -177,13 +336,177 @@ function renderPasswordList() {
         </div>
         `;
     }).join('');
+
+    refreshTOTPCodes();
+}
+
+// 获取列表中所有条目的两步验证码，每秒更新倒计时
+function refreshTOTPCodes() {
+    clearInterval(totpTimer);
+    totpCodes = {};
+    const ids = passwords.filter(p => p.totp_secret).map(p => p.id);
+    if (ids.length === 0) {
+        return;
+    }
+    ids.forEach(loadTOTPCode);
+    totpTimer = setInterval(tickTOTPCodes, 1000);
+}
+
+// 获取条目的当前验证码
+async function loadTOTPCode(id) {
+    try {
+        const response = await fetch(`/api/passwords/${id}/totp`, {
+            headers: getAuthHeaders()
+        });
+        const data = await response.json();
+        if (vaultLocked(data, loadPasswords)) {
+            return;
+        }
+        if (data.success) {
+            totpCodes[id] = data.data;
+            renderTOTPCode(id);
+        }
+    } catch (error) {
+        console.error('Load TOTP code error:', error);
+    }
+}
+
+// 倒计时结束时获取新验证码
+function tickTOTPCodes() {
+    Object.keys(totpCodes).forEach(id => {
+        const totp = totpCodes[id];
+        totp.remaining--;
+        if (totp.remaining <= 0) {
+            delete totpCodes[id];
+            loadTOTPCode(Number(id));
+        } else {
+            renderTOTPCode(id);
+        }
+    });
+}
+
+// 显示验证码和剩余秒数
+function renderTOTPCode(id) {
+    const totp = totpCodes[id];
+    const code = document.getElementById(`totp-${id}`);
+    const remaining = document.getElementById(`totp-remaining-${id}`);
+    if (!totp || !code || !remaining) {
+        return;
+    }
+    code.textContent = totp.code;
+    remaining.textContent = `${totp.remaining}秒`;
+}
+
+// 复制两步验证码到剪贴板
+async function copyTOTPCode(id) {
+    const totp = totpCodes[id];
+    if (!totp) {
+        return;
+    }
+    try {
+        await navigator.clipboard.writeText(totp.code);
+        showToast('验证码已复制到剪贴板', 'success');
+    } catch (error) {
+        console.error('Copy error:', error);
+        showToast('复制失败', 'error');
+    }
+}
+
+// 转义要插入HTML的文本
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text == null ? '' : String(text);
+    return div.innerHTML;
+}
+
+// 按字段类型显示自定义字段的值，隐藏字段只提供复制
+function renderCustomFieldValue(id, field, index) {
+    switch (field.kind) {
+    case 'hidden':
+        return `<span class="font-mono text-gray-400">••••••</span>
+                <button onclick="copyCustomField(${id}, ${index})" class="ml-2 text-gray-400 hover:text-gray-600" title="复制">
+                    <i class="fas fa-copy"></i>
+                </button>`;
+    case 'boolean':
+        return `<span>${field.value === 'true' ? '是' : '否'}</span>`;
+    case 'link':
+        return /^https?:\/\//i.test(field.value) ?
+            `<a href="${escapeHtml(field.value)}" target="_blank" rel="noopener" class="text-blue-600 hover:text-blue-800 truncate">${escapeHtml(field.value)}</a>` :
+            `<span class="truncate">${escapeHtml(field.value)}</span>`;
+    default:
+        return `<span class="truncate">${escapeHtml(field.value)}</span>`;
+    }
+}
+
+// 复制自定义字段的值
+async function copyCustomField(id, index) {
+    const password = passwords.find(p => p.id === id);
+    if (!password || !password.fields || !password.fields[index]) return;
+
+    try {
+        await navigator.clipboard.writeText(password.fields[index].value);
+        showToast(`${password.fields[index].name}已复制到剪贴板`, 'success');
+    } catch (error) {
+        console.error('Copy error:', error);
+        showToast('复制失败', 'error');
+    }
+}
+
+// 条目卡片上显示的摘要
+function itemSubtitle(password) {
+    switch (password.type) {
+    case 'note':
+        return '安全笔记';
+    case 'card': {
+        const card = password.card || {};
+        const brand = card.brand ? card.brand.toUpperCase() + ' ' : '';
+        return `${brand}•••• ${(card.number || '').slice(-4)}${card.expiry ? ' · ' + card.expiry : ''}`;
+    }
+    case 'identity': {
+        const identity = password.identity || {};
+        const name = [identity.last_name, identity.first_name].filter(Boolean).join(' ');
+        return name || identity.email || '身份信息';
+    }
+    case 'ssh_key':
+        return (password.ssh_key && password.ssh_key.fingerprint) || 'SSH密钥';
+    default:
+        return password.username || '无用户名';
+    }
+}
+
+// 复制按钮的说明，没有可复制内容的类型返回空字符串
+function copyTitle(password) {
+    switch (password.type) {
+    case 'card':
+        return '复制卡号';
+    case 'ssh_key':
+        return password.ssh_key && password.ssh_key.public_key ? '复制公钥' : '';
+    case 'note':
+    case 'identity':
+        return '';
+    default:
+        return '复制密码';
+    }
 }
 
-// 复制密码到剪贴板
-async function copyPassword(password) {
+// 复制条目的主要内容：登录条目为密码，银行卡为卡号，SSH密钥为公钥
+async function copyItemSecret(id) {
+    const password = passwords.find(p => p.id === id);
+    if (!password) return;
+
+    let value = password.password;
+    let message = '密码已复制到剪贴板';
+    if (password.type === 'card') {
+        value = password.card.number;
+        message = '卡号已复制到剪贴板';
+    } else if (password.type === 'ssh_key') {
+        value = password.ssh_key.public_key;
+        message = '公钥已复制到剪贴板';
+    }
+
     try {
-        await navigator.clipboard.writeText(password);
-        showToast('密码已复制到剪贴板', 'success');
+        await navigator.clipboard.writeText(value);
+        showToast(message, 'success');
     } catch (error) {
         console.error('Copy error:', error);
         showToast('复制失败', 'error');
@@ -196,6 +519,11 @@ function showAddPasswordModal() {
     document.getElementById('modalTitle').textContent = '添加密码';
     document.getElementById('passwordForm').reset();
     document.getElementById('passwordId').value = '';
+    document.getElementById('sshFingerprint').textContent = '';
+    setCustomFieldRows([]);
+    updateItemTypeFields();
+    document.getElementById('attachmentsSection').classList.add('hidden');
+    document.getElementById('historySection').classList.add('hidden');
     document.getElementById('passwordModal').classList.remove('hidden');
 }
 
@@ -213,10 +541,400 @@ function editPassword(id) {
     document.getElementById('passwordField').value = password.password;
     document.getElementById('category').value = password.category || '';
     document.getElementById('notes').value = password.notes || '';
+    document.getElementById('totpSecret').value = password.totp_secret || '';
+    document.getElementById('itemType').value = password.type || 'login';
+
+    const card = password.card || {};
+    document.getElementById('cardCardholder').value = card.cardholder || '';
+    document.getElementById('cardNumber').value = card.number || '';
+    document.getElementById('cardExpiry').value = card.expiry || '';
+    document.getElementById('cardCVV').value = card.cvv || '';
+
+    const identity = password.identity || {};
+    Object.entries(identityInputs).forEach(([field, inputId]) => {
+        document.getElementById(inputId).value = identity[field] || '';
+    });
+
+    const sshKey = password.ssh_key || {};
+    document.getElementById('sshPrivateKey').value = sshKey.private_key || '';
+    document.getElementById('sshPublicKey').value = sshKey.public_key || '';
+    document.getElementById('sshFingerprint').textContent = sshKey.fingerprint || '';
+
+    setCustomFieldRows(password.fields || []);
+    updateItemTypeFields();
+
+    // 附件直接上传到已保存的条目，新建条目时不显示
+    document.getElementById('attachmentsSection').classList.remove('hidden');
+    loadAttachments(id);
+
+    // 历史密码按需加载，避免打开编辑框时就显示旧密码
+    document.getElementById('historySection').classList.remove('hidden');
+    document.getElementById('historyList').innerHTML = '';
     
     document.getElementById('passwordModal').classList.remove('hidden');
 }
 
+// 加载条目的历史密码
+async function loadPasswordHistory(id) {
+    const list = document.getElementById('historyList');
+
+    try {
+        const response = await fetch(`/api/passwords/${id}/history`, {
+            headers: getAuthHeaders()
+        });
+        const data = await response.json();
+        if (vaultLocked(data, () => loadPasswordHistory(id))) {
+            return;
+        }
+        if (!data.success) {
+            showToast(data.message, 'error');
+            return;
+        }
+
+        passwordHistory = data.data;
+        if (passwordHistory.length === 0) {
+            list.innerHTML = '<p class="text-xs text-gray-500">没有历史密码</p>';
+            return;
+        }
+        list.innerHTML = passwordHistory.map((entry, index) => `
+            <div class="flex items-center text-sm text-gray-600">
+                <span class="flex-1 min-w-0 font-mono truncate" id="history-${entry.id}">••••••••</span>
+                <span class="ml-2 text-xs text-gray-400">${new Date(entry.replaced_at).toLocaleString()}</span>
+                <button type="button" onclick="toggleHistoryPassword(${index})" class="p-1 ml-1 text-gray-400 hover:text-gray-600" title="显示">
+                    <i class="fas fa-eye"></i>
+                </button>
+                <button type="button" onclick="copyHistoryPassword(${index})" class="p-1 text-gray-400 hover:text-gray-600" title="复制">
+                    <i class="fas fa-copy"></i>
+                </button>
+                <button type="button" onclick="restorePasswordHistory(${id}, ${entry.id})" class="p-1 text-indigo-600 hover:text-indigo-800" title="恢复">
+                    <i class="fas fa-undo"></i>
+                </button>
+            </div>`).join('');
+        touchVault();
+    } catch (error) {
+        console.error('Load password history error:', error);
+        showToast('加载历史密码失败', 'error');
+    }
+}
+
+// 显示或隐藏一条历史密码
+function toggleHistoryPassword(index) {
+    const entry = passwordHistory[index];
+    const span = document.getElementById(`history-${entry.id}`);
+    span.textContent = span.textContent === '••••••••' ? entry.password : '••••••••';
+}
+
+// 复制历史密码
+async function copyHistoryPassword(index) {
+    try {
+        await navigator.clipboard.writeText(passwordHistory[index].password);
+        showToast('历史密码已复制到剪贴板', 'success');
+    } catch (error) {
+        console.error('Copy error:', error);
+        showToast('复制失败', 'error');
+    }
+}
+
+// 恢复历史密码，当前密码会保存到历史中
+async function restorePasswordHistory(id, historyId) {
+    if (!confirm('确定要恢复这个历史密码吗？当前密码将保存到历史中。')) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/passwords/${id}/history/${historyId}/restore`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+
+        const data = await response.json();
+        if (vaultLocked(data, () => restorePasswordHistory(id, historyId))) {
+            return;
+        }
+        if (data.success) {
+            showToast('密码已恢复', 'success');
+            await loadPasswords();
+            const password = passwords.find(p => p.id === id);
+            if (password) {
+                document.getElementById('passwordField').value = password.password;
+            }
+            await loadPasswordHistory(id);
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Restore password error:', error);
+        showToast('恢复失败', 'error');
+    }
+}
+
+// 格式化文件大小
+function formatFileSize(bytes) {
+    if (bytes < 1024) return `${bytes} B`;
+    if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+    return `${(bytes / 1024 / 1024).toFixed(1)} MB`;
+}
+
+// 加载条目的附件列表
+async function loadAttachments(id) {
+    const list = document.getElementById('attachmentsList');
+    list.innerHTML = '';
+    document.getElementById('attachmentsUsage').textContent = '';
+
+    try {
+        const response = await fetch(`/api/passwords/${id}/attachments`, {
+            headers: getAuthHeaders()
+        });
+        const data = await response.json();
+        if (vaultLocked(data, () => loadAttachments(id))) {
+            return;
+        }
+        if (!data.success) {
+            showToast(data.message, 'error');
+            return;
+        }
+
+        list.innerHTML = data.data.attachments.map(attachment => `
+            <div class="flex items-center text-sm text-gray-600">
+                <i class="fas fa-file w-4 mr-2 text-gray-400"></i>
+                <button type="button" onclick="downloadAttachment(${id}, '${attachment.id}')" class="flex-1 min-w-0 text-left truncate text-indigo-600 hover:text-indigo-800"
+                        title="${escapeHtml(attachment.name)}">${escapeHtml(attachment.name)}</button>
+                <span class="ml-2 text-xs text-gray-400">${formatFileSize(attachment.size)}</span>
+                <button type="button" onclick="deleteAttachment(${id}, '${attachment.id}')" class="p-1 ml-1 text-red-500 hover:text-red-700" title="删除">
+                    <i class="fas fa-times"></i>
+                </button>
+            </div>`).join('');
+
+        const { used, quota } = data.data;
+        document.getElementById('attachmentsUsage').textContent = quota > 0 ?
+            `已使用 ${formatFileSize(used)} / ${formatFileSize(quota)}` : `已使用 ${formatFileSize(used)}`;
+    } catch (error) {
+        console.error('Load attachments error:', error);
+        showToast('加载附件失败', 'error');
+    }
+}
+
+// 上传附件到正在编辑的条目
+async function uploadAttachment(input) {
+    const file = input.files[0];
+    const id = currentEditingId;
+    input.value = '';
+    if (!file || !id) return;
+
+    const formData = new FormData();
+    formData.append('file', file);
+
+    try {
+        showToast(`正在上传 ${file.name}...`, 'info');
+        const response = await fetch(`/api/passwords/${id}/attachments`, {
+            method: 'POST',
+            headers: {
+                'Authorization': `Bearer ${localStorage.getItem('token')}`
+            },
+            body: formData
+        });
+
+        const data = await response.json();
+        if (vaultLocked(data)) {
+            return;
+        }
+        if (data.success) {
+            showToast('附件上传成功', 'success');
+            await loadAttachments(id);
+            await loadPasswords();
+        } else {
+            showToast(response.status === 413 ? '附件空间不足' : data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Upload attachment error:', error);
+        showToast('上传失败', 'error');
+    }
+}
+
+// 下载并保存附件
+async function downloadAttachment(id, attachmentId) {
+    try {
+        const response = await fetch(`/api/passwords/${id}/attachments/${attachmentId}`, {
+            headers: getAuthHeaders()
+        });
+
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            if (!vaultLocked(data, () => downloadAttachment(id, attachmentId))) {
+                showToast(data.message || '下载失败', 'error');
+            }
+            return;
+        }
+
+        // 从 Content-Disposition 中取出文件名，服务器对非 ASCII 文件名使用 RFC 2231 编码
+        const disposition = response.headers.get('Content-Disposition') || '';
+        const encoded = disposition.match(/filename\*=utf-8''([^;]+)/i);
+        const plain = disposition.match(/filename="?([^";]+)"?/i);
+        const filename = encoded ? decodeURIComponent(encoded[1]) : plain ? plain[1] : 'attachment';
+
+        const blob = await response.blob();
+        const url = window.URL.createObjectURL(blob);
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = filename;
+        document.body.appendChild(a);
+        a.click();
+        window.URL.revokeObjectURL(url);
+        document.body.removeChild(a);
+        touchVault();
+    } catch (error) {
+        console.error('Download attachment error:', error);
+        showToast('下载失败', 'error');
+    }
+}
+
+// 删除附件
+async function deleteAttachment(id, attachmentId) {
+    if (!confirm('确定要删除这个附件吗？')) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/passwords/${id}/attachments/${attachmentId}`, {
+            method: 'DELETE',
+            headers: getAuthHeaders()
+        });
+
+        const data = await response.json();
+        if (data.success) {
+            showToast('附件已删除', 'success');
+            await loadAttachments(id);
+            await loadPasswords();
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Delete attachment error:', error);
+        showToast('删除失败', 'error');
+    }
+}
+
+// 按条目类型显示对应的表单字段
+function updateItemTypeFields() {
+    const type = document.getElementById('itemType').value;
+    document.querySelectorAll('#passwordForm [data-item-types]').forEach(group => {
+        group.classList.toggle('hidden', !group.dataset.itemTypes.split(' ').includes(type));
+    });
+
+    // 只有登录条目必须填写密码，SSH密钥的密码字段用作私钥口令
+    const passwordField = document.getElementById('passwordField');
+    passwordField.required = type === 'login';
+    document.getElementById('passwordLabel').textContent = type === 'ssh_key' ? '私钥口令' : '密码 *';
+    document.getElementById('notesLabel').textContent = type === 'note' ? '内容 *' : '备注';
+}
+
+// 收集表单中当前类型的专属字段
+function itemTypeFields(type) {
+    switch (type) {
+    case 'card':
+        return {
+            card: {
+                cardholder: document.getElementById('cardCardholder').value,
+                number: document.getElementById('cardNumber').value,
+                expiry: document.getElementById('cardExpiry').value,
+                cvv: document.getElementById('cardCVV').value
+            }
+        };
+    case 'identity': {
+        const identity = {};
+        Object.entries(identityInputs).forEach(([field, inputId]) => {
+            identity[field] = document.getElementById(inputId).value;
+        });
+        return { identity };
+    }
+    case 'ssh_key':
+        return {
+            ssh_key: {
+                private_key: document.getElementById('sshPrivateKey').value,
+                public_key: document.getElementById('sshPublicKey').value
+            }
+        };
+    default:
+        return {};
+    }
+}
+
+// 用条目的自定义字段填充表单
+function setCustomFieldRows(fields) {
+    document.getElementById('customFieldsList').innerHTML = '';
+    fields.forEach(addCustomFieldRow);
+}
+
+// 在表单中添加一行自定义字段，输入框按字段类型切换
+function addCustomFieldRow(field) {
+    field = field || { name: '', value: '', kind: 'text' };
+    const inputClass = 'border border-gray-300 rounded-md px-2 py-1 text-sm focus:outline-none focus:ring-indigo-500 focus:border-indigo-500';
+
+    const row = document.createElement('div');
+    row.className = 'custom-field-row flex items-center space-x-1';
+
+    const name = document.createElement('input');
+    name.type = 'text';
+    name.placeholder = '名称';
+    name.className = `${inputClass} w-24 field-name`;
+    name.value = field.name;
+
+    const kind = document.createElement('select');
+    kind.className = `${inputClass} field-kind`;
+    Object.entries(fieldKinds).forEach(([value, label]) => {
+        kind.add(new Option(label, value, false, value === field.kind));
+    });
+
+    const value = document.createElement('input');
+    value.className = `${inputClass} flex-1 min-w-0 field-value`;
+    const updateValueInput = () => {
+        const isBoolean = kind.value === 'boolean';
+        value.type = isBoolean ? 'checkbox' : kind.value === 'hidden' ? 'password' : kind.value === 'link' ? 'url' : 'text';
+        value.classList.toggle('flex-1', !isBoolean);
+    };
+    kind.addEventListener('change', updateValueInput);
+    updateValueInput();
+    if (kind.value === 'boolean') {
+        value.checked = field.value === 'true';
+    } else {
+        value.value = field.value;
+    }
+
+    const up = document.createElement('button');
+    up.type = 'button';
+    up.title = '上移';
+    up.className = 'p-1 text-gray-400 hover:text-gray-600';
+    up.innerHTML = '<i class="fas fa-arrow-up"></i>';
+    up.addEventListener('click', () => {
+        if (row.previousElementSibling) {
+            row.parentNode.insertBefore(row, row.previousElementSibling);
+        }
+    });
+
+    const remove = document.createElement('button');
+    remove.type = 'button';
+    remove.title = '删除';
+    remove.className = 'p-1 text-red-500 hover:text-red-700';
+    remove.innerHTML = '<i class="fas fa-times"></i>';
+    remove.addEventListener('click', () => row.remove());
+
+    row.append(name, kind, value, up, remove);
+    document.getElementById('customFieldsList').appendChild(row);
+}
+
+// 按表单中的顺序收集自定义字段
+function collectCustomFields() {
+    return Array.from(document.querySelectorAll('#customFieldsList .custom-field-row')).map(row => {
+        const kind = row.querySelector('.field-kind').value;
+        const value = row.querySelector('.field-value');
+        return {
+            name: row.querySelector('.field-name').value,
+            kind: kind,
+            value: kind === 'boolean' ? String(value.checked) : value.value
+        };
+    });
+}
+
 // 关闭密码模态框
 function closePasswordModal() {
     document.getElementById('passwordModal').classList.add('hidden');
@@ -227,13 +945,19 @@ function closePasswordModal() {
 async function handlePasswordSubmit(event) {
     event.preventDefault();
     
+    const type = document.getElementById('itemType').value;
+    const isLogin = type === 'login';
     const formData = {
+        type: type,
         title: document.getElementById('title').value,
-        website: document.getElementById('website').value,
-        username: document.getElementById('passwordUsername').value,
-        password: document.getElementById('passwordField').value,
+        website: isLogin ? document.getElementById('website').value : '',
+        username: isLogin ? document.getElementById('passwordUsername').value : '',
+        password: isLogin || type === 'ssh_key' ? document.getElementById('passwordField').value : '',
         category: document.getElementById('category').value,
-        notes: document.getElementById('notes').value
+        notes: document.getElementById('notes').value,
+        totp_secret: isLogin ? document.getElementById('totpSecret').value : '',
+        fields: collectCustomFields(),
+        ...itemTypeFields(type)
     };
     
     try {
@@ -247,6 +971,9 @@ async function handlePasswordSubmit(event) {
         });
         
         const data = await response.json();
+        if (vaultLocked(data, () => handlePasswordSubmit(event))) {
+            return;
+        }
         
         if (data.success) {
             showToast(currentEditingId ? '密码更新成功' : '密码添加成功', 'success');
@@ -418,8 +1145,14 @@ async function exportData() {
             window.URL.revokeObjectURL(url);
             document.body.removeChild(a);
             showToast('数据导出成功', 'success');
+            touchVault();
         } else {
-            showToast('导出失败', 'error');
+            const data = await response.json().catch(() => ({}));
+            if (data.code === 'UNDECRYPTABLE_ENTRIES') {
+                showToast(`${data.data.entry_ids.length} 个条目无法解密，请改用导出全部数据`, 'error');
+            } else if (!vaultLocked(data, exportData)) {
+                showToast('导出失败', 'error');
+            }
         }
     } catch (error) {
         console.error('Export error:', error);
@@ -465,6 +1198,9 @@ async function handleImport(event) {
         });
 
         const data = await response.json();
+        if (vaultLocked(data, () => handleImport(event))) {
+            return;
+        }
 
         if (data.success) {
             showToast(data.message, 'success');
@@ -479,6 +1215,305 @@ async function handleImport(event) {
     }
 }
 
+// 显示安全密钥模态框
+async function showSecurityKeyModal() {
+    document.getElementById('securityKeyModal').classList.remove('hidden');
+    await loadSecurityKeys();
+}
+
+// 关闭安全密钥模态框
+function closeSecurityKeyModal() {
+    document.getElementById('securityKeyModal').classList.add('hidden');
+    document.getElementById('securityKeyForm').reset();
+    document.getElementById('backupCodesPanel').classList.add('hidden');
+    document.getElementById('backupCodes').textContent = '';
+}
+
+// 加载已注册的安全密钥
+async function loadSecurityKeys() {
+    try {
+        const response = await fetch('/api/mfa/webauthn', {
+            headers: getAuthHeaders()
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            renderSecurityKeys(data.data);
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Load security keys error:', error);
+        showToast('加载安全密钥失败', 'error');
+    }
+}
+
+// 渲染安全密钥列表
+function renderSecurityKeys(keys) {
+    const list = document.getElementById('securityKeyList');
+    list.innerHTML = '';
+
+    if (keys.length === 0) {
+        list.innerHTML = '<li class="py-2 text-sm text-gray-500">尚未添加安全密钥</li>';
+        return;
+    }
+
+    keys.forEach(key => {
+        const item = document.createElement('li');
+        item.className = 'py-2 flex items-center justify-between';
+        item.innerHTML = `
+            <div>
+                <p class="text-sm font-medium text-gray-900"></p>
+                <p class="text-xs text-gray-500">最近使用：${key.last_used_at ? new Date(key.last_used_at).toLocaleString() : '从未'}</p>
+            </div>
+            <button class="p-2 text-red-600 hover:text-red-800 hover:bg-red-50 rounded-full transition-colors" title="删除">
+                <i class="fas fa-trash"></i>
+            </button>`;
+        item.querySelector('p').textContent = key.name;
+        item.querySelector('button').onclick = () => deleteSecurityKey(key.id);
+        list.appendChild(item);
+    });
+}
+
+// 注册新的安全密钥
+async function handleAddSecurityKey(event) {
+    event.preventDefault();
+
+    const name = document.getElementById('securityKeyName').value;
+    const password = document.getElementById('securityKeyPassword').value;
+
+    if (!window.PublicKeyCredential) {
+        showToast('当前浏览器不支持安全密钥', 'error');
+        return;
+    }
+
+    try {
+        const begin = await fetch('/api/mfa/webauthn/register/begin', {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ password })
+        });
+        const options = await begin.json();
+        if (!options.success) {
+            showToast(options.message, 'error');
+            return;
+        }
+
+        const publicKey = options.data;
+        const credential = await navigator.credentials.create({
+            publicKey: {
+                ...publicKey,
+                challenge: base64urlToBuffer(publicKey.challenge),
+                user: { ...publicKey.user, id: base64urlToBuffer(publicKey.user.id) },
+                excludeCredentials: publicKey.excludeCredentials.map(c => ({ ...c, id: base64urlToBuffer(c.id) })),
+            }
+        });
+
+        const response = await fetch('/api/mfa/webauthn/register/finish', {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({
+                name,
+                credential: {
+                    id: credential.id,
+                    rawId: bufferToBase64url(credential.rawId),
+                    type: credential.type,
+                    response: {
+                        clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+                        attestationObject: bufferToBase64url(credential.response.attestationObject),
+                        transports: credential.response.getTransports ? credential.response.getTransports() : [],
+                    },
+                },
+            })
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            showToast(data.message, 'success');
+            document.getElementById('securityKeyForm').reset();
+            if (data.data.backup_codes) {
+                document.getElementById('backupCodes').textContent = data.data.backup_codes.join('\n');
+                document.getElementById('backupCodesPanel').classList.remove('hidden');
+            }
+            await loadSecurityKeys();
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Register security key error:', error);
+        showToast('添加安全密钥失败', 'error');
+    }
+}
+
+// 删除安全密钥
+async function deleteSecurityKey(id) {
+    const password = prompt('请输入主密码以删除此安全密钥');
+    if (!password) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/mfa/webauthn/${id}`, {
+            method: 'DELETE',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ password })
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            showToast(data.message, 'success');
+            await loadSecurityKeys();
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Delete security key error:', error);
+        showToast('删除失败', 'error');
+    }
+}
+
+// 服务器返回 VAULT_LOCKED 时清除页面上的解密数据并提示解锁，解锁后重试 retry
+function vaultLocked(data, retry) {
+    if (!data || data.code !== 'VAULT_LOCKED') {
+        return false;
+    }
+    showUnlockModal(retry);
+    return true;
+}
+
+// 清除页面上的解密数据并显示解锁对话框
+function showUnlockModal(retry) {
+    clearTimeout(vaultIdleTimer);
+    allPasswords = [];
+    passwords = [];
+    renderPasswordList();
+    unlockRetry = retry;
+    document.getElementById('unlockModal').classList.remove('hidden');
+    document.getElementById('unlockPassword').focus();
+}
+
+// 使用主密码解锁保险库
+async function handleUnlock(event) {
+    event.preventDefault();
+
+    const password = document.getElementById('unlockPassword').value;
+
+    try {
+        const response = await fetch('/api/unlock', {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ password })
+        });
+
+        const data = await response.json();
+        document.getElementById('unlockPassword').value = '';
+
+        // 会话本身已失效时需要重新登录
+        if (response.status === 401 && data.message !== 'Invalid master password') {
+            logout();
+            return;
+        }
+
+        if (data.success) {
+            vaultIdleTimeout = data.data.idle_timeout;
+            document.getElementById('unlockModal').classList.add('hidden');
+            const retry = unlockRetry;
+            unlockRetry = null;
+            await retry();
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Unlock error:', error);
+        showToast('解锁失败', 'error');
+    }
+}
+
+// 立即锁定保险库，会话保持登录
+async function lockVault() {
+    try {
+        await fetch('/api/lock', {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+    } catch (error) {
+        console.error('Lock error:', error);
+    }
+    closePasswordModal();
+    showUnlockModal(loadPasswords);
+}
+
+// 读取保险库闲置锁定时间
+async function loadVaultStatus() {
+    try {
+        const response = await fetch('/api/vault/status', {
+            headers: getAuthHeaders()
+        });
+        const data = await response.json();
+        if (data.success) {
+            vaultIdleTimeout = data.data.idle_timeout;
+            if (!data.data.locked) {
+                touchVault();
+            }
+        }
+    } catch (error) {
+        console.error('Vault status error:', error);
+    }
+}
+
+// 使用过保险库后重新开始闲置计时，超时后服务器已清除密钥，页面也随之锁定
+function touchVault() {
+    clearTimeout(vaultIdleTimer);
+    if (vaultIdleTimeout > 0) {
+        vaultIdleTimer = setTimeout(() => {
+            closePasswordModal();
+            showUnlockModal(loadPasswords);
+        }, vaultIdleTimeout * 1000);
+    }
+}
+
+// 重新发送邮箱验证邮件
+async function resendVerificationEmail() {
+    try {
+        const response = await fetch('/api/account/email/verification', {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            showToast('验证邮件已发送，请查收', 'success');
+        } else if (data.message === 'Email is already verified') {
+            const user = JSON.parse(localStorage.getItem('user') || '{}');
+            user.email_verified = true;
+            localStorage.setItem('user', JSON.stringify(user));
+            document.getElementById('emailVerifyBanner').classList.add('hidden');
+            showToast('邮箱已验证', 'success');
+        } else {
+            showToast(data.message, 'error');
+        }
+    } catch (error) {
+        console.error('Resend verification email error:', error);
+        showToast('发送失败', 'error');
+    }
+}
+
+// base64url 与 ArrayBuffer 互相转换，WebAuthn 选项和响应中的二进制字段都使用 base64url
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+    return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const binary = String.fromCharCode(...new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
 // 切换导入导出菜单
 function toggleImportExportMenu() {
     const menu = document.getElementById('importExportMenu');
@@ -518,16 +1553,19 @@ function renderCategoryFilter() {
 function filterPasswords() {
     const searchTerm = document.getElementById('searchInput').value.toLowerCase();
     const selectedCategory = document.getElementById('categoryFilter').value;
+    const selectedType = document.getElementById('typeFilter').value;
 
     passwords = allPasswords.filter(password => {
         const matchesSearch = !searchTerm ||
             password.title.toLowerCase().includes(searchTerm) ||
             (password.website && password.website.toLowerCase().includes(searchTerm)) ||
-            (password.username && password.username.toLowerCase().includes(searchTerm));
+            (password.username && password.username.toLowerCase().includes(searchTerm)) ||
+            (password.fields || []).some(field => field.name.toLowerCase().includes(searchTerm));
 
         const matchesCategory = !selectedCategory || password.category === selectedCategory;
+        const matchesType = !selectedType || (password.type || 'login') === selectedType;
 
-        return matchesSearch && matchesCategory;
+        return matchesSearch && matchesCategory && matchesType;
     });
 
     renderPasswordList();
@@ -536,12 +1574,21 @@ function filterPasswords() {
 // 页面加载时初始化
 document.addEventListener('DOMContentLoaded', function() {
     if (checkAuth()) {
-        loadPasswords();
+        const expiresAt = parseInt(localStorage.getItem('token_expires_at') || '0', 10);
+        if (expiresAt - Date.now() < 60000) {
+            // 访问令牌即将或已经过期，先刷新再加载
+            refreshToken().then(loadPasswords).then(loadVaultStatus);
+        } else {
+            scheduleTokenRefresh();
+            loadPasswords();
+            loadVaultStatus();
+        }
     }
 
     // 添加搜索和筛选事件监听器
     const searchInput = document.getElementById('searchInput');
     const categoryFilter = document.getElementById('categoryFilter');
+    const typeFilter = document.getElementById('typeFilter');
 
     if (searchInput) {
         searchInput.addEventListener('input', filterPasswords);
@@ -551,6 +1598,10 @@ document.addEventListener('DOMContentLoaded', function() {
         categoryFilter.addEventListener('change', filterPasswords);
     }
 
+    if (typeFilter) {
+        typeFilter.addEventListener('change', filterPasswords);
+    }
+
     // 点击外部关闭菜单
     document.addEventListener('click', function(event) {
         const menu = document.getElementById('importExportMenu');